@@ -0,0 +1,267 @@
+// Command capi exports the StarGate keystream and AEAD to C. Build it as a
+// shared or static library:
+//
+//	go build -buildmode=c-shared -o libstargate.so ./capi
+//	go build -buildmode=c-archive -o libstargate.a ./capi
+//
+// Both also write libstargate.h, the header to include. The Makefile in
+// this directory does the same and runs the C known-answer tests in test/
+// against both builds. See the comment block at the top of the header for
+// the API and its memory ownership rules.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+
+// StarGate C API
+//
+// Memory ownership
+//
+//   - The library never keeps a pointer it is given. Every buffer passed in
+//     (keys, nonces, plaintexts, associated data, output buffers) is read or
+//     written during the call only and stays owned by the caller, who may
+//     free or reuse it as soon as the call returns.
+//   - Keys are copied into library memory, which is wiped when the stream
+//     is freed (stargate_free) or right after an AEAD call returns. The
+//     caller remains responsible for wiping its own copy.
+//   - The library never allocates memory the caller must free. Output goes
+//     into caller buffers of the sizes given below.
+//   - A stargate_t is a handle, not a pointer. It is valid from
+//     stargate_new until stargate_free. Using it afterwards, or freeing it
+//     twice, returns STARGATE_EINVAL instead of touching freed memory.
+//   - A stream may be shared between threads; calls on it are serialized.
+//
+// A pointer may be NULL only when its length is 0. Functions that return
+// int return STARGATE_OK on success and a negative STARGATE_E* code on
+// failure, in which case output buffers hold no meaningful data.
+
+#define STARGATE_OK      0
+#define STARGATE_EINVAL  (-1)  // NULL pointer with a length, bad sizes, unknown handle
+#define STARGATE_EAUTH   (-2)  // stargate_aead_open: authentication failed
+
+#define STARGATE_NONCE_SIZE     16
+#define STARGATE_AEAD_OVERHEAD  32
+
+// stargate_t identifies a keystream created by stargate_new. 0 is never a
+// valid handle.
+typedef uintptr_t stargate_t;
+*/
+import "C"
+
+import (
+	"stargate/sg"
+	"sync"
+	"unsafe"
+)
+
+//go:generate go run ./internal/katgen -o test/kat_vectors.h
+
+// stream is a keystream behind a handle. closed is set by stargate_free,
+// for calls that looked the handle up before it was freed.
+type stream struct {
+	mu     sync.Mutex
+	w      *sg.Waver
+	closed bool
+}
+
+var (
+	streamsMu  sync.Mutex
+	streams    = map[C.stargate_t]*stream{}
+	nextHandle C.stargate_t
+)
+
+func lookup(h C.stargate_t) *stream {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	return streams[h]
+}
+
+// bytesOf returns the C buffer p of n bytes as a slice, or false for a NULL
+// pointer with a length.
+func bytesOf(p *C.uint8_t, n C.size_t) ([]byte, bool) {
+	if n == 0 {
+		return nil, true
+	}
+	if p == nil {
+		return nil, false
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), int(n)), true
+}
+
+func nonceOf(p *C.uint8_t) (sg.Nonce, bool) {
+	var n sg.Nonce
+	b, ok := bytesOf(p, sg.NonceSize)
+	if !ok {
+		return n, false
+	}
+	copy(n[:], b)
+	return n, true
+}
+
+// stargate_new starts the keystream of key and a STARGATE_NONCE_SIZE-byte
+// nonce. It returns 0 if key is empty or either pointer is NULL.
+//
+//export stargate_new
+func stargate_new(key *C.uint8_t, keyLen C.size_t, nonce *C.uint8_t) C.stargate_t {
+	kb, ok := bytesOf(key, keyLen)
+	if !ok || len(kb) == 0 {
+		return 0
+	}
+	n, ok := nonceOf(nonce)
+	if !ok {
+		return 0
+	}
+
+	k := sg.NewKey(kb)
+	defer k.Destroy()
+
+	w, err := sg.NewWaver(k, n, false)
+	if err != nil {
+		return 0
+	}
+
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	nextHandle++
+	streams[nextHandle] = &stream{w: w}
+	return nextHandle
+}
+
+// stargate_read writes the next len bytes of keystream to out.
+//
+//export stargate_read
+func stargate_read(h C.stargate_t, out *C.uint8_t, n C.size_t) C.int {
+	s := lookup(h)
+	dst, ok := bytesOf(out, n)
+	if s == nil || !ok {
+		return C.STARGATE_EINVAL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return C.STARGATE_EINVAL
+	}
+	s.w.Read(dst)
+	return C.STARGATE_OK
+}
+
+// stargate_xor XORs len bytes of src with the keystream into dst, which
+// encrypts and decrypts alike. dst and src may be the same buffer but must
+// not otherwise overlap.
+//
+//export stargate_xor
+func stargate_xor(h C.stargate_t, dst, src *C.uint8_t, n C.size_t) C.int {
+	s := lookup(h)
+	d, ok1 := bytesOf(dst, n)
+	in, ok2 := bytesOf(src, n)
+	if s == nil || !ok1 || !ok2 {
+		return C.STARGATE_EINVAL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return C.STARGATE_EINVAL
+	}
+	for i := range in {
+		d[i] = in[i] ^ s.w.GetNext()
+	}
+	return C.STARGATE_OK
+}
+
+// stargate_free wipes the stream state and invalidates the handle.
+//
+//export stargate_free
+func stargate_free(h C.stargate_t) C.int {
+	streamsMu.Lock()
+	s := streams[h]
+	delete(streams, h)
+	streamsMu.Unlock()
+
+	if s == nil {
+		return C.STARGATE_EINVAL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.w.Close()
+	return C.STARGATE_OK
+}
+
+// aeadOf returns the AEAD of the C key, or nil.
+func aeadOf(key *C.uint8_t, keyLen C.size_t) *sg.AEAD {
+	kb, ok := bytesOf(key, keyLen)
+	if !ok || len(kb) == 0 {
+		return nil
+	}
+
+	k := sg.NewKey(kb)
+	defer k.Destroy()
+
+	a, err := sg.NewAEAD(k)
+	if err != nil {
+		return nil
+	}
+	return a
+}
+
+// stargate_aead_seal encrypts and authenticates plaintext and
+// authenticates ad, writing plaintext_len + STARGATE_AEAD_OVERHEAD bytes
+// to out: the ciphertext followed by the tag. A nonce must never be used
+// twice with the same key.
+//
+//export stargate_aead_seal
+func stargate_aead_seal(key *C.uint8_t, keyLen C.size_t, nonce *C.uint8_t,
+	plaintext *C.uint8_t, plaintextLen C.size_t, ad *C.uint8_t, adLen C.size_t, out *C.uint8_t) C.int {
+	n, ok1 := nonceOf(nonce)
+	pt, ok2 := bytesOf(plaintext, plaintextLen)
+	adb, ok3 := bytesOf(ad, adLen)
+	dst, ok4 := bytesOf(out, plaintextLen+sg.AEADOverhead)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return C.STARGATE_EINVAL
+	}
+
+	a := aeadOf(key, keyLen)
+	if a == nil {
+		return C.STARGATE_EINVAL
+	}
+	defer a.Close()
+
+	a.Seal(dst[:0], n[:], pt, adb)
+	return C.STARGATE_OK
+}
+
+// stargate_aead_open checks and decrypts ciphertext_len bytes written by
+// stargate_aead_seal, writing ciphertext_len - STARGATE_AEAD_OVERHEAD bytes
+// of plaintext to out. It returns STARGATE_EAUTH, and writes nothing, if
+// the key, nonce, ciphertext or ad differ from those sealed.
+//
+//export stargate_aead_open
+func stargate_aead_open(key *C.uint8_t, keyLen C.size_t, nonce *C.uint8_t,
+	ciphertext *C.uint8_t, ciphertextLen C.size_t, ad *C.uint8_t, adLen C.size_t, out *C.uint8_t) C.int {
+	if ciphertextLen < sg.AEADOverhead {
+		return C.STARGATE_EINVAL
+	}
+	n, ok1 := nonceOf(nonce)
+	ct, ok2 := bytesOf(ciphertext, ciphertextLen)
+	adb, ok3 := bytesOf(ad, adLen)
+	dst, ok4 := bytesOf(out, ciphertextLen-sg.AEADOverhead)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return C.STARGATE_EINVAL
+	}
+
+	a := aeadOf(key, keyLen)
+	if a == nil {
+		return C.STARGATE_EINVAL
+	}
+	defer a.Close()
+
+	if _, err := a.Open(dst[:0], n[:], ct, adb); err != nil {
+		return C.STARGATE_EAUTH
+	}
+	return C.STARGATE_OK
+}
+
+func main() {}
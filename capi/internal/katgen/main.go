@@ -0,0 +1,96 @@
+// Command katgen writes the Go known-answer vectors as a C header for the
+// C tests of the capi library. Run it with go generate in capi.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"stargate/sg"
+	"strings"
+)
+
+func main() {
+	output := flag.String("o", "test/kat_vectors.h", "Header to write.")
+	flag.Parse()
+
+	var b bytes.Buffer
+	b.WriteString(`// Code generated by capi/internal/katgen from sg.KnownAnswers and
+// sg.AEADKnownAnswers. DO NOT EDIT.
+
+#include <stddef.h>
+#include <stdint.h>
+
+`)
+
+	// Legacy and XXH3 vectors use a nonce schedule and a mix the C API does
+	// not offer.
+	var streams []sg.KnownAnswer
+	for _, ka := range sg.KnownAnswers {
+		if !ka.Legacy && ka.Mix == sg.MixStarGate {
+			streams = append(streams, ka)
+		}
+	}
+	var aeads []sg.AEADKnownAnswer
+	for _, ka := range sg.AEADKnownAnswers {
+		if ka.Mix == sg.MixStarGate {
+			aeads = append(aeads, ka)
+		}
+	}
+
+	// The digests of sg.KnownAnswer cover the first 4096 bytes.
+	b.WriteString("#define KAT_STREAM_LEN 4096\n\n")
+	b.WriteString("struct kat_stream {\n\tconst char *key;\n\tuint8_t nonce[16];\n\tuint8_t prefix[32];\n\tuint8_t digest[32];\n};\n\n")
+	fmt.Fprintf(&b, "static const struct kat_stream kat_streams[%d] = {\n", len(streams))
+	for _, ka := range streams {
+		fmt.Fprintf(&b, "\t{\n\t\t%s,\n\t\t%s,\n\t\t%s,\n\t\t%s,\n\t},\n",
+			cString(ka.Key), cBytes(ka.Nonce, 2), cBytes(ka.Prefix, 2), cBytes(ka.Digest, 2))
+	}
+	b.WriteString("};\n\n")
+
+	b.WriteString("struct kat_aead {\n\tconst char *key;\n\tuint8_t nonce[16];\n\tconst char *plaintext;\n\tconst char *ad;\n\tsize_t sealed_len;\n\tconst uint8_t *sealed;\n};\n\n")
+	for i, ka := range aeads {
+		fmt.Fprintf(&b, "static const uint8_t kat_aead_sealed_%d[] = %s;\n", i, cBytes(ka.Sealed, 0))
+	}
+	fmt.Fprintf(&b, "\nstatic const struct kat_aead kat_aeads[%d] = {\n", len(aeads))
+	for i, ka := range aeads {
+		fmt.Fprintf(&b, "\t{\n\t\t%s,\n\t\t%s,\n\t\t%s,\n\t\t%s,\n\t\t%d,\n\t\tkat_aead_sealed_%d,\n\t},\n",
+			cString(ka.Key), cBytes(ka.Nonce, 2), cString(ka.Plaintext), cString(ka.AD), len(ka.Sealed)/2, i)
+	}
+	b.WriteString("};\n")
+
+	if err := os.WriteFile(*output, b.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// cString quotes s as a C string literal. The vectors are printable ASCII.
+func cString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// cBytes formats hex digits as a C array initializer, 12 bytes a line,
+// indented by indent tabs.
+func cBytes(h string, indent int) string {
+	raw, err := hex.DecodeString(h)
+	if err != nil {
+		log.Fatalf("bad hex %q: %v", h, err)
+	}
+
+	pad := strings.Repeat("\t", indent+1)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, c := range raw {
+		if i%12 == 0 {
+			b.WriteString("\n" + pad)
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "0x%02x,", c)
+	}
+	b.WriteString("\n" + strings.Repeat("\t", indent) + "}")
+	return b.String()
+}
@@ -0,0 +1,125 @@
+// Known-answer tests for the StarGate C API. The vectors in kat_vectors.h
+// are generated from the Go ones, so a library that passes here produces
+// the same keystream and AEAD output as the Go package.
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "libstargate.h"
+#include "kat_vectors.h"
+#include "sha256.h"
+
+static int failures;
+
+#define CHECK(cond, ...) do { \
+	if (!(cond)) { \
+		fprintf(stderr, "FAIL %s:%d: ", __FILE__, __LINE__); \
+		fprintf(stderr, __VA_ARGS__); \
+		fprintf(stderr, "\n"); \
+		failures++; \
+	} \
+} while (0)
+
+static void check_stream(const struct kat_stream *ka) {
+	uint8_t out[KAT_STREAM_LEN], sum[32];
+	uint8_t *plain = calloc(1, KAT_STREAM_LEN);
+	stargate_t s;
+	size_t i;
+
+	// Read the keystream in uneven pieces.
+	s = stargate_new((uint8_t *)ka->key, strlen(ka->key), (uint8_t *)ka->nonce);
+	CHECK(s != 0, "stargate_new(%s) failed", ka->key);
+	for (i = 0; i < KAT_STREAM_LEN; ) {
+		size_t n = i % 7 + 1;
+		if (n > KAT_STREAM_LEN - i) {
+			n = KAT_STREAM_LEN - i;
+		}
+		CHECK(stargate_read(s, out + i, n) == STARGATE_OK, "stargate_read failed");
+		i += n;
+	}
+	CHECK(stargate_free(s) == STARGATE_OK, "stargate_free failed");
+
+	CHECK(memcmp(out, ka->prefix, sizeof ka->prefix) == 0, "keystream prefix of %s differs", ka->key);
+	sha256(out, sizeof out, sum);
+	CHECK(memcmp(sum, ka->digest, sizeof sum) == 0, "keystream digest of %s differs", ka->key);
+
+	// XOR of zeros in place is the keystream too.
+	s = stargate_new((uint8_t *)ka->key, strlen(ka->key), (uint8_t *)ka->nonce);
+	CHECK(stargate_xor(s, plain, plain, KAT_STREAM_LEN) == STARGATE_OK, "stargate_xor failed");
+	CHECK(memcmp(plain, out, KAT_STREAM_LEN) == 0, "stargate_xor output of %s differs", ka->key);
+	stargate_free(s);
+
+	// A freed handle is refused, not used.
+	CHECK(stargate_read(s, out, 1) == STARGATE_EINVAL, "read after free accepted");
+	CHECK(stargate_free(s) == STARGATE_EINVAL, "double free accepted");
+
+	free(plain);
+}
+
+static void check_aead(const struct kat_aead *ka) {
+	size_t pt_len = strlen(ka->plaintext), ad_len = strlen(ka->ad);
+	uint8_t *key = (uint8_t *)ka->key;
+	size_t key_len = strlen(ka->key);
+	uint8_t *sealed = malloc(pt_len + STARGATE_AEAD_OVERHEAD);
+	uint8_t *opened = malloc(pt_len + 1);
+	int rc;
+
+	CHECK(ka->sealed_len == pt_len + STARGATE_AEAD_OVERHEAD, "vector length mismatch");
+
+	rc = stargate_aead_seal(key, key_len, (uint8_t *)ka->nonce,
+		(uint8_t *)ka->plaintext, pt_len, (uint8_t *)ka->ad, ad_len, sealed);
+	CHECK(rc == STARGATE_OK, "stargate_aead_seal returned %d", rc);
+	CHECK(memcmp(sealed, ka->sealed, ka->sealed_len) == 0, "sealed output of %zu bytes differs", pt_len);
+
+	rc = stargate_aead_open(key, key_len, (uint8_t *)ka->nonce,
+		(uint8_t *)ka->sealed, ka->sealed_len, (uint8_t *)ka->ad, ad_len, opened);
+	CHECK(rc == STARGATE_OK, "stargate_aead_open returned %d", rc);
+	CHECK(memcmp(opened, ka->plaintext, pt_len) == 0, "opened plaintext of %zu bytes differs", pt_len);
+
+	// A flipped bit anywhere, or other associated data, fails to open.
+	sealed[ka->sealed_len / 2] ^= 1;
+	rc = stargate_aead_open(key, key_len, (uint8_t *)ka->nonce,
+		sealed, ka->sealed_len, (uint8_t *)ka->ad, ad_len, opened);
+	CHECK(rc == STARGATE_EAUTH, "tampered ciphertext: got %d, want STARGATE_EAUTH", rc);
+	rc = stargate_aead_open(key, key_len, (uint8_t *)ka->nonce,
+		(uint8_t *)ka->sealed, ka->sealed_len, (uint8_t *)"other", 5, opened);
+	CHECK(rc == STARGATE_EAUTH, "other ad: got %d, want STARGATE_EAUTH", rc);
+
+	free(sealed);
+	free(opened);
+}
+
+static void check_args(void) {
+	uint8_t nonce[STARGATE_NONCE_SIZE] = {0}, buf[STARGATE_AEAD_OVERHEAD];
+
+	CHECK(stargate_new(NULL, 0, nonce) == 0, "empty key accepted");
+	CHECK(stargate_new((uint8_t *)"k", 1, NULL) == 0, "NULL nonce accepted");
+	CHECK(stargate_read(0, buf, 1) == STARGATE_EINVAL, "handle 0 accepted");
+	CHECK(stargate_aead_open((uint8_t *)"k", 1, nonce, buf, 10, NULL, 0, buf) == STARGATE_EINVAL,
+		"ciphertext shorter than the tag accepted");
+	CHECK(stargate_aead_seal((uint8_t *)"k", 1, nonce, NULL, 5, NULL, 0, buf) == STARGATE_EINVAL,
+		"NULL plaintext with a length accepted");
+	CHECK(stargate_aead_seal((uint8_t *)"k", 1, nonce, NULL, 0, NULL, 0, buf) == STARGATE_OK,
+		"empty plaintext refused");
+}
+
+int main(void) {
+	size_t i;
+
+	for (i = 0; i < sizeof kat_streams / sizeof kat_streams[0]; i++) {
+		check_stream(&kat_streams[i]);
+	}
+	for (i = 0; i < sizeof kat_aeads / sizeof kat_aeads[0]; i++) {
+		check_aead(&kat_aeads[i]);
+	}
+	check_args();
+
+	if (failures) {
+		fprintf(stderr, "%d checks failed\n", failures);
+		return 1;
+	}
+	printf("StarGate C API: %zu keystream and %zu AEAD known answers passed\n",
+		sizeof kat_streams / sizeof kat_streams[0], sizeof kat_aeads / sizeof kat_aeads[0]);
+	return 0;
+}
@@ -0,0 +1,137 @@
+// Code generated by capi/internal/katgen from sg.KnownAnswers and
+// sg.AEADKnownAnswers. DO NOT EDIT.
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define KAT_STREAM_LEN 4096
+
+struct kat_stream {
+	const char *key;
+	uint8_t nonce[16];
+	uint8_t prefix[32];
+	uint8_t digest[32];
+};
+
+static const struct kat_stream kat_streams[2] = {
+	{
+		"StarGate KAT key 1",
+		{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b,
+			0x0c, 0x0d, 0x0e, 0x0f,
+		},
+		{
+			0xfd, 0xfb, 0x17, 0x85, 0x48, 0x04, 0xf6, 0xee, 0x6c, 0x7e, 0x83, 0x4e,
+			0x25, 0xf7, 0xbb, 0xe5, 0xb5, 0xa4, 0x08, 0xdc, 0xa4, 0xc8, 0xdf, 0x6d,
+			0x89, 0x8b, 0x31, 0xbd, 0xd8, 0x54, 0x7a, 0x98,
+		},
+		{
+			0x44, 0x45, 0x00, 0xf4, 0x81, 0x36, 0x27, 0x23, 0x0e, 0xf5, 0x4a, 0x74,
+			0xb6, 0x74, 0x57, 0x22, 0x3f, 0xc4, 0xf6, 0x3c, 0xb0, 0x0f, 0x7f, 0xa0,
+			0xf7, 0x75, 0xa1, 0x9c, 0xba, 0x8c, 0x9a, 0x3d,
+		},
+	},
+	{
+		"StarGate KAT key 2",
+		{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff,
+		},
+		{
+			0x4b, 0x55, 0x8b, 0x3b, 0x3d, 0xd8, 0xc6, 0x2a, 0x6e, 0x17, 0x10, 0x7f,
+			0x8d, 0x21, 0x5f, 0x13, 0x75, 0x6f, 0xab, 0x81, 0xff, 0x5d, 0xc4, 0x0b,
+			0x6e, 0xe8, 0x3e, 0x75, 0xbc, 0x5d, 0xb7, 0x6e,
+		},
+		{
+			0xe6, 0xbd, 0x94, 0x8c, 0xcd, 0xe0, 0x03, 0x66, 0x3f, 0xda, 0x2e, 0xab,
+			0x97, 0x06, 0xf8, 0xb7, 0xa4, 0x9c, 0xc8, 0xa4, 0x2b, 0x48, 0x22, 0x6d,
+			0xb2, 0xd5, 0x4f, 0xf7, 0x89, 0x38, 0x86, 0x84,
+		},
+	},
+};
+
+struct kat_aead {
+	const char *key;
+	uint8_t nonce[16];
+	const char *plaintext;
+	const char *ad;
+	size_t sealed_len;
+	const uint8_t *sealed;
+};
+
+static const uint8_t kat_aead_sealed_0[] = {
+	0x65, 0x3f, 0x1d, 0xc4, 0xbe, 0x4f, 0xc1, 0x42, 0x24, 0x83, 0xb5, 0x40,
+	0x24, 0x26, 0x9e, 0x70, 0x99, 0xef, 0x10, 0xd7, 0x49, 0xdb, 0xe2, 0xb5,
+	0xa8, 0x94, 0x3e, 0x4d, 0xc0, 0xd4, 0x90, 0x94,
+};
+static const uint8_t kat_aead_sealed_1[] = {
+	0xf5, 0xbc, 0x6a, 0x2c, 0xa7, 0x19, 0xb2, 0xc1, 0x54, 0x09, 0xe7, 0x68,
+	0xc6, 0x0b, 0xe5, 0x49, 0x1c, 0xbd, 0x58, 0x1d, 0x02, 0x57, 0x65, 0x18,
+	0xed, 0xb7, 0xce, 0x29, 0x1a, 0x35, 0x87, 0x73, 0xe1, 0x39, 0x33, 0x17,
+	0x9c, 0xfa, 0x59, 0x78, 0xac, 0x23, 0xd4, 0xea, 0x95, 0x62, 0x99, 0x60,
+	0xa4, 0x28, 0x38, 0x72, 0x9e, 0x92, 0x47, 0xce, 0xea, 0x6a,
+};
+static const uint8_t kat_aead_sealed_2[] = {
+	0x54, 0xdf, 0xf9, 0x9b, 0xb3, 0x1c, 0x10, 0xc5, 0xa5, 0x16, 0x90, 0x40,
+	0x4a, 0xa2, 0xac, 0xb8, 0x49, 0xc8, 0x05, 0xc6, 0x59, 0x44, 0xf0, 0xcc,
+	0x72, 0x7a, 0x10, 0x6f, 0xa1, 0xfc, 0x8d, 0xa3, 0x25, 0x00, 0x95, 0xc2,
+	0x5a, 0xca, 0x90, 0x27, 0xfb, 0x16, 0x95, 0xf9, 0xb4, 0xa1, 0xdd, 0x77,
+	0xb9, 0x1e, 0x35, 0x9b, 0x30, 0x31, 0x45, 0x5b, 0x8b, 0x6e, 0xc5, 0xa3,
+	0x07, 0xa9, 0xce, 0x72, 0x47, 0x39, 0x29, 0x09, 0x3c, 0x2a, 0x8e, 0xd6,
+	0xca, 0x30, 0x54, 0x8b, 0x77, 0xac, 0xee, 0xb5, 0x35, 0x74, 0x4c, 0x13,
+	0x32, 0x38, 0x27, 0x6d, 0x38, 0xbf, 0xe4, 0xbf, 0xed, 0xf8, 0x12, 0xc4,
+	0x4a, 0xf0, 0x16, 0x3f, 0xf4, 0x45, 0xaf, 0xb2, 0xfc, 0xa0, 0x6e, 0x14,
+	0xd9, 0xdd, 0x78, 0x56, 0xaa, 0x6f, 0x48, 0x1b, 0xae, 0xb9, 0x31, 0x6c,
+	0x58, 0xa9, 0x84, 0x8c, 0xcf, 0x54, 0x30, 0x03, 0x47, 0xeb, 0xa7, 0xd9,
+	0xc4, 0x21, 0xf4, 0x7f, 0x4f, 0xa1, 0x0d, 0xfe, 0x9b, 0x6a, 0x76, 0x62,
+	0x42, 0xfb, 0x10, 0x50, 0x61, 0xe7, 0x21, 0x3c, 0x66, 0x8e, 0x32, 0xd1,
+	0x9f, 0x92, 0x6f, 0x20, 0xdc, 0x6b, 0x60, 0xc3, 0x1e, 0x0c, 0x30, 0x83,
+	0x38, 0x9c, 0x4f, 0x7e, 0xc0, 0xe0, 0xab, 0x16, 0x00, 0x3e, 0x0f, 0xdf,
+	0xed, 0x6e, 0xe5, 0x74, 0x08, 0x03, 0x68, 0xb4, 0xe6, 0xff, 0xf8, 0xb8,
+	0x05, 0x9d, 0xb6, 0x8e, 0xd0, 0x77, 0x58, 0x2a, 0x50, 0xc7, 0xe1, 0x2d,
+	0xd9, 0xbf, 0x55, 0xa2, 0x4d, 0x0a, 0x58, 0xe5, 0x8d, 0xfc, 0xe4, 0x30,
+	0xec, 0x58, 0x12, 0xdb, 0xb6, 0x8e, 0xd5, 0xca, 0xb8, 0xee, 0xdc, 0x02,
+	0x5b, 0x33, 0xea, 0xe6, 0x10, 0x89, 0x14, 0x48, 0xce, 0x01, 0x6e, 0xa2,
+	0xea, 0x47, 0x06, 0xb3, 0xff, 0xb8, 0xd2, 0x17, 0x3f, 0x77, 0x12, 0x08,
+	0xcf, 0xe4, 0x4a, 0x33, 0xe0, 0x0e, 0xd7, 0xeb, 0x8f, 0x35, 0x5b, 0x40,
+	0x45, 0xfa, 0x92, 0xa1, 0xc4, 0x9b, 0x17, 0xb7, 0x0c, 0xdd, 0xc7, 0xc6,
+	0x8b, 0x71, 0x38, 0xe1, 0xea, 0x38, 0xa5, 0xa8, 0xc1, 0xc3, 0xbc, 0x6c,
+	0xfa, 0x93, 0x46, 0x67, 0x63, 0x31, 0xe3, 0x53, 0x7a, 0x6f, 0x07, 0xf2,
+	0xeb, 0x5e, 0xd4, 0x35, 0x4f, 0xf6, 0x11, 0x99, 0x47, 0x76, 0x56, 0xf9,
+};
+
+static const struct kat_aead kat_aeads[3] = {
+	{
+		"StarGate AEAD key 1",
+		{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b,
+			0x0c, 0x0d, 0x0e, 0x0f,
+		},
+		"",
+		"header",
+		32,
+		kat_aead_sealed_0,
+	},
+	{
+		"StarGate AEAD key 1",
+		{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b,
+			0x0c, 0x0d, 0x0e, 0x0f,
+		},
+		"StarGate AEAD known answer",
+		"header",
+		58,
+		kat_aead_sealed_1,
+	},
+	{
+		"StarGate AEAD key 2",
+		{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff,
+		},
+		"StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. StarGate AEAD known answer. ",
+		"",
+		312,
+		kat_aead_sealed_2,
+	},
+};
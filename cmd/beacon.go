@@ -0,0 +1,267 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"stargate/sg"
+	"stargate/sg/beacon"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// beaconCmd represents the beacon command
+var beaconCmd = &cobra.Command{
+	Use:   "beacon",
+	Short: "Runs a randomness beacon of signed, chained pulses",
+	Long: `Runs a local randomness beacon for auditable lotteries and sampling.
+
+Every --interval the beacon emits a pulse: its index, a timestamp, 64 bytes
+of StarGate DRBG output and the SHA-512 hash of the previous pulse, signed
+with Ed25519. Pulses are appended to a JSON lines log, and can be served
+over HTTP and written to one file each. "beacon verify" checks a log
+against the public key printed by "beacon keygen".`,
+	Example: `stargate beacon keygen -o beacon.key
+  stargate beacon run --key beacon.key --log pulses.jsonl --interval 1m --http :8081
+  stargate beacon verify pulses.jsonl --public-key <hex>`,
+}
+
+var beaconKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generates an Ed25519 signing key and prints its public key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return fmt.Errorf("Failed to generate key: %w", err)
+		}
+		defer clear(priv)
+
+		if err := writeHexFile(output, priv.Seed()); err != nil {
+			return fmt.Errorf("Failed to write key: %w", err)
+		}
+		fmt.Println("Public key:", hex.EncodeToString(pub))
+		return nil
+	},
+}
+
+var beaconRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Emits pulses every --interval until interrupted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyPath, _ := cmd.Flags().GetString("key")
+		logPath, _ := cmd.Flags().GetString("log")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		count, _ := cmd.Flags().GetInt("count")
+		httpAddr, _ := cmd.Flags().GetString("http")
+		outDir, _ := cmd.Flags().GetString("out-dir")
+
+		seed, err := readHexFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("Failed to read key: %w", err)
+		}
+		if len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("Key must be %d bytes", ed25519.SeedSize)
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		clear(seed)
+		defer clear(key)
+		pub := key.Public().(ed25519.PublicKey)
+
+		pulses, err := beacon.OpenLog(logPath, pub)
+		if err != nil {
+			return fmt.Errorf("Failed to open log: %w", err)
+		}
+		defer pulses.Close()
+
+		drbg, err := sg.Instantiate([]byte("StarGate beacon"))
+		if err != nil {
+			return fmt.Errorf("Failed to instantiate DRBG: %w", err)
+		}
+		defer drbg.Uninstantiate()
+
+		if outDir != "" {
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				return err
+			}
+		}
+
+		if httpAddr != "" {
+			// Listen first so that a bad address fails the command, rather
+			// than the goroutine serving it.
+			l, err := net.Listen("tcp", httpAddr)
+			if err != nil {
+				return fmt.Errorf("HTTP server failed: %w", err)
+			}
+			srv := &http.Server{
+				Handler:           beacon.Handler(pulses, pub),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				if err := srv.Serve(l); err != http.ErrServerClosed {
+					log.Printf("HTTP server failed: %v", err)
+				}
+			}()
+			defer srv.Close()
+		}
+
+		log.Printf("Beacon %s: %d pulses in %s, next every %s", hex.EncodeToString(pub), pulses.Len(), logPath, interval)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		b := beacon.New(key, drbg, pulses)
+		err = b.Run(ctx, interval, count, func(p *beacon.Pulse) error {
+			log.Printf("Pulse %d: %s", p.Index, hex.EncodeToString(p.Output[:]))
+			if outDir == "" {
+				return nil
+			}
+			return writePulseFile(outDir, p)
+		})
+		if err != nil {
+			return fmt.Errorf("Beacon failed: %w", err)
+		}
+		return nil
+	},
+}
+
+// writePulseFile writes p to outDir/pulse-<index>.json.
+func writePulseFile(outDir string, p *beacon.Pulse) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := sg.CreateAtomic(filepath.Join(outDir, fmt.Sprintf("pulse-%d.json", p.Index)), 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+var beaconVerifyCmd = &cobra.Command{
+	Use:   "verify <log|dir|url>",
+	Short: "Checks signatures and links of a pulse chain",
+	Long: `Checks a pulse chain from pulse 0 on: every signature against --public-key,
+consecutive indexes, the hash link to the previous pulse, and timestamps
+that never go back.
+
+The chain is read from a JSON lines log, from a directory of
+pulse-<index>.json files written with --out-dir, or from the /pulses
+endpoint of a running beacon.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pubHex, _ := cmd.Flags().GetString("public-key")
+
+		pub, err := hex.DecodeString(pubHex)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return fmt.Errorf("--public-key must be %d hex bytes", ed25519.PublicKeySize)
+		}
+
+		last, err := verifyPulses(args[0], pub)
+		if err != nil {
+			return fmt.Errorf("Verification failed: %w", err)
+		}
+		if last == nil {
+			return errors.New("No pulses found")
+		}
+		log.Printf("Chain of %d pulses is valid, last at %s", last.Index+1, last.Timestamp.Format(time.RFC3339))
+		return nil
+	},
+}
+
+func verifyPulses(src string, pub ed25519.PublicKey) (*beacon.Pulse, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := http.Get(strings.TrimSuffix(src, "/") + "/pulses")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", resp.Request.URL, resp.Status)
+		}
+		return beacon.Verify(resp.Body, pub)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return beacon.Verify(f, pub)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(src, "pulse-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pulses []*beacon.Pulse
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p := new(beacon.Pulse)
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pulses = append(pulses, p)
+	}
+	sort.Slice(pulses, func(i, j int) bool { return pulses[i].Index < pulses[j].Index })
+
+	v := beacon.NewVerifier(pub)
+	for _, p := range pulses {
+		if err := v.Check(p); err != nil {
+			return v.Last(), err
+		}
+	}
+	return v.Last(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(beaconCmd)
+	beaconCmd.AddCommand(beaconKeygenCmd, beaconRunCmd, beaconVerifyCmd)
+
+	beaconKeygenCmd.Flags().StringP("output", "o", "", "File to write the signing key to.")
+	_ = beaconKeygenCmd.MarkFlagRequired("output")
+
+	beaconRunCmd.Flags().String("key", "", "Signing key file from \"beacon keygen\".")
+	beaconRunCmd.Flags().String("log", "", "Append-only pulse log. Created if missing, verified if not.")
+	beaconRunCmd.Flags().Duration("interval", time.Minute, "Time between pulses. Pulses fall on multiples of it.")
+	beaconRunCmd.Flags().Int("count", 0, "Stop after this many pulses. 0 runs until interrupted.")
+	beaconRunCmd.Flags().String("http", "", "Address to serve /pulse/latest, /pulse/{index}, /pulses and /public-key on.")
+	beaconRunCmd.Flags().String("out-dir", "", "Also write every pulse to <dir>/pulse-<index>.json.")
+	_ = beaconRunCmd.MarkFlagRequired("key")
+	_ = beaconRunCmd.MarkFlagRequired("log")
+
+	beaconVerifyCmd.Flags().String("public-key", "", "Beacon public key in hex.")
+	_ = beaconVerifyCmd.MarkFlagRequired("public-key")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"stargate/sg/bench"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measures StarGate throughput on this machine",
+	Long: `Runs the StarGate benchmark suite and reports throughput (MB/s),
+nanoseconds and cycles per byte and allocations per operation. ChaCha20 and
+AES-256-CTR run through the same harness as baselines.
+
+Cycles per byte are derived from the CPU clock, read from /proc/cpuinfo or
+given with --ghz. With frequency scaling they are an estimate.
+
+Hot paths are expected not to allocate; the command fails if one does.`,
+	Example: `stargate bench
+  stargate bench --run 'Read|ChaCha20|AES' --benchtime 3s
+  stargate bench --ghz 3.5`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern, _ := cmd.Flags().GetString("run")
+		benchtime, _ := cmd.Flags().GetString("benchtime")
+		ghz, _ := cmd.Flags().GetFloat64("ghz")
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("Bad --run pattern: %w", err)
+		}
+
+		bt, err := bench.ParseBenchtime(benchtime)
+		if err != nil {
+			return fmt.Errorf("Bad --benchtime: %w", err)
+		}
+
+		if ghz == 0 {
+			ghz = cpuGHz()
+		}
+
+		fmt.Printf("%s/%s, %d CPUs", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+		if ghz > 0 {
+			fmt.Printf(", %.2f GHz", ghz)
+		}
+		fmt.Println()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "benchmark\tns/op\tMB/s\tns/B\tcycles/B\tallocs/op\tB/op\t")
+
+		var failed []string
+		for _, c := range bench.Suite {
+			if !re.MatchString(c.Name) {
+				continue
+			}
+
+			r, err := bench.Run(c, bt)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s did not run: %v", c.Name, err))
+				continue
+			}
+
+			name := c.Name
+			if c.Baseline {
+				name += " (baseline)"
+			}
+
+			nsPerOp := r.NsPerOp()
+			mbs, nsb, cpb := "-", "-", "-"
+			if r.Bytes > 0 {
+				perByte := nsPerOp / float64(r.Bytes)
+				mbs = fmt.Sprintf("%.2f", r.MBPerSec())
+				nsb = fmt.Sprintf("%.3f", perByte)
+				if ghz > 0 {
+					cpb = fmt.Sprintf("%.2f", perByte*ghz)
+				}
+			}
+
+			fmt.Fprintf(tw, "%s\t%.1f\t%s\t%s\t%s\t%d\t%d\t\n", name, nsPerOp, mbs, nsb, cpb, r.AllocsPerOp(), r.AllocedBytesPerOp())
+
+			if c.ZeroAlloc && r.AllocsPerOp() != 0 {
+				failed = append(failed, fmt.Sprintf("%s allocates %d times per op", c.Name, r.AllocsPerOp()))
+			}
+		}
+		tw.Flush()
+
+		if len(failed) > 0 {
+			return fmt.Errorf("Benchmark check failed: %s", strings.Join(failed, "; "))
+		}
+		return nil
+	},
+}
+
+// cpuGHz reads the current clock of the first CPU from /proc/cpuinfo. It
+// returns 0 where that is not available.
+func cpuGHz() float64 {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, val, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(name) != "cpu MHz" {
+			continue
+		}
+
+		mhz, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0
+		}
+		return mhz / 1000
+	}
+
+	return 0
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().String("run", ".", "Regular expression selecting benchmarks by name.")
+	benchCmd.Flags().String("benchtime", "1s", "Run time per benchmark, or an iteration count like 1000x.")
+	benchCmd.Flags().Float64("ghz", 0, "CPU clock in GHz for cycles/byte. Read from /proc/cpuinfo if omitted.")
+}
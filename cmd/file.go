@@ -4,7 +4,10 @@ Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"stargate/sg"
 
 	"github.com/spf13/cobra"
@@ -19,41 +22,97 @@ var fileCmd = &cobra.Command{
 - Default: encryption.
 - Use --decrypt to decrypt.
 - Key: 512-byte string (512 chars). Random if omitted.
-- Nonce: 16-byte string (16 chars). Random if omitted.
-- Output: [nonce(16)] + [ciphertext]
+- Use --key-name to take the key from the keyring instead. Decrypting
+  without any key looks the container's key ID up in the keyring.
+- The key ID and a key commitment are stored in the header, so decrypting
+  with a wrong key fails before any output is written. Repeat --key on
+  decrypt to let the key ID pick the right one.
+- Nonce: 16 bytes as 32 hex digits (16 characters also accepted). Random if omitted.
+- Use --counter with --nonce for sequential files, and --nonce-registry to
+  refuse ever reusing a nonce with the same key.
+- Use --compress to compress before encryption. The algorithm is stored in
+  the header and undone automatically on decrypt.
+- Output: [container header with nonce] + [ciphertext]
+- Output is written to a temporary file and renamed into place only once
+  it is complete. Existing files are not overwritten without --force.
+- Use --in-place to replace the input file with the result.
 
 Examples:
   stargate file input.txt -o out.sg
+  stargate file input.txt -o out.sg --compress gzip:best
   stargate file out.sg -o input.txt -d -k <512-byte-string>
+  stargate file secrets.txt --in-place -k <512-byte-string>
+  stargate file input.txt -o out.sg --key-name backup
+  stargate file out.sg -o input.txt -d
 `,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if len(args) != 1 {
-			log.Fatal("A single file path is required")
+			return errors.New("A single file path is required")
 		}
 
 		inputPath := args[0]
 		outputPath, _ := cmd.Flags().GetString("output")
-		keyStr, _ := cmd.Flags().GetString("key")
-		nonceStr, _ := cmd.Flags().GetString("nonce")
 		decryptMode, _ := cmd.Flags().GetBool("decrypt")
+		compressStr, _ := cmd.Flags().GetString("compress")
+		force, _ := cmd.Flags().GetBool("force")
+		inPlace, _ := cmd.Flags().GetBool("in-place")
 
-		cipher, err := sg.NewCipher(keyStr, nonceStr, false)
+		if inPlace {
+			if cmd.Flags().Changed("output") {
+				return errors.New("--in-place and --output are mutually exclusive")
+			}
+			outputPath = inputPath
+		}
+
+		if err := checkOutputPath(inputPath, outputPath, force, inPlace); err != nil {
+			return err
+		}
+
+		compression, level, err := sg.ParseCompression(compressStr)
 		if err != nil {
-			log.Fatalf("Failed to initialize cipher: %v", err)
+			return err
 		}
 
 		if decryptMode {
-			if err := cipher.DecryptFile(inputPath, outputPath); err != nil {
-				log.Fatalf("Processing failed: %v", err)
+			keys, err := containerKeys(cmd, inputPath)
+			if err != nil {
+				return err
 			}
-		} else {
-			if err := cipher.EncryptFile(inputPath, outputPath); err != nil {
-				log.Fatalf("Processing failed: %v", err)
+			defer destroyKeys(keys)
+
+			if err := decryptFile(cmd, inputPath, outputPath, keys); err != nil {
+				return fmt.Errorf("Processing failed: %w", err)
 			}
+
+			log.Printf("File processed successfully → %s", outputPath)
+			return nil
+		}
+
+		key, err := cipherKey(cmd, true)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		nonce, err := encryptionNonce(cmd, key)
+		if err != nil {
+			return err
+		}
+		cipher, err := sg.NewCipher(key, nonce, false, outputOptions(cmd, "encrypting")...)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize cipher: %w", err)
+		}
+		defer cipher.Close()
+		cipher.Compression = compression
+		cipher.CompressionLevel = level
+
+		if err := cipher.EncryptFile(inputPath, outputPath); err != nil {
+			return fmt.Errorf("Processing failed: %w", err)
 		}
 
-		log.Printf("File processed successfully → %s", outputPath)
+		log.Printf("File processed successfully → %s (key ID %s)", outputPath, key.ID())
+		return nil
 	},
 }
 
@@ -61,9 +120,77 @@ func init() {
 	rootCmd.AddCommand(fileCmd)
 
 	fileCmd.Flags().StringP("output", "o", "stargate_output", "Output file path.")
-	fileCmd.Flags().StringP("key", "k", "", "512-byte key as string (512 chars). If empty — random key is generated.")
-	fileCmd.Flags().StringP("nonce", "n", "", "16-byte nonce as string (16 chars). If empty — random nonce is generated.")
+	fileCmd.Flags().StringArrayP("key", "k", nil, "512-byte key as string (512 chars). If empty — random key is generated. On decrypt it may be repeated, the key is chosen by the key ID in the header.")
+	fileCmd.Flags().String("key-name", "", "Name of a key in the keyring.")
+	addNonceFlags(fileCmd)
 	fileCmd.Flags().BoolP("decrypt", "d", false, "Decrypt mode (default: encrypt).")
+	fileCmd.Flags().BoolP("force", "f", false, "Overwrite the output file if it exists.")
+	fileCmd.Flags().Bool("in-place", false, "Replace the input file with the result via a temporary file and an atomic rename.")
+	fileCmd.Flags().String("compress", "none", "Compress before encryption: none, gzip or flate, optionally with :level (1-9, fastest, fast, default, better, best).")
 
 	_ = fileCmd.MarkFlagFilename("output")
 }
+
+// decryptFile decrypts with the only key given, which also works for legacy
+// headerless files, or picks among several by the key ID in the header.
+func decryptFile(cmd *cobra.Command, inputPath, outputPath string, keys []*sg.Key) error {
+	opts := outputOptions(cmd, "decrypting")
+
+	if len(keys) > 1 {
+		key, err := sg.DecryptFileWithKeys(inputPath, outputPath, keys, opts...)
+		if err == nil {
+			log.Printf("Decrypted with key ID %s", key.ID())
+		}
+		return err
+	}
+
+	cipher, err := sg.NewCipher(keys[0], sg.Nonce{}, false, opts...)
+	if err != nil {
+		return err
+	}
+	defer cipher.Close()
+
+	return cipher.DecryptFile(inputPath, outputPath)
+}
+
+func destroyKeys(keys []*sg.Key) {
+	for _, k := range keys {
+		k.Destroy()
+	}
+}
+
+// outputOptions reports progress as description and, without --force or
+// --in-place, keeps the output from replacing a file created meanwhile.
+func outputOptions(cmd *cobra.Command, description string) []sg.Option {
+	opts := []sg.Option{progressOption(cmd, description)}
+
+	force, _ := cmd.Flags().GetBool("force")
+	inPlace, _ := cmd.Flags().GetBool("in-place")
+	if !force && !inPlace {
+		opts = append(opts, sg.WithNoReplace())
+	}
+	return opts
+}
+
+// checkOutputPath refuses to clobber existing files unless asked to, and
+// catches input and output naming the same file, which is only allowed as
+// an explicit in-place operation. It fails early, before any work is done;
+// the output is still only put in place if it does not exist by then, see
+// sg.WithNoReplace.
+func checkOutputPath(inputPath, outputPath string, force, inPlace bool) error {
+	if inPlace {
+		return nil
+	}
+
+	if sg.SameFile(inputPath, outputPath) {
+		return fmt.Errorf("input and output are the same file %q, use --in-place to replace it", outputPath)
+	}
+
+	if !force {
+		if _, err := os.Lstat(outputPath); err == nil {
+			return fmt.Errorf("output file %q already exists, use --force to overwrite it", outputPath)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"stargate/sg"
+	"stargate/sg/analysis"
+
+	"github.com/spf13/cobra"
+)
+
+// hashCmd represents the hash command
+var hashCmd = &cobra.Command{
+	Use:   "hash [file]",
+	Short: "EXPERIMENTAL: hashes a file or stdin with the StarGate sponge",
+	Long: `Hashes a file, or stdin if no file or "-" is given, with the experimental
+StarGate sponge hash and prints the digest as hex. --size sets the output
+length in bytes; any length can be requested.
+
+The hash exists to study the StarGate permutation. It has had no
+cryptanalysis and must not be relied on.`,
+	Example: `stargate hash paper.pdf
+  stargate hash --size 64 < paper.pdf
+  stargate hash analyze --bits 20 --samples 4000000
+  stargate hash avalanche --len 64 --samples 200`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("At most one file is accepted")
+		}
+		size, _ := cmd.Flags().GetInt("size")
+
+		var in io.Reader = os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to open input: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		h, err := sg.NewHash(size)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(h, in); err != nil {
+			return fmt.Errorf("Failed to read input: %w", err)
+		}
+
+		fmt.Println(hex.EncodeToString(h.Sum(nil)))
+		return nil
+	},
+}
+
+var hashAnalyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Checks uniformity and collisions of truncated digests",
+	Long: `Hashes the counters 0..samples-1 and checks the digests truncated to
+--bits for uniformity (chi-square), the number of colliding pairs against
+the birthday bound, and every digest bit for bias. Exits with status 1 if a
+statistic is off by more than 5 standard deviations.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		samples, _ := cmd.Flags().GetInt("samples")
+		bits, _ := cmd.Flags().GetInt("bits")
+		size, _ := cmd.Flags().GetInt("size")
+
+		h, err := sg.NewHash(size)
+		if err != nil {
+			return err
+		}
+
+		out := make([]byte, 0, size)
+		r, err := analysis.Outputs(func(msg []byte) []byte {
+			h.Reset()
+			h.Write(msg)
+			return h.Sum(out[:0])
+		}, samples, bits)
+		if err != nil {
+			return err
+		}
+
+		return printOutputReport(r)
+	},
+}
+
+var hashAvalancheCmd = &cobra.Command{
+	Use:   "avalanche",
+	Short: "Measures how single input bit flips spread through the digest",
+	Long: `Flips every bit of --samples pseudorandom messages of --len bytes one at
+a time and reports the average fraction of digest bits that change, its
+range over input bit positions, and the worst deviation from the strict
+avalanche criterion. Messages come from a StarGate stream keyed with --seed,
+so runs are reproducible. Exits with status 1 on anomalies.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		samples, _ := cmd.Flags().GetInt("samples")
+		msgLen, _ := cmd.Flags().GetInt("len")
+		size, _ := cmd.Flags().GetInt("size")
+		seed, _ := cmd.Flags().GetString("seed")
+
+		h, err := sg.NewHash(size)
+		if err != nil {
+			return err
+		}
+
+		seedKey := sg.KeyFromString(seed)
+		defer seedKey.Destroy()
+
+		gen, err := sg.NewWaver(seedKey, sg.Nonce{}, false)
+		if err != nil {
+			return err
+		}
+		defer gen.Close()
+
+		out := make([]byte, 0, size)
+		r, err := analysis.Avalanche(func(msg []byte) []byte {
+			h.Reset()
+			h.Write(msg)
+			return h.Sum(out[:0])
+		}, msgLen, samples, func(msg []byte) { gen.Read(msg) })
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Samples:        %d messages of %d bits\n", r.Samples, r.InputBits)
+		fmt.Printf("Output:         %d bits\n", r.OutputBits)
+		fmt.Printf("Mean flipped:   %.4f (ideal 0.5)\n", r.Mean)
+		fmt.Printf("Per input bit:  %.4f - %.4f, worst at bit %d\n", r.MinMean, r.MaxMean, r.WorstInputBit)
+		fmt.Printf("Max SAC dev.:   z = %.2f\n", r.MaxSACZ)
+
+		issues := r.Suspicious()
+		if len(issues) == 0 {
+			fmt.Println("No anomalies found")
+			return nil
+		}
+
+		for _, s := range issues {
+			fmt.Println("SUSPICIOUS:", s)
+		}
+		return errReported
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hashCmd)
+	hashCmd.AddCommand(hashAnalyzeCmd, hashAvalancheCmd)
+
+	for _, c := range []*cobra.Command{hashCmd, hashAnalyzeCmd, hashAvalancheCmd} {
+		c.Flags().Int("size", 32, "Digest size in bytes.")
+	}
+
+	hashAnalyzeCmd.Flags().IntP("samples", "s", 1<<18, "Number of messages to hash.")
+	hashAnalyzeCmd.Flags().Int("bits", 16, fmt.Sprintf("Truncated digest size in bits, at most %d.", analysis.MaxBits))
+
+	hashAvalancheCmd.Flags().IntP("samples", "s", 100, "Number of base messages.")
+	hashAvalancheCmd.Flags().Int("len", 64, "Message length in bytes.")
+	hashAvalancheCmd.Flags().String("seed", "stargate avalanche", "Seed for the message generator.")
+}
@@ -0,0 +1,207 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"stargate/sg"
+
+	"github.com/spf13/cobra"
+)
+
+// cipherKey returns the key given with --key or, by name, from the keyring
+// with --key-name. With generate set, neither flag yields a fresh random key
+// that is printed once, as it cannot be recovered later. With --mlock the
+// key is kept in locked memory.
+func cipherKey(cmd *cobra.Command, generate bool) (*sg.Key, error) {
+	keyStrs := keyFlagValues(cmd)
+	key, err := keyringKey(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if len(keyStrs) > 0 {
+			key.Destroy()
+			return nil, errors.New("--key and --key-name are mutually exclusive")
+		}
+		return lockKey(cmd, key)
+	}
+
+	if len(keyStrs) > 1 {
+		return nil, errors.New("Only one --key can be used here")
+	}
+
+	keyStr := ""
+	if len(keyStrs) == 1 {
+		keyStr = keyStrs[0]
+	}
+
+	if keyStr == "" {
+		if !generate {
+			return nil, errors.New("A key is required, pass it with --key")
+		}
+
+		k, err := sg.GenKey256()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate key: %w", err)
+		}
+		fmt.Println("Key:", string(k.Bytes()))
+		key = k
+	} else {
+		key = sg.KeyFromString(keyStr)
+	}
+
+	return lockKey(cmd, key)
+}
+
+// cipherKeys returns every key given with --key, plus the one named with
+// --key-name, for commands that pick the right one by the key ID stored in
+// a container.
+func cipherKeys(cmd *cobra.Command) ([]*sg.Key, error) {
+	keyStrs := keyFlagValues(cmd)
+	named, err := keyringKey(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyStrs) == 0 && named == nil {
+		return nil, errors.New("A key is required, pass it with --key or --key-name")
+	}
+
+	keys := make([]*sg.Key, 0, len(keyStrs)+1)
+	for _, s := range keyStrs {
+		key, err := lockKey(cmd, sg.KeyFromString(s))
+		if err != nil {
+			destroyKeys(keys)
+			if named != nil {
+				named.Destroy()
+			}
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if named != nil {
+		key, err := lockKey(cmd, named)
+		if err != nil {
+			destroyKeys(keys)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func keyFlagValues(cmd *cobra.Command) []string {
+	if f := cmd.Flags().Lookup("key"); f != nil && f.Value.Type() == "stringArray" {
+		vals, _ := cmd.Flags().GetStringArray("key")
+		return vals
+	}
+
+	val, _ := cmd.Flags().GetString("key")
+	if val == "" {
+		return nil
+	}
+	return []string{val}
+}
+
+// lockKey moves key into locked memory when --mlock is set. key is
+// destroyed either way once it has been copied.
+func lockKey(cmd *cobra.Command, key *sg.Key) (*sg.Key, error) {
+	lock, _ := cmd.Flags().GetBool("mlock")
+	if !lock {
+		return key, nil
+	}
+
+	locked, err := sg.NewLockedKey(key.Bytes())
+	key.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock key in memory: %w", err)
+	}
+	return locked, nil
+}
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manages StarGate keys",
+}
+
+var keyIDCmd = &cobra.Command{
+	Use:   "id [container]",
+	Short: "Prints the public key ID of a key or of a container",
+	Long: `Prints the short public key ID (fingerprint) of the key given with --key,
+or, given a container file, the key ID recorded in its header. The key ID
+identifies a key without revealing anything about it.`,
+	Example: `stargate key id -k <key>
+  stargate key id secret.sg`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("At most one container path is accepted")
+		}
+
+		if len(args) == 1 {
+			h, err := sg.ReadFileHeader(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to read header: %w", err)
+			}
+			if h.KeyID == nil {
+				return errors.New("Container has no key ID")
+			}
+			fmt.Println(h.KeyID)
+			return nil
+		}
+
+		key, err := cipherKey(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		fmt.Println(key.ID())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(keyIDCmd)
+
+	keyIDCmd.Flags().StringP("key", "k", "", "512-byte key as string (512 chars).")
+}
+
+// readHexFile reads a private key file holding hex digits, as written by
+// the keygen commands.
+func readHexFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+
+	data = bytes.TrimSpace(data)
+	b := make([]byte, hex.DecodedLen(len(data)))
+	if _, err := hex.Decode(b, data); err != nil {
+		clear(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeHexFile writes a private key as hex to a new file only the owner
+// can read.
+func writeHexFile(path string, b []byte) error {
+	f, err := sg.CreateAtomic(path, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(b)); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,367 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"stargate/sg"
+	"stargate/sg/keyring"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const passphraseEnv = "STARGATE_PASSPHRASE"
+
+func keyringPath(cmd *cobra.Command) (string, error) {
+	path, _ := cmd.Flags().GetString("keyring")
+	if path != "" {
+		return path, nil
+	}
+
+	path, err := keyring.DefaultPath()
+	if err != nil {
+		return "", fmt.Errorf("Failed to locate keyring: %w", err)
+	}
+	return path, nil
+}
+
+// readPassphrase takes the master passphrase from $STARGATE_PASSPHRASE or
+// prompts for it on the terminal. A new keyring asks twice.
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if env, ok := os.LookupEnv(passphraseEnv); ok {
+		return []byte(env), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("No terminal to ask for the passphrase, set $%s", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read passphrase: %w", err)
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		defer clear(again)
+		if err != nil {
+			clear(pass)
+			return nil, fmt.Errorf("Failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(pass, again) {
+			clear(pass)
+			return nil, errors.New("Passphrases do not match")
+		}
+	}
+
+	return pass, nil
+}
+
+// openKeyring opens the keyring. A missing one is created if create is
+// set, for commands that add keys; any other command fails without it.
+func openKeyring(cmd *cobra.Command, create bool) (*keyring.Keyring, error) {
+	path, err := keyringPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var pass []byte
+	switch {
+	case keyring.Exists(path):
+		pass, err = readPassphrase("Keyring passphrase: ", false)
+	case create:
+		pass, err = readPassphrase("New keyring passphrase: ", true)
+	default:
+		return nil, fmt.Errorf("No keyring at %s, add a key with stargate key add first", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer clear(pass)
+
+	kr, err := keyring.Open(path, pass)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open keyring %s: %w", path, err)
+	}
+	return kr, nil
+}
+
+// keyringKey returns the key named by --key-name, or nil when the flag is
+// not set or not defined for the command.
+func keyringKey(cmd *cobra.Command) (*sg.Key, error) {
+	return keyringKeyFlag(cmd, "key-name")
+}
+
+func keyringKeyFlag(cmd *cobra.Command, flag string) (*sg.Key, error) {
+	if cmd.Flags().Lookup(flag) == nil {
+		return nil, nil
+	}
+
+	name, _ := cmd.Flags().GetString(flag)
+	if name == "" {
+		return nil, nil
+	}
+
+	kr, err := openKeyring(cmd, false)
+	if err != nil {
+		return nil, err
+	}
+	defer kr.Close()
+
+	key, err := kr.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("Key %q: %w", name, err)
+	}
+	return key, nil
+}
+
+// keyringKeyByID finds the key a container was written with.
+func keyringKeyByID(cmd *cobra.Command, id sg.KeyID) (*sg.Key, error) {
+	kr, err := openKeyring(cmd, false)
+	if err != nil {
+		return nil, err
+	}
+	defer kr.Close()
+
+	name, key, err := kr.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("No key with ID %s in keyring: %w", id, err)
+	}
+
+	log.Printf("Using key %q from keyring", name)
+	return key, nil
+}
+
+var keyAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Adds a key to the keyring, generating one unless --key is given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("A single key name is required")
+		}
+
+		note, _ := cmd.Flags().GetString("note")
+		keyStr, _ := cmd.Flags().GetString("key")
+
+		var key *sg.Key
+		if keyStr == "" {
+			k, err := sg.GenKey256()
+			if err != nil {
+				return fmt.Errorf("Failed to generate key: %w", err)
+			}
+			key = k
+		} else {
+			key = sg.KeyFromString(keyStr)
+		}
+		defer key.Destroy()
+
+		return addToKeyring(cmd, args[0], key, note)
+	},
+}
+
+var keyImportCmd = &cobra.Command{
+	Use:   "import <name> [file]",
+	Short: "Adds a key read from a file or stdin to the keyring",
+	Long: `Adds a key read from a file, or from stdin if no file or "-" is given.
+A single trailing newline is stripped. Reading the key from a file keeps it
+out of shell history and the process list.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("A key name and an optional file are required")
+		}
+
+		note, _ := cmd.Flags().GetString("note")
+
+		var in io.Reader = os.Stdin
+		if len(args) == 2 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to open key file: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		raw, err := io.ReadAll(in)
+		defer clear(raw)
+		if err != nil {
+			return fmt.Errorf("Failed to read key: %w", err)
+		}
+
+		raw = bytes.TrimSuffix(raw, []byte("\n"))
+		raw = bytes.TrimSuffix(raw, []byte("\r"))
+		if len(raw) == 0 {
+			return sg.ErrEmptyKey
+		}
+
+		key := sg.NewKey(raw)
+		defer key.Destroy()
+
+		return addToKeyring(cmd, args[0], key, note)
+	},
+}
+
+func addToKeyring(cmd *cobra.Command, name string, key *sg.Key, note string) error {
+	kr, err := openKeyring(cmd, true)
+	if err != nil {
+		return err
+	}
+	defer kr.Close()
+
+	if err := kr.Add(name, key, note); err != nil {
+		return fmt.Errorf("Failed to add key %q: %w", name, err)
+	}
+	if err := kr.Save(); err != nil {
+		return fmt.Errorf("Failed to save keyring: %w", err)
+	}
+
+	log.Printf("Key %q added (key ID %s)", name, key.ID())
+	return nil
+}
+
+var keyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the keys in the keyring",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kr, err := openKeyring(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer kr.Close()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tKEY ID\tCREATED\tNOTE")
+		for _, e := range kr.Entries() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Name, e.ID, e.Created.Format("2006-01-02 15:04"), e.Note)
+		}
+		return tw.Flush()
+	},
+}
+
+var keyRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Removes a key from the keyring",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("A single key name is required")
+		}
+
+		kr, err := openKeyring(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer kr.Close()
+
+		if err := kr.Remove(args[0]); err != nil {
+			return fmt.Errorf("Failed to remove key %q: %w", args[0], err)
+		}
+		if err := kr.Save(); err != nil {
+			return fmt.Errorf("Failed to save keyring: %w", err)
+		}
+
+		log.Printf("Key %q removed", args[0])
+		return nil
+	},
+}
+
+var keyExportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Writes a key from the keyring to a file or stdout",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("A single key name is required")
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+
+		kr, err := openKeyring(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer kr.Close()
+
+		key, err := kr.Get(args[0])
+		if err != nil {
+			return fmt.Errorf("Key %q: %w", args[0], err)
+		}
+		defer key.Destroy()
+
+		if output == "" || output == "-" {
+			os.Stdout.Write(key.Bytes())
+			fmt.Println()
+			return nil
+		}
+
+		f, err := sg.CreateAtomic(output, 0o600)
+		if err != nil {
+			return fmt.Errorf("Failed to create output: %w", err)
+		}
+		defer f.Abort()
+
+		if _, err = f.Write(key.Bytes()); err == nil {
+			err = f.Commit()
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to write key: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	keyCmd.AddCommand(keyAddCmd, keyImportCmd, keyListCmd, keyRemoveCmd, keyExportCmd)
+
+	rootCmd.PersistentFlags().String("keyring", "",
+		"Keyring file (default $XDG_CONFIG_HOME/stargate/keyring). The passphrase is read from $"+passphraseEnv+" or prompted for.")
+
+	keyAddCmd.Flags().StringP("key", "k", "", "Key to store. If empty — random key is generated.")
+	for _, c := range []*cobra.Command{keyAddCmd, keyImportCmd} {
+		c.Flags().String("note", "", "Free-form note stored with the key.")
+	}
+	keyExportCmd.Flags().StringP("output", "o", "", "Output file (default stdout).")
+}
+
+// headerKeyID reads the key ID from a container, for keyring lookups.
+func headerKeyID(path string) (sg.KeyID, error) {
+	h, err := sg.ReadFileHeader(path)
+	if err != nil {
+		return sg.KeyID{}, err
+	}
+	if h.KeyID == nil {
+		return sg.KeyID{}, errors.New("container has no key ID, pass the key with --key")
+	}
+	return *h.KeyID, nil
+}
+
+// containerKeys returns the keys given with --key or --key-name, or else
+// the keyring key named by the container's key ID.
+func containerKeys(cmd *cobra.Command, path string) ([]*sg.Key, error) {
+	if len(keyFlagValues(cmd)) > 0 || cmd.Flags().Changed("key-name") {
+		return cipherKeys(cmd)
+	}
+	id, err := headerKeyID(path)
+	if err != nil {
+		return nil, fmt.Errorf("A key is required, pass it with --key or --key-name: %w", err)
+	}
+	key, err := keyringKeyByID(cmd, id)
+	if err != nil {
+		return nil, err
+	}
+	if key, err = lockKey(cmd, key); err != nil {
+		return nil, err
+	}
+	return []*sg.Key{key}, nil
+}
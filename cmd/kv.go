@@ -0,0 +1,248 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"stargate/sg"
+	"stargate/sg/kv"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// kvCmd represents the kv command
+var kvCmd = &cobra.Command{
+	Use:   "kv",
+	Short: "Inspects and edits encrypted key-value store files",
+	Long: `Inspects and edits the single-file encrypted key-value stores of package
+sg/kv. Every put and delete is an encrypted, chained record appended to
+the file; "kv compact" rewrites it with the live records only.
+
+Without --key or --key-name the keyring key with the store's key ID is
+used.`,
+	Example: `stargate kv put app.kv wifi-password hunter2 --key-name device
+  echo -n secret | stargate kv put app.kv token --key-name device
+  stargate kv list app.kv --values
+  stargate kv compact app.kv`,
+}
+
+// openStore opens the store at path. An existing store is opened with the
+// matching key from --key, --key-name or the keyring, a new one with
+// --key or --key-name when create is set.
+func openStore(cmd *cobra.Command, path string, create bool) (*kv.Store, func(), error) {
+	var keys []*sg.Key
+	_, err := os.Stat(path)
+	if err == nil {
+		keys, err = containerKeys(cmd, path)
+	} else if create && errors.Is(err, os.ErrNotExist) {
+		var key *sg.Key
+		if key, err = cipherKey(cmd, false); err == nil {
+			keys = []*sg.Key{key}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := keys[0]
+	if len(keys) > 1 {
+		h, err := sg.ReadFileHeader(path)
+		if err == nil {
+			key, err = h.SelectKey(keys)
+		}
+		if err != nil {
+			destroyKeys(keys)
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	s, err := kv.Open(path, key)
+	if err != nil {
+		destroyKeys(keys)
+		return nil, nil, fmt.Errorf("Failed to open store: %w", err)
+	}
+	return s, func() {
+		if err := s.Close(); err != nil {
+			log.Printf("Failed to close store: %v", err)
+		}
+		destroyKeys(keys)
+	}, nil
+}
+
+var kvGetCmd = &cobra.Command{
+	Use:   "get <file> <key>",
+	Short: "Prints the value of a key",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, done, err := openStore(cmd, args[0], false)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		v, err := s.Get([]byte(args[1]))
+		if err != nil {
+			return fmt.Errorf("Get %s: %w", args[1], err)
+		}
+		os.Stdout.Write(v)
+		return nil
+	},
+}
+
+var kvPutCmd = &cobra.Command{
+	Use:   "put <file> <key> [value]",
+	Short: "Sets a key, to stdin if no value is given",
+	Args:  cobra.RangeArgs(2, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var value []byte
+		if len(args) == 3 {
+			value = []byte(args[2])
+		} else {
+			var err error
+			if value, err = io.ReadAll(io.LimitReader(os.Stdin, kv.MaxValueSize+1)); err != nil {
+				return fmt.Errorf("Failed to read stdin: %w", err)
+			}
+		}
+
+		s, done, err := openStore(cmd, args[0], true)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		if err := s.Put([]byte(args[1]), value); err != nil {
+			return fmt.Errorf("Put %s: %w", args[1], err)
+		}
+		return nil
+	},
+}
+
+var kvDeleteCmd = &cobra.Command{
+	Use:   "delete <file> <key>...",
+	Short: "Removes keys",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, done, err := openStore(cmd, args[0], false)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		for _, k := range args[1:] {
+			if err := s.Delete([]byte(k)); err != nil {
+				return fmt.Errorf("Delete %s: %w", k, err)
+			}
+		}
+		return nil
+	},
+}
+
+var kvListCmd = &cobra.Command{
+	Use:   "list <file>",
+	Short: "Lists the keys of a store in sorted order",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values, _ := cmd.Flags().GetBool("values")
+
+		s, done, err := openStore(cmd, args[0], false)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		type pair struct{ k, v string }
+		var pairs []pair
+		err = s.Iterate(func(k, v []byte) error {
+			p := pair{k: string(k)}
+			if values {
+				p.v = string(v)
+			}
+			pairs = append(pairs, p)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("List failed: %w", err)
+		}
+
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].k < pairs[j].k })
+		for _, p := range pairs {
+			if values {
+				fmt.Printf("%s\t%s\n", strconv.Quote(p.k), strconv.Quote(p.v))
+			} else {
+				fmt.Println(strconv.Quote(p.k))
+			}
+		}
+		return nil
+	},
+}
+
+var kvStatsCmd = &cobra.Command{
+	Use:   "stats <file>",
+	Short: "Shows the number of keys and records and how much compaction would free",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, done, err := openStore(cmd, args[0], false)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		printStats(args[0], s.Stats())
+		return nil
+	},
+}
+
+func printStats(path string, st kv.Stats) {
+	fmt.Printf("%s: %d keys in %d records, %d bytes, %d bytes (%.1f%%) reclaimable by compaction\n",
+		path, st.Keys, st.Records, st.Size, st.Size-st.Live, 100*float64(st.Size-st.Live)/float64(st.Size))
+}
+
+var kvCompactCmd = &cobra.Command{
+	Use:   "compact <file>",
+	Short: "Rewrites a store with its live records only",
+	Long: `Rewrites a store with its live records only. The new file replaces the old
+one atomically. With --new-key the records are resealed under that key,
+which is how a store is rekeyed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		newKeyStr, _ := cmd.Flags().GetString("new-key")
+
+		s, done, err := openStore(cmd, args[0], false)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		if newKeyStr != "" {
+			newKey := sg.KeyFromString(newKeyStr)
+			defer newKey.Destroy()
+			err = s.Rekey(newKey)
+		} else {
+			err = s.Compact()
+		}
+		if err != nil {
+			return fmt.Errorf("Compaction failed: %w", err)
+		}
+		printStats(args[0], s.Stats())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(kvCmd)
+	kvCmd.AddCommand(kvGetCmd, kvPutCmd, kvDeleteCmd, kvListCmd, kvStatsCmd, kvCompactCmd)
+
+	for _, c := range []*cobra.Command{kvGetCmd, kvPutCmd, kvDeleteCmd, kvListCmd, kvStatsCmd, kvCompactCmd} {
+		c.Flags().StringArrayP("key", "k", nil, "512-byte key as string (512 chars). May be repeated, the key is chosen by the key ID in the header.")
+		c.Flags().String("key-name", "", "Name of a key in the keyring.")
+	}
+	kvListCmd.Flags().Bool("values", false, "Print values too, quoted.")
+	kvCompactCmd.Flags().String("new-key", "", "Reseal the records under this 512-byte key.")
+}
@@ -0,0 +1,238 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"stargate/sg"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// logCmd represents the log command
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Writes, prints and verifies encrypted append-only logs",
+	Long: `Encrypted append-only logs hold records that are sealed one by one, each
+under its own Waver, and chained: every record's tag covers the tag before
+it, so a record that is changed, removed, inserted or moved makes the log
+fail verification from that record on.
+
+Cutting records off the end leaves a shorter log that is still valid. Keep
+the head printed by "log verify" somewhere else and pass it back with
+--expect-head to catch that.`,
+	Example: `printf 'login alice\nlogout alice\n' | stargate log append audit.sglog --key-name audit
+  stargate log cat audit.sglog -f
+  stargate log verify audit.sglog --expect-head <hex>`,
+}
+
+var logAppendCmd = &cobra.Command{
+	Use:   "append <file>",
+	Short: "Appends every line of stdin as one record",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := cipherKey(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		w, err := sg.OpenLogWriter(args[0], key)
+		if err != nil {
+			return fmt.Errorf("Failed to open log: %w", err)
+		}
+
+		sc := bufio.NewScanner(os.Stdin)
+		sc.Buffer(nil, sg.MaxLogRecord)
+		for sc.Scan() {
+			if _, err := w.Write(sc.Bytes()); err != nil {
+				w.Close()
+				return fmt.Errorf("Failed to append: %w", err)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			w.Close()
+			return fmt.Errorf("Failed to read stdin: %w", err)
+		}
+
+		n := w.Len()
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("Failed to close log: %w", err)
+		}
+		log.Printf("Log %s has %d records", args[0], n)
+		return nil
+	},
+}
+
+var logCatCmd = &cobra.Command{
+	Use:   "cat <file>",
+	Short: "Prints the records of a log, one per line",
+	Long: `Prints the records of a log, one per line, verifying each before it is
+printed. With --follow it keeps waiting for new records, like tail -f.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		follow, _ := cmd.Flags().GetBool("follow")
+
+		keys, err := containerKeys(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		defer destroyKeys(keys)
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r, err := sg.NewLogReader(f, keys...)
+		if err != nil {
+			return fmt.Errorf("Failed to open log: %w", err)
+		}
+		defer r.Close()
+
+		out := bufio.NewWriter(os.Stdout)
+		emit := func(rec []byte) error {
+			out.Write(rec)
+			out.WriteByte('\n')
+			if follow {
+				return out.Flush()
+			}
+			return nil
+		}
+
+		if follow {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = r.Follow(ctx, 500*time.Millisecond, emit)
+		} else {
+			for {
+				var rec []byte
+				if rec, err = r.Next(); err != nil {
+					break
+				}
+				emit(rec)
+			}
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		out.Flush()
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("Log %s: record %d is incomplete", args[0], r.Len())
+		}
+
+		if err != nil {
+			return fmt.Errorf("Log %s: %w", args[0], err)
+		}
+		return nil
+	},
+}
+
+var logVerifyCmd = &cobra.Command{
+	Use:   "verify <file>...",
+	Short: "Checks every record of one or more logs",
+	Long: `Checks every record of one or more logs and prints the number of records
+and the head, the tag of the last record. A log whose last record was cut
+short by a crash is reported, as it will be dropped on the next append.
+
+With --expect-head the log must also pass through that head, so records
+cut off the end since it was taken are caught.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		headHex, _ := cmd.Flags().GetString("expect-head")
+
+		var head []byte
+		if headHex != "" {
+			var err error
+			if head, err = hex.DecodeString(headHex); err != nil || len(head) != sg.AEADOverhead {
+				return fmt.Errorf("--expect-head must be %d hex bytes", sg.AEADOverhead)
+			}
+		}
+
+		failed := false
+		for _, path := range args {
+			if err := verifyLog(cmd, path, head); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: FAILED: %v\n", path, err)
+				failed = true
+			}
+		}
+		if failed {
+			return errReported
+		}
+		return nil
+	},
+}
+
+// verifyLog reads the log at path to its end and prints its length and
+// head. With head set, one of the records must end at it.
+func verifyLog(cmd *cobra.Command, path string, head []byte) error {
+	keys, err := containerKeys(cmd, path)
+	if err != nil {
+		return err
+	}
+	defer destroyKeys(keys)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := sg.NewLogReader(f, keys...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	seen := head == nil || bytes.Equal(r.Head(), head)
+	for {
+		_, err = r.Next()
+		if err != nil {
+			break
+		}
+		if !seen {
+			seen = bytes.Equal(r.Head(), head)
+		}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("record %d is incomplete, it will be dropped on the next append", r.Len())
+	}
+	if err != io.EOF {
+		return err
+	}
+	if !seen {
+		return fmt.Errorf("expected head not found in %d records: records were cut off the end, or it is another log", r.Len())
+	}
+
+	fmt.Printf("%s: OK, %d records, head %s\n", path, r.Len(), hex.EncodeToString(r.Head()))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	logCmd.AddCommand(logAppendCmd, logCatCmd, logVerifyCmd)
+
+	logAppendCmd.Flags().StringP("key", "k", "", "512-byte key as string (512 chars).")
+	logAppendCmd.Flags().String("key-name", "", "Name of a key in the keyring.")
+
+	for _, c := range []*cobra.Command{logCatCmd, logVerifyCmd} {
+		c.Flags().StringArrayP("key", "k", nil, "512-byte key as string (512 chars). May be repeated, the key is chosen by the key ID in the header. If empty — the keyring key with that ID is used.")
+		c.Flags().String("key-name", "", "Name of a key in the keyring.")
+	}
+	logCatCmd.Flags().BoolP("follow", "f", false, "Keep waiting for new records.")
+	logVerifyCmd.Flags().String("expect-head", "", "Head from an earlier \"log verify\", in hex, that the log must still pass through.")
+}
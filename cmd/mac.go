@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"stargate/sg"
+	"stargate/sg/analysis"
+
+	"github.com/spf13/cobra"
+)
+
+// macCmd represents the mac command
+var macCmd = &cobra.Command{
+	Use:   "mac [file]",
+	Short: "Computes the StarGate MAC of a file or stdin",
+	Long: `Computes the keyed StarGate MAC of a file, or of stdin if no file or "-"
+is given, and prints it as hex. Use --size to truncate the tag.
+
+The MAC is built from the StarGate generator itself and is experimental.`,
+	Example: `stargate mac report.pdf -k <key>
+  stargate mac analyze --bits 16 --samples 1000000`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("At most one file is accepted")
+		}
+		size, _ := cmd.Flags().GetInt("size")
+		if size < 1 || size > sg.MACSize {
+			return fmt.Errorf("--size must be between 1 and %d", sg.MACSize)
+		}
+
+		var in io.Reader = os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to open input: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		key, err := cipherKey(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		mac, err := sg.NewMAC(key)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize MAC: %w", err)
+		}
+		defer mac.Close()
+
+		if _, err := io.Copy(mac, in); err != nil {
+			return fmt.Errorf("Failed to read input: %w", err)
+		}
+
+		fmt.Println(hex.EncodeToString(mac.Sum(nil)[:size]))
+		return nil
+	},
+}
+
+var macAnalyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Checks uniformity and collisions of truncated MAC tags",
+	Long: `Computes MAC tags of the counters 0..samples-1 and checks the tags
+truncated to --bits for uniformity (chi-square), the number of colliding
+pairs against the birthday bound, and every tag bit for bias.
+
+Uses a random key unless --key or --key-name is given. Exits with status 1
+if a statistic is off by more than 5 standard deviations.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		samples, _ := cmd.Flags().GetInt("samples")
+		bits, _ := cmd.Flags().GetInt("bits")
+
+		var key *sg.Key
+		var err error
+		if len(keyFlagValues(cmd)) > 0 || cmd.Flags().Changed("key-name") {
+			key, err = cipherKey(cmd, false)
+		} else {
+			key, err = sg.GenKey256()
+			if err != nil {
+				err = fmt.Errorf("Failed to generate key: %w", err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		mac, err := sg.NewMAC(key)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize MAC: %w", err)
+		}
+		defer mac.Close()
+
+		tag := make([]byte, 0, sg.MACSize)
+		r, err := analysis.Outputs(func(msg []byte) []byte {
+			mac.Reset()
+			mac.Write(msg)
+			return mac.Sum(tag[:0])
+		}, samples, bits)
+		if err != nil {
+			return err
+		}
+
+		return printOutputReport(r)
+	},
+}
+
+// printOutputReport prints r and fails with errReported if it found
+// anomalies.
+func printOutputReport(r analysis.OutputReport) error {
+	fmt.Printf("Samples:      %d\n", r.Samples)
+	fmt.Printf("Truncated to: %d bits\n", r.Bits)
+	fmt.Printf("Chi-square:   %.1f (df %d, z = %.2f)\n", r.ChiSquare, 1<<r.Bits-1, r.ChiSquareZ)
+	fmt.Printf("Collisions:   %d (%.1f expected)\n", r.Collisions, r.ExpectedCollisions)
+	fmt.Printf("Max bit bias: z = %.2f at bit %d\n", r.MaxBitZ, r.MaxBitPos)
+
+	issues := r.Suspicious()
+	if len(issues) == 0 {
+		fmt.Println("No anomalies found")
+		return nil
+	}
+
+	for _, s := range issues {
+		fmt.Println("SUSPICIOUS:", s)
+	}
+	return errReported
+}
+
+func init() {
+	rootCmd.AddCommand(macCmd)
+	macCmd.AddCommand(macAnalyzeCmd)
+
+	for _, c := range []*cobra.Command{macCmd, macAnalyzeCmd} {
+		c.Flags().StringP("key", "k", "", "512-byte key as string (512 chars).")
+		c.Flags().String("key-name", "", "Name of a key in the keyring.")
+	}
+	macCmd.Flags().Int("size", sg.MACSize, "Tag size in bytes.")
+
+	macAnalyzeCmd.Flags().IntP("samples", "s", 1<<18, "Number of messages to tag.")
+	macAnalyzeCmd.Flags().Int("bits", 16, fmt.Sprintf("Truncated tag size in bits, at most %d.", analysis.MaxBits))
+}
@@ -4,6 +4,8 @@ Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
 package cmd
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"stargate/sg"
@@ -22,8 +24,14 @@ var messageCmd = &cobra.Command{
 - Default: encryption.
 - Use --decrypt (-d) to decrypt.
 - Key: 512-byte string (512 chars). Random if omitted.
-- Nonce: 16-byte string (16 chars). Random if omitted.
-- Output format: [nonce(16)] + [ciphertext] (as text or bytes).
+- Nonce: 16 bytes as 32 hex digits (16 characters also accepted). Random if omitted.
+- Output format: [nonce] + [ciphertext]. As text the nonce is 32 hex
+  digits; as bytes it is the first 16 bytes.
+- Messages of releases before the reinit mix was specified start with a
+  16-character nonce. As text they are recognized and decrypted with the
+  old mix and nonce schedule; as bytes (--byteinput) they need --legacy.
+  Only messages encrypted with -n decrypt: without it those releases keyed
+  the cipher before choosing the nonce.
 
 Input can be:
   - Plain text: "hello"
@@ -38,24 +46,28 @@ Output modes:
   stargate message "attack at dawn" -b
   stargate message "10 20 30..." --byteinput -b
   stargate message "d1a2b3...ciphertext" -d -k <key-hex>`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
 			log.Println("Need a single messages provided")
-			return
+			return nil
 		}
 
-		key, _ := cmd.Flags().GetString("key")
-		nonce, _ := cmd.Flags().GetString("nonce")
 		bytemode, _ := cmd.Flags().GetBool("bytemode")
 		numericBytes, _ := cmd.Flags().GetBool("numericbytes")
 		decryptMode, _ := cmd.Flags().GetBool("decrypt")
 		byteInput, _ := cmd.Flags().GetBool("byteinput")
+		legacy, _ := cmd.Flags().GetBool("legacy")
 
-		cipher, err := sg.NewCipher(key, nonce, false)
+		if legacy && !decryptMode {
+			return errors.New("--legacy only applies to --decrypt")
+		}
 
+		// On decrypt the nonce comes from the message prefix.
+		key, err := cipherKey(cmd, !decryptMode)
 		if err != nil {
-			log.Fatalf("Failed to initialize cipher: %v", err)
+			return err
 		}
+		defer key.Destroy()
 
 		cipherText := ""
 
@@ -66,7 +78,7 @@ Output modes:
 			for i, part := range parts {
 				val, err := strconv.ParseUint(part, 16, 8)
 				if err != nil {
-					log.Fatal(err)
+					return err
 				}
 				bytes[i] = byte(val)
 			}
@@ -74,24 +86,40 @@ Output modes:
 			args[0] = string(bytes)
 		}
 
+		var nonce sg.Nonce
 		if decryptMode {
-			nonceB := []byte(args[0])[:16]
-			nonce := string(nonceB)
+			if len(args[0]) < sg.NonceSize {
+				return errors.New("Message is too short to contain a nonce")
+			}
+
+			var old bool
+			nonce, args[0], old = splitMessageNonce(args[0], byteInput)
+			legacy = legacy || old
+		} else if nonce, err = encryptionNonce(cmd, key); err != nil {
+			return err
+		}
 
-			cipher.ReinitializeWithNewNonce(nonce)
-			args[0] = args[0][16:]
+		var opts []sg.Option
+		if legacy {
+			opts = legacyCipherOptions()
+		}
+
+		cipher, err := sg.NewCipher(key, nonce, false, opts...)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize cipher: %w", err)
 		}
+		defer cipher.Close()
 
 		for _, char := range args[0] {
 			cipherText += string(char ^ rune(cipher.GetNextByte()))
 		}
 
 		if !decryptMode {
-			nonceStr := ""
-			for _, char := range cipher.Nonce {
-				nonceStr += string(char)
+			if bytemode {
+				cipherText = string(cipher.Nonce[:]) + cipherText
+			} else {
+				cipherText = cipher.Nonce.String() + cipherText
 			}
-			cipherText = nonceStr + cipherText
 		}
 
 		if bytemode {
@@ -113,17 +141,34 @@ Output modes:
 		} else {
 			fmt.Println(cipherText)
 		}
+		return nil
 	},
 }
 
+// splitMessageNonce splits the nonce prefix off an encrypted message: 32 hex
+// digits as printed in text mode, or 16 raw bytes as given with
+// --byteinput. A text message without the hex prefix is one of a release
+// before the reinit mix was specified, whose prefix is the 16 characters
+// of its nonce; legacy reports that.
+func splitMessageNonce(msg string, raw bool) (n sg.Nonce, rest string, legacy bool) {
+	if !raw && len(msg) >= 2*sg.NonceSize {
+		if _, err := hex.Decode(n[:], []byte(msg[:2*sg.NonceSize])); err == nil {
+			return n, msg[2*sg.NonceSize:], false
+		}
+	}
+	copy(n[:], msg)
+	return n, msg[sg.NonceSize:], !raw
+}
+
 func init() {
 	rootCmd.AddCommand(messageCmd)
 
 	messageCmd.Flags().StringP("key", "k", "",
 		"512-byte key as string (512 chars). If empty — random key is generated.")
 
-	messageCmd.Flags().StringP("nonce", "n", "",
-		"16-byte nonce as string (16 chars). If empty — random nonce is generated.")
+	messageCmd.Flags().String("key-name", "", "Name of a key in the keyring.")
+
+	addNonceFlags(messageCmd)
 
 	messageCmd.Flags().BoolP("bytemode", "b", false,
 		"Output as space-separated bytes.")
@@ -132,8 +177,10 @@ func init() {
 		"With --bytemode: output bytes as decimal (0-255), not hex.")
 
 	messageCmd.Flags().BoolP("decrypt", "d", false,
-		"Decrypt mode. Input must contain nonce prefix (16 bytes).")
+		"Decrypt mode. Input must start with the nonce (32 hex digits, or 16 bytes with --byteinput).")
 
 	messageCmd.Flags().Bool("byteinput", false,
 		"Input is space-separated hex bytes (e.g. '48 65 6c 6c 6f').")
+
+	addLegacyFlag(messageCmd, "With --decrypt: the message is one of a release before the reinit mix was specified. Needed for --byteinput only.")
 }
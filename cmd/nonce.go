@@ -0,0 +1,68 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"stargate/sg"
+
+	"github.com/spf13/cobra"
+)
+
+func addNonceFlags(c *cobra.Command) {
+	c.Flags().StringP("nonce", "n", "",
+		"16-byte nonce as 32 hex digits (or 16 characters). If empty — random nonce is generated.")
+	c.Flags().Uint64("counter", 0,
+		"Counter nonce mode: use --nonce plus this value, for sequential messages under one key.")
+	c.Flags().String("nonce-registry", "",
+		"File recording used (key ID, nonce) pairs. Encryption with a pair already in it is refused.")
+}
+
+// encryptionNonce returns the nonce for a new encryption with key. It is
+// taken from --nonce (shifted by --counter) or generated, and checked
+// against --nonce-registry when one is given.
+func encryptionNonce(cmd *cobra.Command, key *sg.Key) (sg.Nonce, error) {
+	nonceStr, _ := cmd.Flags().GetString("nonce")
+	counter, _ := cmd.Flags().GetUint64("counter")
+	registryPath, _ := cmd.Flags().GetString("nonce-registry")
+
+	var nonce sg.Nonce
+	var err error
+
+	if nonceStr == "" {
+		if cmd.Flags().Changed("counter") {
+			return sg.Nonce{}, errors.New("--counter needs a base --nonce")
+		}
+
+		nonce, err = sg.GenNonce()
+		if err != nil {
+			return sg.Nonce{}, fmt.Errorf("Failed to generate nonce: %w", err)
+		}
+		fmt.Printf("Nonce: %s\n", nonce)
+	} else {
+		nonce, err = sg.ParseNonce(nonceStr)
+		if err != nil {
+			return sg.Nonce{}, err
+		}
+		nonce = nonce.Add(counter)
+	}
+
+	if registryPath != "" {
+		registry, err := sg.OpenNonceRegistry(registryPath)
+		if err != nil {
+			return sg.Nonce{}, fmt.Errorf("Failed to open nonce registry: %w", err)
+		}
+		defer registry.Close()
+
+		if err := registry.Use(key.ID(), nonce); err != nil {
+			if errors.Is(err, sg.ErrNonceReuse) {
+				return sg.Nonce{}, fmt.Errorf("Refusing to encrypt: nonce %s was already used with this key", nonce)
+			}
+			return sg.Nonce{}, fmt.Errorf("Failed to record nonce: %w", err)
+		}
+	}
+
+	return nonce, nil
+}
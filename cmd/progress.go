@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"stargate/sg"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// checkProgressFlag rejects an unknown --progress mode before a command
+// starts, so that progressOption cannot fail once keys are held.
+func checkProgressFlag(cmd *cobra.Command) error {
+	switch mode, _ := cmd.Flags().GetString("progress"); mode {
+	case "auto", "bar", "json", "none":
+		return nil
+	default:
+		return fmt.Errorf("Unknown progress mode %q, expected auto, bar, json or none", mode)
+	}
+}
+
+// progressOption builds the sg progress reporter selected by the global
+// --quiet and --progress flags. The bar is only shown on a terminal, so
+// redirected output and CI logs are not flooded with redraws. The mode has
+// been checked by checkProgressFlag.
+func progressOption(cmd *cobra.Command, description string) sg.Option {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	mode, _ := cmd.Flags().GetString("progress")
+
+	if quiet {
+		return sg.WithProgress(nil)
+	}
+
+	switch mode {
+	case "json":
+		return sg.WithProgress(jsonProgress(description))
+	case "bar":
+		return sg.WithProgress(barProgress(description))
+	case "auto":
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			return sg.WithProgress(barProgress(description))
+		}
+	}
+	return sg.WithProgress(nil)
+}
+
+func barProgress(description string) sg.Reporter {
+	var bar *progressbar.ProgressBar
+
+	return sg.ProgressFunc(func(done, total int64) {
+		if bar == nil {
+			bar = progressbar.DefaultBytes(total, description)
+		}
+		bar.Set64(done)
+	})
+}
+
+// jsonProgress writes one JSON object per report to stderr, for machine
+// consumers that wrap the CLI.
+func jsonProgress(description string) sg.Reporter {
+	enc := json.NewEncoder(os.Stderr)
+	start := time.Now()
+
+	return sg.ProgressFunc(func(done, total int64) {
+		_ = enc.Encode(struct {
+			Op      string  `json:"op"`
+			Done    int64   `json:"done"`
+			Total   int64   `json:"total"`
+			Elapsed float64 `json:"elapsed"`
+		}{description, done, total, time.Since(start).Seconds()})
+	})
+}
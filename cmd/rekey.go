@@ -0,0 +1,377 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"stargate/sg"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey <path>...",
+	Short: "Re-encrypts StarGate containers from an old key to a new one",
+	Long: `Re-encrypts StarGate containers from an old key to a new one without
+writing plaintext to disk. Each file is decrypted and encrypted again in a
+single streaming pass under a fresh random nonce and replaced atomically.
+
+- Old keys: --key (may be repeated) and --key-name. The right one is chosen
+  by the key ID in each header.
+- New key: --new-key or --new-key-name. Random if omitted.
+- Directories are walked recursively and every container in them is rekeyed.
+  Other files are skipped. Legacy headerless files are only rekeyed when
+  named explicitly and a single old key is given.
+- Legacy files and containers written before key commitments cannot tell a
+  wrong old key from the right one, and rekeying them with a wrong key
+  turns the data into garbage. They are never replaced in place: they are
+  refused unless --output names where the result goes, or --unchecked-key
+  writes it to <file>.rekeyed beside the original. Check that the result
+  decrypts before deleting the original.
+- --output takes a single file and leaves it unchanged.
+- Files are processed in parallel, see --jobs.
+- Use --dry-run to check which files would be rekeyed with which key
+  without changing anything.`,
+	Example: `stargate rekey ./backups -k <old-key> --new-key-name backup-2025
+  stargate rekey a.sg b.sga -k <old-key> -k <older-key> --new-key <new-key>
+  stargate rekey ./backups --key-name backup-2024 --dry-run
+  stargate rekey old.sg -k <old-key> --new-key-name backup-2025 -o new.sg`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("At least one file or directory is required")
+		}
+
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		registryPath, _ := cmd.Flags().GetString("nonce-registry")
+		output, _ := cmd.Flags().GetString("output")
+		force, _ := cmd.Flags().GetBool("force")
+		unchecked, _ := cmd.Flags().GetBool("unchecked-key")
+
+		if jobs < 1 {
+			jobs = 1
+		}
+
+		targets, skipped, err := rekeyTargets(args)
+		if err != nil {
+			return err
+		}
+
+		dest := rekeyDest{output: output, force: force, unchecked: unchecked}
+		if output != "" {
+			if len(targets) != 1 || skipped > 0 {
+				return errors.New("--output takes a single file")
+			}
+			if sg.SameFile(targets[0], output) {
+				return errors.New("--output names the input, leave it out to rekey in place")
+			}
+			if err := checkOutputPath(targets[0], output, force, false); err != nil {
+				return err
+			}
+		}
+
+		oldKeys, err := cipherKeys(cmd)
+		if err != nil {
+			return err
+		}
+		defer destroyKeys(oldKeys)
+
+		var newKey *sg.Key
+		if !dryRun {
+			if newKey, err = rekeyNewKey(cmd); err != nil {
+				return err
+			}
+			defer newKey.Destroy()
+		}
+
+		var registry *sg.NonceRegistry
+		if registryPath != "" && !dryRun {
+			registry, err = sg.OpenNonceRegistry(registryPath)
+			if err != nil {
+				return fmt.Errorf("Failed to open nonce registry: %w", err)
+			}
+			defer registry.Close()
+		}
+
+		paths := make(chan string)
+		results := make(chan rekeyResult)
+
+		var wg sync.WaitGroup
+		for range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for path := range paths {
+					r := rekeyCheck(path, dest, oldKeys)
+					if !dryRun && r.err == nil {
+						r = rekeyOne(r, dest, oldKeys, newKey, registry)
+					}
+					results <- r
+				}
+			}()
+		}
+
+		go func() {
+			for _, path := range targets {
+				paths <- path
+			}
+			close(paths)
+			wg.Wait()
+			close(results)
+		}()
+
+		var done, failed int
+		var bytes int64
+
+		for r := range results {
+			if r.err != nil {
+				failed++
+				log.Printf("%s: %v", r.path, r.err)
+				continue
+			}
+
+			done++
+			bytes += r.size
+
+			to := ""
+			if r.output != r.path {
+				to = " into " + r.output
+			}
+			switch {
+			case dryRun && r.legacy:
+				log.Printf("%s: would rekey legacy file%s, the key cannot be checked", r.path, to)
+			case dryRun && r.unchecked:
+				log.Printf("%s: would rekey%s, the key cannot be checked", r.path, to)
+			case dryRun:
+				log.Printf("%s: would rekey%s from key ID %s", r.path, to, r.oldID)
+			default:
+				log.Printf("%s: rekeyed%s from key ID %s to %s", r.path, to, r.oldID, newKey.ID())
+			}
+		}
+
+		verb := "Rekeyed"
+		if dryRun {
+			verb = "Would rekey"
+		}
+		fmt.Printf("%s %d files (%d bytes), skipped %d, failed %d\n", verb, done, bytes, skipped, failed)
+
+		if failed > 0 {
+			return errReported
+		}
+		return nil
+	},
+}
+
+// rekeyDest holds the flags that decide where output goes.
+type rekeyDest struct {
+	output           string
+	force, unchecked bool
+}
+
+type rekeyResult struct {
+	path      string
+	output    string
+	oldID     sg.KeyID
+	size      int64
+	legacy    bool
+	unchecked bool
+	err       error
+}
+
+// rekeyTargets expands args into the files to rekey. Files named directly
+// are always taken. Directories contribute only the containers found in
+// them; the number of other files is returned as skipped.
+func rekeyTargets(args []string) (targets []string, skipped int, err error) {
+	seen := make(map[string]bool)
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			targets = append(targets, path)
+		}
+	}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			if isContainerFile(path) {
+				add(path)
+			} else {
+				skipped++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return targets, skipped, nil
+}
+
+func isContainerFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic, _ := bufio.NewReader(f).Peek(len(sg.ContainerMagic))
+	return sg.IsContainer(magic)
+}
+
+// rekeyOne rekeys r.path into r.output, as checked by rekeyCheck.
+func rekeyOne(r rekeyResult, dest rekeyDest, oldKeys []*sg.Key, newKey *sg.Key, registry *sg.NonceRegistry) rekeyResult {
+	nonce, err := sg.GenNonce()
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	if registry != nil {
+		if r.err = registry.Use(newKey.ID(), nonce); r.err != nil {
+			return r
+		}
+	}
+
+	// rekeyCheck only sends unchecked input elsewhere, and RekeyFile
+	// refuses it in place anyway. Likewise it replaces the input in place
+	// even without --force.
+	opts := []sg.Option{sg.WithUncheckedKey()}
+	if !dest.force {
+		opts = append(opts, sg.WithNoReplace())
+	}
+	oldKey, err := sg.RekeyFile(r.path, r.output, oldKeys, newKey, nonce, opts...)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.oldID = oldKey.ID()
+
+	if info, err := os.Stat(r.output); err == nil {
+		r.size = info.Size()
+	}
+	return r
+}
+
+// rekeyCheck does what rekeyOne would up to the point of writing: it finds
+// the old key of a container, or recognises a legacy file, and decides
+// where the output goes. That is --output if given, else the input itself,
+// except for input whose old key cannot be checked: it goes to
+// <path>.rekeyed with --unchecked-key and is refused otherwise.
+func rekeyCheck(path string, dest rekeyDest, oldKeys []*sg.Key) rekeyResult {
+	r := rekeyResult{path: path, output: dest.output}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.size = info.Size()
+
+	if !isContainerFile(path) {
+		if len(oldKeys) > 1 {
+			r.err = fmt.Errorf("legacy file has no key ID, give a single old key")
+			return r
+		}
+		r.legacy, r.unchecked = true, true
+	} else {
+		h, err := sg.ReadFileHeader(path)
+		if err != nil {
+			r.err = err
+			return r
+		}
+
+		key, err := h.SelectKey(oldKeys)
+		if err != nil {
+			r.err = fmt.Errorf("none of the old keys matches: %w", err)
+			return r
+		}
+		r.oldID = key.ID()
+		r.unchecked = h.Commitment == nil
+	}
+
+	switch {
+	case dest.output != "":
+	case !r.unchecked:
+		r.output = path
+	case !dest.unchecked:
+		r.err = fmt.Errorf("%w; give --output, or --unchecked-key to write %s.rekeyed beside it", sg.ErrUncheckedKey, path)
+	default:
+		r.output = path + ".rekeyed"
+		r.err = checkOutputPath(path, r.output, dest.force, false)
+	}
+	return r
+}
+
+// rekeyNewKey returns the key given with --new-key or --new-key-name, or a
+// fresh random key that is printed once.
+func rekeyNewKey(cmd *cobra.Command) (*sg.Key, error) {
+	keyStr, _ := cmd.Flags().GetString("new-key")
+
+	key, err := keyringKeyFlag(cmd, "new-key-name")
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if keyStr != "" {
+			key.Destroy()
+			return nil, errors.New("--new-key and --new-key-name are mutually exclusive")
+		}
+		return lockKey(cmd, key)
+	}
+
+	if keyStr != "" {
+		return lockKey(cmd, sg.KeyFromString(keyStr))
+	}
+
+	key, err = sg.GenKey256()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate key: %w", err)
+	}
+	fmt.Println("Key:", string(key.Bytes()))
+	return lockKey(cmd, key)
+}
+
+func init() {
+	rootCmd.AddCommand(rekeyCmd)
+
+	rekeyCmd.Flags().StringArrayP("key", "k", nil, "Old 512-byte key as string (512 chars). May be repeated, the key is chosen by the key ID in the header.")
+	rekeyCmd.Flags().String("key-name", "", "Name of the old key in the keyring.")
+	rekeyCmd.Flags().String("new-key", "", "New 512-byte key as string (512 chars). If empty — random key is generated.")
+	rekeyCmd.Flags().String("new-key-name", "", "Name of the new key in the keyring.")
+	rekeyCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "Number of files processed in parallel.")
+	rekeyCmd.Flags().Bool("dry-run", false, "Only report what would be rekeyed.")
+	rekeyCmd.Flags().String("nonce-registry", "",
+		"File recording used (key ID, nonce) pairs. Every new nonce is recorded in it.")
+	rekeyCmd.Flags().StringP("output", "o", "", "Output file for a single input, which is left unchanged.")
+	rekeyCmd.Flags().BoolP("force", "f", false, "Overwrite the output file, --output or <file>.rekeyed, if it exists.")
+	rekeyCmd.Flags().Bool("unchecked-key", false,
+		"Rekey input whose old key cannot be checked into <file>.rekeyed beside it, keeping the original.")
+}
@@ -4,16 +4,29 @@ Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
 package cmd
 
 import (
+	"errors"
+	"log"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// errReported fails a command that has already printed why, such as an
+// analysis that found anomalies. Execute exits without printing it.
+var errReported = errors.New("failure already reported")
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "stargate",
 	Short: "A CLI tool to use StarGate generator. Generate a random stream of bytes or process files and messages with stream cipher based on StarGate.",
 	Long:  `StarGate is a deterministic pseudorandom byte generator (PRNG) designed for cryptographic applications, emphasizing high diffusion, nonlinearity, and computational efficiency. The algorithm is based on matrix transformations and uses a compact internal state (~547 bytes), making it ideal for lightweight systems such as Internet of Things (IoT) devices, real-time encryption, and key generation.`,
+	// Errors are printed by Execute. Usage is still shown for bad flags and
+	// arguments, which cobra reports before PersistentPreRunE.
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return checkProgressFlag(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -21,6 +34,9 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		if !errors.Is(err, errReported) {
+			log.Print(err)
+		}
 		os.Exit(1)
 	}
 }
@@ -31,6 +47,9 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.stargate.yaml)")
+	rootCmd.PersistentFlags().Bool("mlock", false, "Keep keys in memory that is locked against swapping (Linux only).")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Do not report progress.")
+	rootCmd.PersistentFlags().String("progress", "auto", "Progress reporting: auto (bar on a terminal only), bar, json (lines on stderr) or none.")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
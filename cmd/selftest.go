@@ -0,0 +1,31 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"stargate/sg"
+
+	"github.com/spf13/cobra"
+)
+
+// selftestCmd represents the selftest command
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Checks the generator against its known-answer vectors",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := sg.SelfTest(); err != nil {
+			return fmt.Errorf("Self-test failed: %w", err)
+		}
+
+		log.Printf("Self-test passed (%d mix and %d keystream known answers)",
+			len(sg.MixKnownAnswers), len(sg.KnownAnswers))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+}
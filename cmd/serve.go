@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"stargate/sg"
+	"stargate/sg/serve"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves StarGate DRBG output over HTTP",
+	Long: `Serves random bytes from a StarGate DRBG over HTTP:
+
+  GET /bytes?n=32&format=raw|hex|base64
+  GET /uint64
+  GET /uuid
+  GET /stream?n=      (chunked; without n until the client hangs up)
+  GET /metrics        (Prometheus text format)
+
+The DRBG is seeded from crypto/rand. With --key or --key-name and --nonce
+it is seeded from that keystream instead, so a restarted server answers the
+same sequence of requests with the same bytes — for tests, never for keys.
+
+Requests are rate limited per client address. SIGINT or SIGTERM stops
+accepting, ends open streams and waits for the requests in flight.`,
+	Example: `stargate serve -l 127.0.0.1:8080 --rate 50 --burst 100
+  curl '127.0.0.1:8080/bytes?n=16&format=hex'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		rate, _ := cmd.Flags().GetFloat64("rate")
+		burst, _ := cmd.Flags().GetInt("burst")
+		maxBytes, _ := cmd.Flags().GetInt("max-bytes")
+		maxStream, _ := cmd.Flags().GetInt64("max-stream")
+
+		var drbg *sg.DRBG
+		var err error
+		if len(keyFlagValues(cmd)) > 0 || cmd.Flags().Changed("key-name") {
+			nonceStr, _ := cmd.Flags().GetString("nonce")
+			if nonceStr == "" {
+				return errors.New("Deterministic mode needs --nonce as well")
+			}
+			var nonce sg.Nonce
+			if nonce, err = sg.ParseNonce(nonceStr); err != nil {
+				return err
+			}
+
+			var key *sg.Key
+			if key, err = cipherKey(cmd, false); err != nil {
+				return err
+			}
+			drbg, err = serve.NewDRBG(key, nonce)
+			key.Destroy()
+			log.Print("Deterministic mode: output is reproducible, do not use it for secrets")
+		} else {
+			drbg, err = serve.NewDRBG(nil, sg.Nonce{})
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to instantiate DRBG: %w", err)
+		}
+		defer drbg.Uninstantiate()
+
+		s, err := serve.New(serve.Config{
+			DRBG:      drbg,
+			Rate:      rate,
+			Burst:     burst,
+			MaxBytes:  maxBytes,
+			MaxStream: maxStream,
+		})
+		if err != nil {
+			return err
+		}
+
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("Failed to listen: %w", err)
+		}
+		log.Printf("Serving on http://%s", l.Addr())
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := s.Run(ctx, l); err != nil {
+			return fmt.Errorf("Server failed: %w", err)
+		}
+		log.Print("Shut down")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringP("listen", "l", "127.0.0.1:8080", "Address to listen on.")
+	serveCmd.Flags().Float64("rate", 20, "Requests per second per client address. 0 disables rate limiting.")
+	serveCmd.Flags().Int("burst", 40, "Requests a client may make at once before --rate applies.")
+	serveCmd.Flags().Int("max-bytes", serve.DefaultMaxBytes, "Largest n for /bytes.")
+	serveCmd.Flags().Int64("max-stream", 0, "Largest n for /stream. 0 means no limit.")
+	serveCmd.Flags().StringP("key", "k", "", "512-byte key as string (512 chars). Makes the output deterministic.")
+	serveCmd.Flags().String("key-name", "", "Name of a key in the keyring. Makes the output deterministic.")
+	serveCmd.Flags().StringP("nonce", "n", "", "16-byte nonce as 32 hex digits (or 16 characters), for deterministic mode.")
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"stargate/sg"
+	"stargate/sg/shamir"
+
+	"github.com/spf13/cobra"
+)
+
+var keySplitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Splits a key into shares, any threshold of which restore it",
+	Long: `Splits a key into shares with Shamir's secret sharing over GF(256).
+Any --threshold of the --shares restore the key, fewer reveal nothing about it.
+
+Shares are armored text carrying the share index, threshold, key ID and a
+checksum. They are printed to stdout, or written to <prefix>.<index>.share
+with --output.`,
+	Example: `stargate key split -n 5 -t 3 --key-name master -o master
+  stargate key combine master.1.share master.4.share master.5.share`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, _ := cmd.Flags().GetInt("shares")
+		t, _ := cmd.Flags().GetInt("threshold")
+		prefix, _ := cmd.Flags().GetString("output")
+
+		key, err := cipherKey(cmd, false)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		shares, err := shamir.Split(key, n, t)
+		if err != nil {
+			return fmt.Errorf("Failed to split key: %w", err)
+		}
+
+		for i, s := range shares {
+			text, _ := s.MarshalText()
+
+			if prefix == "" {
+				if i > 0 {
+					fmt.Println()
+				}
+				os.Stdout.Write(text)
+				continue
+			}
+
+			path := fmt.Sprintf("%s.%d.share", prefix, s.Index)
+			f, err := sg.CreateAtomic(path, 0o600)
+			if err != nil {
+				return fmt.Errorf("Failed to create %s: %w", path, err)
+			}
+			if _, err = f.Write(text); err == nil {
+				err = f.Commit()
+			}
+			f.Abort()
+			if err != nil {
+				return fmt.Errorf("Failed to write %s: %w", path, err)
+			}
+			log.Printf("Share %d/%d → %s", s.Index, s.Count, path)
+		}
+
+		log.Printf("Key ID %s split into %d shares, %d needed to restore it", key.ID(), n, t)
+		return nil
+	},
+}
+
+var keyCombineCmd = &cobra.Command{
+	Use:   "combine [share-file]...",
+	Short: "Restores a key from its shares",
+	Long: `Restores a key from at least threshold shares made by "key split".
+Shares are read from the given files, or from stdin if none or "-" is given;
+a file may hold several shares. The restored key is checked against the key
+ID in the shares, then printed, written to --output or added to the keyring
+with --add.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		name, _ := cmd.Flags().GetString("add")
+
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+
+		var shares []shamir.Share
+		for _, arg := range args {
+			var in io.Reader = os.Stdin
+			if arg != "-" {
+				f, err := os.Open(arg)
+				if err != nil {
+					return fmt.Errorf("Failed to open share: %w", err)
+				}
+				defer f.Close()
+				in = f
+			}
+
+			s, err := shamir.ParseShares(in)
+			if err != nil {
+				return fmt.Errorf("%s: %w", arg, err)
+			}
+			shares = append(shares, s...)
+		}
+
+		key, err := shamir.Combine(shares)
+		if err != nil {
+			return fmt.Errorf("Failed to combine shares: %w", err)
+		}
+		defer key.Destroy()
+
+		switch {
+		case name != "":
+			return addToKeyring(cmd, name, key, "restored from shares")
+		case output != "":
+			f, err := sg.CreateAtomic(output, 0o600)
+			if err != nil {
+				return fmt.Errorf("Failed to create output: %w", err)
+			}
+			defer f.Abort()
+
+			if _, err = f.Write(key.Bytes()); err == nil {
+				err = f.Commit()
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to write key: %w", err)
+			}
+			log.Printf("Key ID %s restored → %s", key.ID(), output)
+		default:
+			fmt.Println("Key:", string(key.Bytes()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	keyCmd.AddCommand(keySplitCmd, keyCombineCmd)
+
+	keySplitCmd.Flags().StringP("key", "k", "", "512-byte key as string (512 chars).")
+	keySplitCmd.Flags().String("key-name", "", "Name of a key in the keyring.")
+	keySplitCmd.Flags().IntP("shares", "n", 5, "Number of shares to make.")
+	keySplitCmd.Flags().IntP("threshold", "t", 3, "Number of shares needed to restore the key.")
+	keySplitCmd.Flags().StringP("output", "o", "", "Write shares to <prefix>.<index>.share instead of stdout.")
+
+	keyCombineCmd.Flags().StringP("output", "o", "", "Write the restored key to a file instead of stdout.")
+	keyCombineCmd.Flags().String("add", "", "Add the restored key to the keyring under this name.")
+}
@@ -18,27 +18,41 @@ var streamCmd = &cobra.Command{
 	Long: `Generates a deterministic pseudorandom byte stream using StarGate PRNG.
 
 - Key: 512-byte string (512 chars). Random if omitted.
-- Nonce: 16-byte string (16 chars). Random if omitted.
+- Nonce: 16 bytes as 32 hex digits (16 characters also accepted). Random if omitted.
 - Output: raw bytes (no nonce prepended).
+- Use --legacy with the same 16-character nonce to reproduce the console
+  output of releases before the reinit mix was specified. Their files were
+  always written under a random nonce and cannot be reproduced.
 - Use --console to print bytes to stdout.
 - Otherwise: saves to binary file.`,
 	Example: `stargate stream -l 512 -o stream.bin
   	stargate stream -c -l 8 -b`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		consoleOutput, _ := cmd.Flags().GetBool("console")
 		length, _ := cmd.Flags().GetInt("length")
 		output, _ := cmd.Flags().GetString("output")
-		key, _ := cmd.Flags().GetString("key")
-		nonce, _ := cmd.Flags().GetString("nonce")
 		hexOutput, _ := cmd.Flags().GetBool("hexoutput")
 		corrTestMode, _ := cmd.Flags().GetBool("corrtestmode")
 
+		key, err := cipherKey(cmd, true)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		nonce, err := encryptionNonce(cmd, key)
+		if err != nil {
+			return err
+		}
+		opts := legacyOptions(cmd)
+
 		if consoleOutput {
-			cipher, err := sg.NewCipher(key, nonce, corrTestMode)
+			cipher, err := sg.NewCipher(key, nonce, corrTestMode, opts...)
 
 			if err != nil {
-				log.Fatalf("Failed to initialize cipher: %v", err)
+				return fmt.Errorf("Failed to initialize cipher: %w", err)
 			}
+			defer cipher.Close()
 
 			if corrTestMode {
 				for range length {
@@ -61,9 +75,12 @@ var streamCmd = &cobra.Command{
 			}
 
 		} else {
-			sg.CreateBin(length, output, key)
+			if err := sg.CreateBin(length, output, key, nonce, append(opts, progressOption(cmd, "generating"))...); err != nil {
+				return fmt.Errorf("Failed to generate stream: %w", err)
+			}
 			log.Printf("Byte stream is saved to %s.bin\n", output)
 		}
+		return nil
 	},
 }
 
@@ -82,8 +99,9 @@ func init() {
 	streamCmd.Flags().StringP("key", "k", "",
 		"512-byte key as string (512 chars). If empty — random key is generated.")
 
-	streamCmd.Flags().StringP("nonce", "n", "",
-		"16-byte nonce as string (16 chars). If empty — random nonce is generated.")
+	streamCmd.Flags().String("key-name", "", "Name of a key in the keyring.")
+
+	addNonceFlags(streamCmd)
 
 	streamCmd.Flags().BoolP("hexoutput", "b", false,
 		"Output as hex bytes.")
@@ -91,4 +109,24 @@ func init() {
 	streamCmd.Flags().BoolP("corrtestmode", "t", false,
 		"Turn on Correlation Test Mode")
 
+	addLegacyFlag(streamCmd, "Reproduce the stream of releases before the reinit mix was specified: the xxh3 mix and their nonce schedule.")
+}
+
+func addLegacyFlag(cmd *cobra.Command, usage string) {
+	cmd.Flags().Bool("legacy", false, usage)
+}
+
+// legacyCipherOptions reproduce the keystream of releases before the reinit
+// mix was specified. Both are needed: the xxh3 mix alone gives a stream no
+// release ever produced.
+func legacyCipherOptions() []sg.Option {
+	return []sg.Option{sg.WithMix(sg.MixXXH3), sg.WithLegacyNonceSchedule()}
+}
+
+// legacyOptions returns legacyCipherOptions if --legacy is set.
+func legacyOptions(cmd *cobra.Command) []sg.Option {
+	if legacy, _ := cmd.Flags().GetBool("legacy"); legacy {
+		return legacyCipherOptions()
+	}
+	return nil
 }
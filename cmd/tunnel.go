@@ -0,0 +1,261 @@
+/*
+Copyright © 2025 Daniel Baikalov <felix.trof@gmail.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	sgnet "stargate/sg/net"
+	"stargate/sg/noise"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// tunnelCmd represents the tunnel command
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Forwards TCP connections through a StarGate-encrypted link",
+	Long: `Forwards TCP connections through a link encrypted and authenticated with
+StarGate under a pre-shared key, or under X25519 static key pairs.
+
+"tunnel client" accepts plain connections on a local port and carries each
+one encrypted to "tunnel server", which forwards it to the target address.
+Both ends must use the same key and --rekey-after.
+
+With --static each end authenticates with its own key pair, made with
+"tunnel keygen", and --peer pins the public keys the other end may have.
+A pre-shared key is optional then and adds to the handshake.`,
+	Example: `# on the collector
+  stargate tunnel server --listen :9000 --target 127.0.0.1:1883 --key-name iot
+  # on the device
+  stargate tunnel client --listen 127.0.0.1:1883 --remote collector:9000 --key-name iot
+
+  # with static keys
+  stargate tunnel keygen -o device.key
+  stargate tunnel client -l 127.0.0.1:1883 -r collector:9000 --static device.key --peer <collector public key>`,
+}
+
+var tunnelServerCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Accepts encrypted connections and forwards them to --target",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		target, _ := cmd.Flags().GetString("target")
+		if target == "" {
+			return errors.New("--target is required")
+		}
+
+		config, err := tunnelConfig(cmd)
+		if err != nil {
+			return err
+		}
+		defer destroyTunnelConfig(config)
+
+		l, err := sgnet.Listen("tcp", listen, config)
+		if err != nil {
+			return fmt.Errorf("Failed to listen: %w", err)
+		}
+		log.Printf("Forwarding encrypted %s → %s", l.Addr(), target)
+
+		return serveTunnel(l, func() (net.Conn, error) {
+			return net.Dial("tcp", target)
+		})
+	},
+}
+
+var tunnelClientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Accepts local connections and forwards them encrypted to --remote",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		remote, _ := cmd.Flags().GetString("remote")
+		if remote == "" {
+			return errors.New("--remote is required")
+		}
+
+		config, err := tunnelConfig(cmd)
+		if err != nil {
+			return err
+		}
+		defer destroyTunnelConfig(config)
+
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("Failed to listen: %w", err)
+		}
+		log.Printf("Forwarding %s → encrypted %s", l.Addr(), remote)
+
+		return serveTunnel(l, func() (net.Conn, error) {
+			return sgnet.Dial("tcp", remote, config)
+		})
+	},
+}
+
+var tunnelKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generates a static key pair for --static and prints its public key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+
+		kp, err := noise.GenerateKeyPair()
+		if err != nil {
+			return fmt.Errorf("Failed to generate key pair: %w", err)
+		}
+		defer kp.Destroy()
+
+		if err := writeHexFile(output, kp.Private[:]); err != nil {
+			return fmt.Errorf("Failed to write key pair: %w", err)
+		}
+
+		fmt.Println("Public key:", kp.Public)
+		return nil
+	},
+}
+
+// tunnelConfig takes the keys and keeps them for as long as the tunnel
+// runs, as every new connection needs them. destroyTunnelConfig wipes them.
+func tunnelConfig(cmd *cobra.Command) (*sgnet.Config, error) {
+	rekeyAfter, _ := cmd.Flags().GetUint64("rekey-after")
+	staticPath, _ := cmd.Flags().GetString("static")
+	peers, _ := cmd.Flags().GetStringArray("peer")
+
+	config := &sgnet.Config{RekeyAfter: rekeyAfter}
+
+	if staticPath == "" {
+		if len(peers) > 0 {
+			return nil, errors.New("--peer needs --static")
+		}
+		key, err := cipherKey(cmd, false)
+		if err != nil {
+			return nil, err
+		}
+		config.Key = key
+		return config, nil
+	}
+
+	var peerKeys []noise.PublicKey
+	for _, p := range peers {
+		pub, err := noise.ParsePublicKey(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --peer %q: %w", p, err)
+		}
+		peerKeys = append(peerKeys, pub)
+	}
+	config.PeerKeys = peerKeys
+
+	static, err := loadStaticKey(staticPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load static key: %w", err)
+	}
+	config.Static = static
+	log.Printf("Static public key: %s", static.Public)
+
+	if len(keyFlagValues(cmd)) > 0 || cmd.Flags().Changed("key-name") {
+		if config.Key, err = cipherKey(cmd, false); err != nil {
+			static.Destroy()
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func destroyTunnelConfig(config *sgnet.Config) {
+	if config.Key != nil {
+		config.Key.Destroy()
+	}
+	if config.Static != nil {
+		config.Static.Destroy()
+	}
+}
+
+// loadStaticKey reads a private key written by "tunnel keygen".
+func loadStaticKey(path string) (*noise.KeyPair, error) {
+	priv, err := readHexFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(priv)
+
+	return noise.NewKeyPair(priv)
+}
+
+func serveTunnel(l net.Listener, dial func() (net.Conn, error)) error {
+	for {
+		in, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("Accept failed: %w", err)
+		}
+
+		go func() {
+			defer in.Close()
+
+			// Authenticate the peer before touching the target.
+			if c, ok := in.(*sgnet.Conn); ok {
+				if err := c.Handshake(); err != nil {
+					log.Printf("%s: %v", in.RemoteAddr(), err)
+					return
+				}
+			}
+
+			out, err := dial()
+			if err != nil {
+				log.Printf("%s: %v", in.RemoteAddr(), err)
+				return
+			}
+			defer out.Close()
+
+			if c, ok := in.(*sgnet.Conn); ok && c.PeerStatic() != (noise.PublicKey{}) {
+				log.Printf("%s: connected, peer key %s", in.RemoteAddr(), c.PeerStatic())
+			} else {
+				log.Printf("%s: connected", in.RemoteAddr())
+			}
+			forward(in, out)
+			log.Printf("%s: closed", in.RemoteAddr())
+		}()
+	}
+}
+
+// forward copies both ways until both sides are done, passing on the end
+// of each direction as a half-close.
+func forward(a, b net.Conn) {
+	var wg sync.WaitGroup
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go pipe(a, b)
+	go pipe(b, a)
+	wg.Wait()
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+	tunnelCmd.AddCommand(tunnelServerCmd, tunnelClientCmd, tunnelKeygenCmd)
+
+	for _, c := range []*cobra.Command{tunnelServerCmd, tunnelClientCmd} {
+		c.Flags().StringP("key", "k", "", "Pre-shared 512-byte key as string (512 chars).")
+		c.Flags().String("key-name", "", "Name of the pre-shared key in the keyring.")
+		c.Flags().StringP("listen", "l", "", "Address to listen on.")
+		c.Flags().Uint64("rekey-after", sgnet.DefaultRekeyAfter, "Rekey each direction after this many bytes. Must match the other end.")
+		c.Flags().String("static", "", "Private key file from \"tunnel keygen\". Authenticates with static keys instead of only a pre-shared key.")
+		c.Flags().StringArray("peer", nil, "Public key the other end may have (hex). Repeatable. Without it any static key is accepted.")
+		_ = c.MarkFlagRequired("listen")
+	}
+
+	tunnelServerCmd.Flags().StringP("target", "t", "", "Address to forward connections to.")
+	tunnelClientCmd.Flags().StringP("remote", "r", "", "Address of the tunnel server.")
+	tunnelKeygenCmd.Flags().StringP("output", "o", "", "File to write the private key to.")
+	_ = tunnelKeygenCmd.MarkFlagRequired("output")
+}
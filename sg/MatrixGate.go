@@ -1,19 +1,17 @@
 package sg
 
 type MatrixGate struct {
-	Matrix [][]byte
+	Matrix [4][4]byte
 }
 
-func NewMatrixGate(vals []byte) *MatrixGate {
-	var matrix [][]byte
+func NewMatrixGate(vals []byte) MatrixGate {
+	var gate MatrixGate
 
 	for i := range 4 {
-		matrix = append(matrix, vals[i*4:(i+1)*4])
+		copy(gate.Matrix[i][:], vals[i*4:(i+1)*4])
 	}
 
-	return &MatrixGate{
-		Matrix: matrix,
-	}
+	return gate
 }
 
 func (gate *MatrixGate) PassValue(val byte, accum int) uint8 {
@@ -22,7 +20,7 @@ func (gate *MatrixGate) PassValue(val byte, accum int) uint8 {
 
 	v := gate.Matrix[x][y]
 
-	gate.Matrix[x][y] = uint8(int(v+val) % 256)
+	gate.Matrix[x][y] = v + val
 
-	return uint8(int(val+v) % 256)
+	return val + v
 }
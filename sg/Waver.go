@@ -1,16 +1,11 @@
 package sg
 
 import (
-	"crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
-	"encoding/binary"
-	"encoding/hex"
-	"errors"
-	"fmt"
 	"io"
+	"stargate/sg/core"
 
-	"github.com/zeebo/xxh3"
 	"golang.org/x/crypto/hkdf"
 )
 
@@ -37,109 +32,73 @@ func DeriveStateFromKey(keyBytes, nonceBytes []byte) ([]byte, error) {
 	return state, nil
 }
 
-func GenKey256() (string, error) {
-	key := make([]byte, 256)
-	_, err := rand.Read(key)
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(key), nil
-}
-
-func GenNonce() (string, error) {
-	key := make([]byte, 8)
-	_, err := rand.Read(key)
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(key), nil
-}
-
+// Waver keeps its whole state in fixed-size arrays, so producing a block
+// allocates nothing.
 type Waver struct {
-	Matrix                        [][]byte
-	Nonce                         string
+	Matrix                        [16][16]byte
+	Nonce                         Nonce
 	X                             int
 	Y                             int
 	OffsetSum                     int
 	LastPool                      *SizedPool
-	Gates                         []*MatrixGate
+	Gates                         [16]MatrixGate
 	N                             int
 	matrixHash                    uint64
 	hashEvery                     int
-	ReinitMode                    bool
-	reinitEvery                   int
 	oneByOneMode                  bool
 	blockIndex                    int
-	currentBlock                  []byte
-	currentBlockBeforePostGateMix []byte
+	blockPos                      int
+	currentBlock                  [BlockSize]byte
+	currentBlockBeforePostGateMix [BlockSize]byte
+	mix                           Mix
+	closed                        bool
 	CORR_TEST_MODE                bool
 }
 
-func NewWaver(key, nonce string, corrTestMode bool) (*Waver, error) {
-	workWithKey := key
-	if key == "" {
-		k, err := GenKey256()
-
-		if err != nil {
-			return nil, err
-		}
+func NewWaver(key *Key, nonce Nonce, corrTestMode bool, opts ...Option) (*Waver, error) {
+	return newWaver(key, nonce, corrTestMode, newOptions(opts))
+}
 
-		fmt.Println("Key:", k)
-		workWithKey = k
+func newWaver(key *Key, nonce Nonce, corrTestMode bool, o options) (*Waver, error) {
+	if key == nil || key.Len() == 0 {
+		return nil, ErrEmptyKey
 	}
 
 	// Hashing key to work
-	bytes, err := DeriveStateFromKey([]byte(workWithKey), []byte(nonce))
+	bytes, err := DeriveStateFromKey(key.Bytes(), nonce[:])
 
 	if err != nil {
 		return nil, err
 	}
 
-	var matrix [][]byte
-	for i := 0; i < 16; i++ {
-		row := make([]byte, 16)
-		copy(row, bytes[i*16:(i+1)*16])
-		matrix = append(matrix, row)
-	}
-
-	hash := sha256.Sum256([]byte(key))
-
-	x := int(hash[0] % 16)
-	y := int(hash[1] % 16)
-
-	var gates []*MatrixGate
-
-	bytes = bytes[256:]
-	for i := range 16 {
-		gate := NewMatrixGate(bytes[i*16 : (i+1)*16])
-		gates = append(gates, gate)
-	}
-
-	if nonce == "" {
-		nonce, err = GenNonce()
-		if err != nil {
-			return nil, err
-		}
-		fmt.Printf("Nonce: %s\n", nonce)
-	}
+	hash := sha256.Sum256(key.Bytes())
 
 	w := &Waver{
-		Matrix:         matrix,
 		Nonce:          nonce,
-		X:              x,
-		Y:              y,
-		Gates:          gates,
+		X:              int(hash[0] % 16),
+		Y:              int(hash[1] % 16),
 		LastPool:       &SizedPool{Size: 8},
+		blockPos:       BlockSize,
 		hashEvery:      1,
-		reinitEvery:    256,
-		ReinitMode:     false,
+		mix:            o.mix,
 		CORR_TEST_MODE: corrTestMode,
 	}
+	wipe(hash[:])
 
-	err = w.ApplyNonce()
+	for i := 0; i < 16; i++ {
+		copy(w.Matrix[i][:], bytes[i*16:(i+1)*16])
+	}
 
-	if err != nil {
-		return nil, err
+	gates := bytes[256:]
+	for i := range 16 {
+		w.Gates[i] = NewMatrixGate(gates[i*16 : (i+1)*16])
+	}
+	wipe(bytes)
+
+	if o.legacyNonce {
+		w.applyNonceLegacy()
+	} else {
+		w.ApplyNonce()
 	}
 
 	w.getMatrixHash()
@@ -149,6 +108,25 @@ func NewWaver(key, nonce string, corrTestMode bool) (*Waver, error) {
 	return w, nil
 }
 
+// Close wipes the generator state. The Waver must not be used afterwards:
+// reading from it panics rather than return a stream that no longer
+// depends on the key.
+func (w *Waver) Close() {
+	w.closed = true
+	w.Matrix = [16][16]byte{}
+	w.Gates = [16]MatrixGate{}
+	if w.LastPool != nil {
+		wipe(w.LastPool.State)
+		w.LastPool.Sum = 0
+	}
+	w.currentBlock = [BlockSize]byte{}
+	w.currentBlockBeforePostGateMix = [BlockSize]byte{}
+
+	w.blockPos = BlockSize
+	w.X, w.Y, w.OffsetSum, w.N, w.blockIndex = 0, 0, 0, 0, 0
+	w.matrixHash = 0
+}
+
 func (w *Waver) WarmUp(n int) {
 	for range n {
 		if w.CORR_TEST_MODE {
@@ -163,7 +141,7 @@ func (w *Waver) PassThroughGates(val byte) byte {
 	// Выбираем гейт на основе текущей суммы смещения
 	gateIndex := w.OffsetSum % len(w.Gates) // или w.Matrix[x][y] % 16
 
-	gate := w.Gates[gateIndex]
+	gate := &w.Gates[gateIndex]
 	val = gate.PassValue(val, w.OffsetSum)
 
 	return val // Убрали внешний цикл, остался 1 проход
@@ -199,11 +177,7 @@ func (w *Waver) shiftColumnBitsLeft(col int) {
 }
 
 func (w *Waver) getMatrixHash() {
-	flat := make([]byte, 0, 256)
-	for i := 0; i < 16; i++ {
-		flat = append(flat, w.Matrix[i]...) // добавляем всю строку
-	}
-	w.matrixHash = xxh3.Hash(flat)
+	w.matrixHash = core.HashMatrix(&w.Matrix, w.mix)
 }
 
 func (w *Waver) GetPosFromMatrixState() (byte, byte) {
@@ -234,26 +208,15 @@ func (w *Waver) XORCross(x, y int) {
 		w.Matrix[x][i], w.Matrix[x][j] = w.Matrix[x][j], w.Matrix[x][i]
 	}
 
-	col := make([]byte, 16)
-	for i := 0; i < 16; i++ {
-		col[i] = ((w.Matrix[i][y] << 1) | (w.Matrix[i][y] >> 7)) & 0xff
-	}
 	for i := 0; i < 16; i++ {
-		w.Matrix[i][y] = col[i]
+		w.Matrix[i][y] = (w.Matrix[i][y] << 1) | (w.Matrix[i][y] >> 7)
 	}
 }
 
+// ReinitFromHash rebuilds the matrix from its hash with the mix of the
+// Waver, see core.Reinit and docs/mix.md.
 func (w *Waver) ReinitFromHash() {
-	w.getMatrixHash()
-	seed := w.matrixHash
-
-	for i := 0; i < 16; i++ {
-		h1 := xxh3.HashSeed([]byte{byte(i)}, seed)
-		binary.LittleEndian.PutUint64(w.Matrix[i][:8], h1)
-
-		h2 := xxh3.HashSeed([]byte{byte(i + 100)}, seed^h1)
-		binary.LittleEndian.PutUint64(w.Matrix[i][8:], h2)
-	}
+	core.Reinit(&w.Matrix, w.mix)
 }
 
 func (w *Waver) LightShuffle() {
@@ -271,22 +234,49 @@ func (w *Waver) GetNext() byte {
 	return w.getByteFromBlock()
 }
 
+// Read fills p with keystream, so a Waver can be used as an io.Reader. It
+// never fails.
+func (w *Waver) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = w.getByteFromBlock()
+	}
+	return len(p), nil
+}
+
 func (w *Waver) GetNext_CORR_TEST() (byte, byte) {
 	return w.getByteFromBlock_CORR_TEST()
 }
 
-func (w *Waver) ApplyNonce() error {
-	if len(w.Nonce) != 16 {
-		return errors.New("nonce must be 16 characters length. Nounce: " + w.Nonce)
+// ApplyNonce XORs the nonce over the matrix and then the gates, cycling
+// through its 16 bytes.
+func (w *Waver) ApplyNonce() {
+	idx := 0
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			w.Matrix[i][j] ^= w.Nonce[idx%NonceSize]
+			idx++
+		}
 	}
 
-	nonceBytes := []byte(w.Nonce)
+	for g := 0; g < len(w.Gates); g++ {
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				w.Gates[g].Matrix[i][j] ^= w.Nonce[idx%NonceSize]
+				idx++
+			}
+		}
+	}
+}
 
+// applyNonceLegacy is the schedule used before the nonce became binary. On
+// wrap-around it reset the index without applying the byte at that
+// position, so every 17th cell was skipped. Kept to decrypt old files.
+func (w *Waver) applyNonceLegacy() {
 	idx := 0
 	for i := 0; i < 16; i++ {
 		for j := 0; j < 16; j++ {
-			if idx < len(nonceBytes) {
-				w.Matrix[i][j] ^= nonceBytes[idx]
+			if idx < NonceSize {
+				w.Matrix[i][j] ^= w.Nonce[idx]
 				idx++
 			} else {
 				idx = 0
@@ -297,8 +287,8 @@ func (w *Waver) ApplyNonce() error {
 	for g := 0; g < len(w.Gates); g++ {
 		for i := 0; i < 4; i++ {
 			for j := 0; j < 4; j++ {
-				if idx < len(nonceBytes) {
-					w.Gates[g].Matrix[i][j] ^= nonceBytes[idx]
+				if idx < NonceSize {
+					w.Gates[g].Matrix[i][j] ^= w.Nonce[idx]
 					idx++
 				} else {
 					idx = 0
@@ -306,14 +296,17 @@ func (w *Waver) ApplyNonce() error {
 			}
 		}
 	}
-
-	return nil
 }
 
 func (w *Waver) refillBlock() {
-	if len(w.currentBlock) > 0 {
+	if w.blockPos < BlockSize {
 		return
 	}
+	// Close leaves blockPos at BlockSize, so a closed Waver always ends up
+	// here and the check costs nothing per byte.
+	if w.closed {
+		panic("sg: Waver used after Close")
+	}
 
 	// Используем текущее состояние для выбора координат для XORCross
 	x := w.Y % 16
@@ -328,11 +321,11 @@ func (w *Waver) refillBlock() {
 	// 1.5. УСИЛЕННАЯ МОДИФИКАЦИЯ СОСТОЯНИЯ ЧЕРЕЗ GATES
 	// Применяем Gate ко всем 4 строкам, из которых формируется блок
 	gateIndex := w.blockIndex % len(w.Gates)
-	gate := w.Gates[gateIndex]
+	gate := &w.Gates[gateIndex]
 
 	// Применяем Gate к строкам 0, 1, 2, 3 (которые будут извлечены)
 	for r := 0; r < 4; r++ {
-		row := w.Matrix[r]
+		row := &w.Matrix[r]
 		for i := 0; i < 16; i++ {
 			// Используем индекс строки (r) и байта (i) для разнообразия
 			// Это гарантирует, что нелинейность Гейта попадает прямо в выходные байты
@@ -341,10 +334,8 @@ func (w *Waver) refillBlock() {
 	}
 
 	// 2. ИЗВЛЕЧЕНИЕ БЛОКА
-	w.currentBlock = make([]byte, BlockSize)
-
 	// Извлекаем 64 байта из верхних 4 строк
-	copy(w.currentBlock, w.Matrix[0][:])
+	copy(w.currentBlock[:], w.Matrix[0][:])
 	copy(w.currentBlock[16:], w.Matrix[1][:])
 	copy(w.currentBlock[32:], w.Matrix[2][:])
 	copy(w.currentBlock[48:], w.Matrix[3][:])
@@ -352,7 +343,7 @@ func (w *Waver) refillBlock() {
 	// 3. ПОСТ-СМЕШИВАНИЕ БЛОКА (Финальная нелинейность)
 	// Используем СЛЕДУЮЩИЙ гейт
 	postMixGateIndex := (w.blockIndex + 1) % len(w.Gates)
-	postMixGate := w.Gates[postMixGateIndex]
+	postMixGate := &w.Gates[postMixGateIndex]
 
 	for i := 0; i < BlockSize; i++ {
 		// Быстрая нелинейность с OffsetSum и другим Gate
@@ -362,6 +353,7 @@ func (w *Waver) refillBlock() {
 	}
 
 	w.blockIndex++
+	w.blockPos = 0
 
 	w.ReinitFromHash()
 	// 4. Обновление состояния: смена позиции для следующего раунда
@@ -369,9 +361,12 @@ func (w *Waver) refillBlock() {
 }
 
 func (w *Waver) refillBlock_CORR_TEST() {
-	if len(w.currentBlock) > 0 {
+	if w.blockPos < BlockSize {
 		return
 	}
+	if w.closed {
+		panic("sg: Waver used after Close")
+	}
 
 	// Используем текущее состояние для выбора координат для XORCross
 	x := w.Y % 16
@@ -386,11 +381,11 @@ func (w *Waver) refillBlock_CORR_TEST() {
 	// 1.5. УСИЛЕННАЯ МОДИФИКАЦИЯ СОСТОЯНИЯ ЧЕРЕЗ GATES
 	// Применяем Gate ко всем 4 строкам, из которых формируется блок
 	gateIndex := w.blockIndex % len(w.Gates)
-	gate := w.Gates[gateIndex]
+	gate := &w.Gates[gateIndex]
 
 	// Применяем Gate к строкам 0, 1, 2, 3 (которые будут извлечены)
 	for r := 0; r < 4; r++ {
-		row := w.Matrix[r]
+		row := &w.Matrix[r]
 		for i := 0; i < 16; i++ {
 			// Используем индекс строки (r) и байта (i) для разнообразия
 			// Это гарантирует, что нелинейность Гейта попадает прямо в выходные байты
@@ -399,10 +394,8 @@ func (w *Waver) refillBlock_CORR_TEST() {
 	}
 
 	// 2. ИЗВЛЕЧЕНИЕ БЛОКА
-	w.currentBlock = make([]byte, BlockSize)
-
 	// Извлекаем 64 байта из верхних 4 строк
-	copy(w.currentBlock, w.Matrix[0][:])
+	copy(w.currentBlock[:], w.Matrix[0][:])
 	copy(w.currentBlock[16:], w.Matrix[1][:])
 	copy(w.currentBlock[32:], w.Matrix[2][:])
 	copy(w.currentBlock[48:], w.Matrix[3][:])
@@ -410,10 +403,9 @@ func (w *Waver) refillBlock_CORR_TEST() {
 	// 3. ПОСТ-СМЕШИВАНИЕ БЛОКА (Финальная нелинейность)
 	// Используем СЛЕДУЮЩИЙ гейт
 	postMixGateIndex := (w.blockIndex + 1) % len(w.Gates)
-	postMixGate := w.Gates[postMixGateIndex]
+	postMixGate := &w.Gates[postMixGateIndex]
 
-	w.currentBlockBeforePostGateMix = make([]byte, BlockSize)
-	copy(w.currentBlockBeforePostGateMix, w.currentBlock)
+	w.currentBlockBeforePostGateMix = w.currentBlock
 	for i := 0; i < BlockSize; i++ {
 		// Быстрая нелинейность с OffsetSum и другим Gate
 		w.currentBlock[i] = w.currentBlock[i] ^ byte(w.OffsetSum)
@@ -422,6 +414,7 @@ func (w *Waver) refillBlock_CORR_TEST() {
 	}
 
 	w.blockIndex++
+	w.blockPos = 0
 
 	w.ReinitFromHash()
 	// 4. Обновление состояния: смена позиции для следующего раунда
@@ -436,18 +429,18 @@ func (w *Waver) changePosition() {
 }
 
 func (w *Waver) getByteFromBlock() byte {
-	if len(w.currentBlock) == 0 {
+	if w.blockPos == BlockSize {
 		w.refillBlock()
 	}
 
 	// 🚨 ИДЕАЛЬНАЯ АМОРТИЗАЦИЯ: ТОЛЬКО ВЫДАЕМ БАЙТ
-	r := w.currentBlock[0]
+	r := w.currentBlock[w.blockPos]
 
 	// 🚨 УДАЛЕНЫ дорогие вызовы: PassThroughGates и MixByte.
 	// Вся их работа выполнена один раз в refillBlock.
 
 	w.OffsetSum += int(r)
-	w.currentBlock = w.currentBlock[1:]
+	w.blockPos++
 
 	w.N++
 
@@ -455,20 +448,19 @@ func (w *Waver) getByteFromBlock() byte {
 }
 
 func (w *Waver) getByteFromBlock_CORR_TEST() (byte, byte) {
-	if len(w.currentBlock) == 0 {
+	if w.blockPos == BlockSize {
 		w.refillBlock_CORR_TEST()
 	}
 
 	// 🚨 ИДЕАЛЬНАЯ АМОРТИЗАЦИЯ: ТОЛЬКО ВЫДАЕМ БАЙТ
-	r1 := w.currentBlock[0]
-	r2 := w.currentBlockBeforePostGateMix[0]
+	r1 := w.currentBlock[w.blockPos]
+	r2 := w.currentBlockBeforePostGateMix[w.blockPos]
 
 	// 🚨 УДАЛЕНЫ дорогие вызовы: PassThroughGates и MixByte.
 	// Вся их работа выполнена один раз в refillBlock.
 
 	w.OffsetSum += int(r1)
-	w.currentBlock = w.currentBlock[1:]
-	w.currentBlockBeforePostGateMix = w.currentBlockBeforePostGateMix[1:]
+	w.blockPos++
 
 	w.N++
 
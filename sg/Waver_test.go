@@ -0,0 +1,160 @@
+package sg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// preRework holds SHA-256 digests of the first 4096 keystream bytes of the
+// [][]byte Waver, as it was before the rework around fixed-size arrays,
+// in the only mix it had, MixXXH3. The reworked core must reproduce them.
+var preRework = []struct {
+	key    string
+	nonce  string
+	legacy bool
+	digest string
+}{
+	{"StarGate KAT key 1", "000102030405060708090a0b0c0d0e0f", false, "401a364047e7d893eeff3fc824b3e1cf5dbd643d2791859b8bf59f891ce77de6"},
+	{"StarGate KAT key 1", "ffffffffffffffffffffffffffffffff", false, "0ae688fb6bef9584bb37ddb617baa5ef2930f1baba127dac3c3ea2cadb105916"},
+	{"StarGate KAT key 1", "00000000000000000000000000000000", false, "f7a1268eb1d3387f69ef5b2bd89a7a59edd73ef97e5287ee331d8e865d1204d2"},
+	{"StarGate KAT key 1", "0123456789abcdef", true, "76801661b84658a7efe4f8fccd4efc2b048b95b7473f178b3ced176428f0607e"},
+	{"StarGate KAT key 2", "000102030405060708090a0b0c0d0e0f", false, "1fa3277247a8f4f21722b1151195cbbfd693426e9590b6fd4d918b330a8abc0a"},
+	{"StarGate KAT key 2", "ffffffffffffffffffffffffffffffff", false, "71e500e98eac215718cfa6348dca3a77ccc1727f50e8ed61bb11cc3072be4c63"},
+	{"StarGate KAT key 2", "00000000000000000000000000000000", false, "1468199c1510dfcc625537b57d50e8f057c6ef5df45a88faa1019684201f13ee"},
+	{"StarGate KAT key 2", "0123456789abcdef", true, "7554d8800b4b574ee045cd665920a36805b1666abc779d6118b876e4ecf7a622"},
+	{"pre-rework key 3", "000102030405060708090a0b0c0d0e0f", false, "6e2b2de378c91f16e861c4d162d37101abf46d6c12b16b0e9211eaead15a0204"},
+	{"pre-rework key 3", "ffffffffffffffffffffffffffffffff", false, "3eebe98ad144769104d3f438664086d1e0be0015ae15fb71005668c3a7dc0cd1"},
+	{"pre-rework key 3", "00000000000000000000000000000000", false, "fc239ba303a07da0c1f260b8f1ba911857636ec297f97f3b64f2efbd0ab8b8fa"},
+	{"pre-rework key 3", "0123456789abcdef", true, "80e7f92f942786e3d848ba62f2350540da16151cc8f2b1f3f9ab3b4b4709d65f"},
+	{"pre-rework key 4 with a somewhat longer passphrase", "000102030405060708090a0b0c0d0e0f", false, "5db6fe69f4d29970f4bf80c6ab4806d4ed470b022aab4e44ccd252a1e6bb58dc"},
+	{"pre-rework key 4 with a somewhat longer passphrase", "ffffffffffffffffffffffffffffffff", false, "37deed2a441d283e19d5eb6db7ce21b5b16d711c017757235328d44e8d3f023d"},
+	{"pre-rework key 4 with a somewhat longer passphrase", "00000000000000000000000000000000", false, "8bb30aebbbf3865c3859ee7343790cba7a1c7b4539d347d8f5f414b7137e3d23"},
+	{"pre-rework key 4 with a somewhat longer passphrase", "0123456789abcdef", true, "6c5619afc8d99f5f94d13900b3dfbfe3e90e6b4aadf03fd9259e4ce81ede43f8"},
+}
+
+func TestPreReworkOutput(t *testing.T) {
+	for _, tt := range preRework {
+		nonce, err := ParseNonce(tt.nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := []Option{WithMix(MixXXH3)}
+		if tt.legacy {
+			opts = append(opts, WithLegacyNonceSchedule())
+		}
+
+		w, err := NewWaver(KeyFromString(tt.key), nonce, false, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, knownAnswerLen)
+		for i := range out {
+			out[i] = w.GetNext()
+		}
+		w.Close()
+
+		if sum := sha256.Sum256(out); hex.EncodeToString(sum[:]) != tt.digest {
+			t.Errorf("key %q nonce %s: digest %x, want %s", tt.key, tt.nonce, sum, tt.digest)
+		}
+	}
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, ka := range KnownAnswers {
+		if err := ka.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func testWaver(t testing.TB, opts ...Option) *Waver {
+	w, err := NewWaver(KeyFromString("StarGate test key"), Nonce{0: 1, 15: 1}, false, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Close)
+	return w
+}
+
+func TestWaverAllocs(t *testing.T) {
+	for _, mix := range []Mix{MixStarGate, MixXXH3} {
+		w := testWaver(t, WithMix(mix))
+		buf := make([]byte, 4*BlockSize)
+
+		for name, f := range map[string]func(){
+			"refillBlock":    func() { w.blockPos = BlockSize; w.refillBlock() },
+			"GetNext":        func() { w.GetNext() },
+			"Read":           func() { w.Read(buf) },
+			"XORCross":       func() { w.XORCross(3, 11) },
+			"ReinitFromHash": w.ReinitFromHash,
+		} {
+			if n := testing.AllocsPerRun(100, f); n != 0 {
+				t.Errorf("mix %s: %s allocates %v times per call, want 0", mix, name, n)
+			}
+		}
+	}
+}
+
+func BenchmarkRefillBlock(b *testing.B) {
+	w := testWaver(b)
+	b.SetBytes(BlockSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w.blockPos = BlockSize
+		w.refillBlock()
+	}
+}
+
+func BenchmarkWaverRead(b *testing.B) {
+	w := testWaver(b)
+	buf := make([]byte, 64*1024)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w.Read(buf)
+	}
+}
+
+// TestWaverClose checks that Close wipes the state and that a closed Waver
+// panics instead of producing a stream independent of the key.
+func TestWaverClose(t *testing.T) {
+	key := KeyFromString("StarGate close check key")
+	defer key.Destroy()
+
+	w, err := NewWaver(key, Nonce{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.GetNext() // stop in the middle of a block
+	w.Close()
+
+	if w.Matrix != [16][16]byte{} || w.Gates != [16]MatrixGate{} || w.currentBlock != [BlockSize]byte{} {
+		t.Error("Close left generator state behind")
+	}
+	for _, b := range w.LastPool.State {
+		if b != 0 {
+			t.Fatal("Close left the pool behind")
+		}
+	}
+
+	reads := map[string]func(){
+		"GetNext":           func() { w.GetNext() },
+		"Read":              func() { w.Read(make([]byte, 1)) },
+		"GetNext_CORR_TEST": func() { w.GetNext_CORR_TEST() },
+	}
+	for name, read := range reads {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s after Close did not panic", name)
+				}
+			}()
+			read()
+		}()
+	}
+}
@@ -0,0 +1,159 @@
+package sg
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// AEADOverhead is the length of the tag Seal appends.
+const AEADOverhead = MACSize
+
+var ErrOpen = errors.New("sg: message authentication failed")
+
+// AEAD is authenticated encryption with associated data, encrypt-then-MAC:
+// the plaintext is XORed with the keystream of a Waver keyed with the
+// encryption subkey and the nonce, and the StarGate MAC under the
+// authentication subkey covers the nonce, the associated data and the
+// ciphertext, each length-prefixed. Both subkeys are HKDF-SHA512 of the
+// key. It implements crypto/cipher.AEAD with 16-byte nonces.
+//
+// Every Seal sets up a new Waver, so AEAD suits short messages and
+// handshakes rather than bulk data. A nonce must never repeat under a key.
+type AEAD struct {
+	encKey *Key
+	mix    Mix
+	mu     sync.Mutex
+	mac    *MAC
+}
+
+// NewAEAD returns an AEAD under key. Of opts only WithMix applies, to both
+// the keystream and the MAC.
+func NewAEAD(key *Key, opts ...Option) (*AEAD, error) {
+	if key == nil || key.Len() == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	mix := newOptions(opts).mix
+	encKey := aeadSubkey(key, "StarGate AEAD encryption")
+	macKey := aeadSubkey(key, "StarGate AEAD authentication")
+	defer macKey.Destroy()
+
+	mac, err := NewMAC(macKey, WithMix(mix))
+	if err != nil {
+		encKey.Destroy()
+		return nil, err
+	}
+
+	return &AEAD{encKey: encKey, mix: mix, mac: mac}, nil
+}
+
+func aeadSubkey(key *Key, info string) *Key {
+	var b [64]byte
+	io.ReadFull(hkdf.New(sha512.New, key.Bytes(), nil, []byte(info)), b[:])
+	k := NewKey(b[:])
+	wipe(b[:])
+	return k
+}
+
+func (a *AEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *AEAD) Overhead() int {
+	return AEADOverhead
+}
+
+// Seal appends the ciphertext and tag of plaintext to dst.
+func (a *AEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	n := a.nonce(nonce)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+AEADOverhead)
+	ct := out[:len(plaintext)]
+
+	a.xor(n, ct, plaintext)
+	copy(out[len(plaintext):], a.tag(n, additionalData, ct))
+
+	return ret
+}
+
+// Open checks and decrypts ciphertext and appends the plaintext to dst.
+func (a *AEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	n := a.nonce(nonce)
+
+	if len(ciphertext) < AEADOverhead {
+		return nil, ErrOpen
+	}
+	ct, tag := ciphertext[:len(ciphertext)-AEADOverhead], ciphertext[len(ciphertext)-AEADOverhead:]
+
+	if subtle.ConstantTimeCompare(a.tag(n, additionalData, ct), tag) != 1 {
+		return nil, ErrOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ct))
+	a.xor(n, out, ct)
+	return ret, nil
+}
+
+// Close wipes the subkeys. The AEAD must not be used afterwards.
+func (a *AEAD) Close() {
+	a.encKey.Destroy()
+	a.mac.Close()
+}
+
+func (a *AEAD) nonce(nonce []byte) Nonce {
+	if len(nonce) != NonceSize {
+		panic("sg: incorrect nonce length given to AEAD")
+	}
+
+	var n Nonce
+	copy(n[:], nonce)
+	return n
+}
+
+func (a *AEAD) xor(nonce Nonce, dst, src []byte) {
+	w, err := newWaver(a.encKey, nonce, false, options{mix: a.mix})
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	for i := range src {
+		dst[i] = src[i] ^ w.GetNext()
+	}
+}
+
+func (a *AEAD) tag(nonce Nonce, ad, ct []byte) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var lens [8]byte
+	a.mac.Reset()
+	a.mac.Write(nonce[:])
+	binary.BigEndian.PutUint64(lens[:], uint64(len(ad)))
+	a.mac.Write(lens[:])
+	a.mac.Write(ad)
+	binary.BigEndian.PutUint64(lens[:], uint64(len(ct)))
+	a.mac.Write(lens[:])
+	a.mac.Write(ct)
+
+	return a.mac.Sum(nil)
+}
+
+// sliceForAppend extends in by n bytes and returns the whole slice and the
+// new tail, reusing capacity like the standard library AEADs do.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,37 @@
+package sg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestAEADKnownAnswers seals every AEADKnownAnswers plaintext and opens
+// the result again.
+func TestAEADKnownAnswers(t *testing.T) {
+	for _, ka := range AEADKnownAnswers {
+		nonce, err := ParseNonce(ka.Nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key := KeyFromString(ka.Key)
+		a, err := NewAEAD(key, WithMix(ka.Mix))
+		key.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, _ := hex.DecodeString(ka.Sealed)
+		sealed := a.Seal(nil, nonce[:], []byte(ka.Plaintext), []byte(ka.AD))
+		if !bytes.Equal(sealed, want) {
+			t.Errorf("key %q plaintext of %d bytes mix %s: got %x", ka.Key, len(ka.Plaintext), ka.Mix, sealed)
+		}
+
+		opened, err := a.Open(nil, nonce[:], want, []byte(ka.AD))
+		if err != nil || string(opened) != ka.Plaintext {
+			t.Errorf("key %q plaintext of %d bytes mix %s: does not open: %v", ka.Key, len(ka.Plaintext), ka.Mix, err)
+		}
+		a.Close()
+	}
+}
@@ -0,0 +1,228 @@
+// Package analysis has statistical checks for StarGate primitives. They
+// catch gross structural defects such as biased bits or too many collisions
+// in truncated outputs; passing them says nothing about security.
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// MaxBits bounds the truncated output size, as one counter per possible
+// value is kept.
+const MaxBits = 24
+
+// Threshold is how many standard deviations from the expected value a
+// statistic may be off before it is reported as suspicious.
+const Threshold = 5.0
+
+type OutputReport struct {
+	Samples int
+	Bits    int
+	// ChiSquare tests the truncated outputs for uniformity over 2^Bits
+	// buckets. ChiSquareZ is its normal approximation.
+	ChiSquare  float64
+	ChiSquareZ float64
+	// Collisions counts pairs of samples with equal truncated outputs.
+	Collisions         int
+	ExpectedCollisions float64
+	// MaxBitZ is the largest deviation of any single output bit from a
+	// fair coin, in standard deviations.
+	MaxBitZ   float64
+	MaxBitPos int
+}
+
+// Outputs feeds f the counters 0..n-1 as 8-byte little-endian messages,
+// which are about as structured as inputs get, and checks its outputs
+// truncated to their first bits.
+func Outputs(f func(msg []byte) []byte, n, bits int) (OutputReport, error) {
+	if bits < 1 || bits > MaxBits {
+		return OutputReport{}, fmt.Errorf("bits must be between 1 and %d", MaxBits)
+	}
+	if n < 2 {
+		return OutputReport{}, fmt.Errorf("at least 2 samples are needed")
+	}
+
+	r := OutputReport{Samples: n, Bits: bits}
+	buckets := make([]uint32, 1<<bits)
+	var ones []int
+
+	var msg [8]byte
+	for i := range n {
+		binary.LittleEndian.PutUint64(msg[:], uint64(i))
+		out := f(msg[:])
+
+		if len(out)*8 < bits {
+			return OutputReport{}, fmt.Errorf("output of %d bytes is shorter than %d bits", len(out), bits)
+		}
+		buckets[truncate(out, bits)]++
+
+		if ones == nil {
+			ones = make([]int, len(out)*8)
+		}
+		for bit := range ones {
+			if bit/8 < len(out) && out[bit/8]>>(7-bit%8)&1 == 1 {
+				ones[bit]++
+			}
+		}
+	}
+
+	expected := float64(n) / float64(len(buckets))
+	for _, c := range buckets {
+		d := float64(c) - expected
+		r.ChiSquare += d * d / expected
+		r.Collisions += int(c) * (int(c) - 1) / 2
+	}
+
+	df := float64(len(buckets) - 1)
+	r.ChiSquareZ = (r.ChiSquare - df) / math.Sqrt(2*df)
+	r.ExpectedCollisions = float64(n) * float64(n-1) / 2 / float64(len(buckets))
+
+	sd := math.Sqrt(float64(n) / 4)
+	for bit, c := range ones {
+		z := math.Abs(float64(c)-float64(n)/2) / sd
+		if z > r.MaxBitZ {
+			r.MaxBitZ, r.MaxBitPos = z, bit
+		}
+	}
+
+	return r, nil
+}
+
+// truncate returns the first bits of b, most significant bit first.
+func truncate(b []byte, bits int) uint32 {
+	var v uint32
+	for i := 0; i < (bits+7)/8; i++ {
+		v = v<<8 | uint32(b[i])
+	}
+	return v >> ((8 - bits%8) % 8)
+}
+
+// Suspicious lists the statistics that are off by more than Threshold
+// standard deviations. The chi-square test is skipped with fewer samples
+// than buckets, where its normal approximation does not hold.
+func (r OutputReport) Suspicious() []string {
+	var out []string
+
+	if float64(r.Samples) >= math.Exp2(float64(r.Bits)) && math.Abs(r.ChiSquareZ) > Threshold {
+		out = append(out, fmt.Sprintf("truncated outputs are not uniform (chi-square z = %.2f)", r.ChiSquareZ))
+	}
+
+	// Collisions are roughly Poisson distributed.
+	if sd := math.Sqrt(r.ExpectedCollisions); sd > 0 && math.Abs(float64(r.Collisions)-r.ExpectedCollisions) > Threshold*sd+1 {
+		out = append(out, fmt.Sprintf("%d collisions, %.1f expected", r.Collisions, r.ExpectedCollisions))
+	}
+
+	// The maximum over all bits is expected to reach 3-4 on its own.
+	if r.MaxBitZ > Threshold {
+		out = append(out, fmt.Sprintf("output bit %d is biased (z = %.2f)", r.MaxBitPos, r.MaxBitZ))
+	}
+
+	return out
+}
+
+type AvalancheReport struct {
+	Samples    int
+	InputBits  int
+	OutputBits int
+	// Mean is the average fraction of output bits that flip when one input
+	// bit flips; 0.5 is ideal. MinMean and MaxMean are the extremes over
+	// input bit positions, WorstInputBit the position furthest from 0.5.
+	Mean          float64
+	MinMean       float64
+	MaxMean       float64
+	WorstInputBit int
+	// MaxSACZ is the largest deviation, in standard deviations, of the
+	// probability that a given output bit flips for a given input bit from
+	// 1/2 (strict avalanche criterion).
+	MaxSACZ float64
+}
+
+// Avalanche flips every bit of samples random-looking messages of msgLen
+// bytes one at a time and measures which output bits change. next fills in
+// each message; a seeded generator makes runs reproducible.
+func Avalanche(f func(msg []byte) []byte, msgLen, samples int, next func([]byte)) (AvalancheReport, error) {
+	if msgLen < 1 || samples < 1 {
+		return AvalancheReport{}, fmt.Errorf("message length and samples must be positive")
+	}
+
+	inBits := msgLen * 8
+	r := AvalancheReport{Samples: samples, InputBits: inBits}
+
+	var flips [][]int
+	msg := make([]byte, msgLen)
+
+	for range samples {
+		next(msg)
+		base := append([]byte(nil), f(msg)...)
+
+		if flips == nil {
+			r.OutputBits = len(base) * 8
+			flips = make([][]int, inBits)
+			for i := range flips {
+				flips[i] = make([]int, r.OutputBits)
+			}
+		}
+
+		for in := range inBits {
+			msg[in/8] ^= 1 << (7 - in%8)
+			out := f(msg)
+			msg[in/8] ^= 1 << (7 - in%8)
+
+			for o := range r.OutputBits {
+				if (out[o/8]^base[o/8])>>(7-o%8)&1 == 1 {
+					flips[in][o]++
+				}
+			}
+		}
+	}
+
+	n := float64(samples)
+	sd := math.Sqrt(n / 4)
+	r.MinMean = 1
+
+	var total, worst float64
+	for in, row := range flips {
+		var sum int
+		for _, c := range row {
+			sum += c
+			if z := math.Abs(float64(c)-n/2) / sd; z > r.MaxSACZ {
+				r.MaxSACZ = z
+			}
+		}
+
+		mean := float64(sum) / n / float64(r.OutputBits)
+		total += mean
+		r.MinMean = min(r.MinMean, mean)
+		r.MaxMean = max(r.MaxMean, mean)
+
+		if dev := math.Abs(mean - 0.5); dev > worst {
+			worst, r.WorstInputBit = dev, in
+		}
+	}
+	r.Mean = total / float64(inBits)
+
+	return r, nil
+}
+
+// Suspicious lists avalanche statistics that are off by more than Threshold
+// standard deviations.
+func (r AvalancheReport) Suspicious() []string {
+	var out []string
+
+	// A per-input-bit mean is the average of samples*OutputBits coin flips.
+	sd := 0.5 / math.Sqrt(float64(r.Samples*r.OutputBits))
+	if math.Abs(r.MinMean-0.5) > Threshold*sd || math.Abs(r.MaxMean-0.5) > Threshold*sd {
+		out = append(out, fmt.Sprintf("input bit %d flips too few or too many output bits (range %.4f-%.4f)", r.WorstInputBit, r.MinMean, r.MaxMean))
+	}
+
+	// With InputBits*OutputBits cells the maximum alone is expected near
+	// sqrt(2 ln cells), so allow for that.
+	cells := float64(r.InputBits * r.OutputBits)
+	if limit := math.Sqrt(2*math.Log(cells)) + 2; r.MaxSACZ > max(limit, Threshold) {
+		out = append(out, fmt.Sprintf("strict avalanche criterion violated (max z = %.2f)", r.MaxSACZ))
+	}
+
+	return out
+}
@@ -0,0 +1,605 @@
+package sg
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Archive layout:
+//
+//	container header, Kind KindArchive, with key ID and commitment
+//	chunks: ciphertext(archiveChunkSize) | tag(32)
+//	last chunk: ciphertext(0 to archiveChunkSize) | tag(32)
+//
+// The payload, the optionally compressed tar stream, is cut into chunks of
+// archiveChunkSize bytes. Chunk i is sealed with AEAD under the archive key
+// and the nonce header nonce + i, with the associated data
+//
+//	i(8) | final(1) | SHA-256 of the header
+//
+// where final is 1 for the last chunk and 0 for all others. A chunk that
+// is changed, moved or dropped fails authentication, and so does an
+// archive cut short at a chunk boundary, as its new last chunk was not
+// sealed as final. The header hash binds the compression and the rest of
+// the header to the payload.
+
+const archiveChunkSize = 64 * 1024
+
+var ErrArchiveCorrupt = errors.New("archive failed authentication: it was changed or cut short")
+
+func archiveAD(index uint64, final bool, header *[sha256.Size]byte) []byte {
+	ad := make([]byte, 0, 9+len(header))
+	ad = binary.BigEndian.AppendUint64(ad, index)
+	if final {
+		ad = append(ad, 1)
+	} else {
+		ad = append(ad, 0)
+	}
+	return append(ad, header[:]...)
+}
+
+// chunkWriter seals what is written to it in chunks. Close seals the last
+// chunk, which may be empty.
+type chunkWriter struct {
+	w      io.Writer
+	aead   *AEAD
+	nonce  Nonce
+	index  uint64
+	header [sha256.Size]byte
+	buf    []byte
+	sealed []byte
+}
+
+func newChunkWriter(w io.Writer, aead *AEAD, nonce Nonce, header []byte) *chunkWriter {
+	return &chunkWriter{
+		w:      w,
+		aead:   aead,
+		nonce:  nonce,
+		header: sha256.Sum256(header),
+		buf:    make([]byte, 0, archiveChunkSize),
+	}
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, since
+		// until then it may be the last.
+		if len(w.buf) == archiveChunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):archiveChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) seal(final bool) error {
+	n := w.nonce.Add(w.index)
+	w.sealed = w.aead.Seal(w.sealed[:0], n[:], w.buf, archiveAD(w.index, final, &w.header))
+	if _, err := w.w.Write(w.sealed); err != nil {
+		return err
+	}
+	w.index++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (w *chunkWriter) Close() error {
+	return w.seal(true)
+}
+
+// chunkReader opens the chunks written by chunkWriter. It returns
+// io.EOF only after the last chunk has been authenticated.
+type chunkReader struct {
+	r      *bufio.Reader
+	aead   *AEAD
+	nonce  Nonce
+	index  uint64
+	header [sha256.Size]byte
+	sealed []byte
+	plain  []byte
+	rest   []byte
+	done   bool
+	err    error
+}
+
+func newChunkReader(r io.Reader, aead *AEAD, nonce Nonce, header []byte) *chunkReader {
+	return &chunkReader{
+		r:      bufio.NewReaderSize(r, archiveChunkSize),
+		aead:   aead,
+		nonce:  nonce,
+		header: sha256.Sum256(header),
+		sealed: make([]byte, archiveChunkSize+AEADOverhead),
+	}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.rest) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+func (r *chunkReader) next() error {
+	n, err := io.ReadFull(r.r, r.sealed)
+	final := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		final = true
+	case err == io.EOF:
+		// The previous chunk was full and not sealed as final.
+		return fmt.Errorf("%w: chunk %d is missing", ErrArchiveCorrupt, r.index)
+	case err != nil:
+		return err
+	default:
+		if _, err := r.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < AEADOverhead {
+		return fmt.Errorf("%w: chunk %d is cut short", ErrArchiveCorrupt, r.index)
+	}
+
+	nonce := r.nonce.Add(r.index)
+	r.plain, err = r.aead.Open(r.plain[:0], nonce[:], r.sealed[:n], archiveAD(r.index, final, &r.header))
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", ErrArchiveCorrupt, r.index)
+	}
+	r.rest = r.plain
+	r.index++
+	r.done = final
+	return nil
+}
+
+type ArchiveOptions struct {
+	// Include and Exclude are path.Match patterns checked against both the
+	// slash-separated path relative to the archive root and the base name.
+	// An empty Include matches every file. Exclude wins over Include, and an
+	// excluded directory is skipped entirely.
+	Include []string
+	Exclude []string
+
+	// Compression and CompressionLevel apply on create only, extraction
+	// takes the algorithm from the container header.
+	Compression      Compression
+	CompressionLevel int
+}
+
+type ArchiveEntry struct {
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime int64
+	IsDir   bool
+	Link    string
+}
+
+func matchAny(patterns []string, rel string) (bool, error) {
+	for _, p := range patterns {
+		for _, name := range []string{rel, path.Base(rel)} {
+			ok, err := path.Match(p, name)
+			if err != nil {
+				return false, fmt.Errorf("bad pattern %q: %w", p, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// outputFiles returns the files w writes to: its own if it is a file, and
+// for an AtomicFile also the one it replaces on Commit.
+func outputFiles(w io.Writer) []os.FileInfo {
+	var infos []os.FileInfo
+	if f, ok := w.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	if f, ok := w.(*AtomicFile); ok {
+		if info, err := os.Stat(f.path); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+func isOutput(outputs []os.FileInfo, info os.FileInfo) bool {
+	for _, o := range outputs {
+		if os.SameFile(o, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateArchive writes dir as a tar stream sealed with the key of c into w,
+// prefixed with a container header of kind KindArchive. File modes
+// and modification times are preserved. If w is a file inside dir, or an
+// AtomicFile replacing one, the archive leaves that file out.
+func (c *Cipher) CreateArchive(dir string, w io.Writer, opts ArchiveOptions) error {
+	h := &Header{Kind: KindArchive, Nonce: c.Nonce, Compression: opts.Compression, Mix: c.opts.mix}
+	h.commit(c.key)
+	raw, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+
+	aead, err := NewAEAD(c.key, WithMix(c.opts.mix))
+	if err != nil {
+		return err
+	}
+	defer aead.Close()
+
+	buf := newChunkWriter(w, aead, h.Nonce, raw)
+	zw, err := compressWriter(buf, opts.Compression, opts.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	outputs := outputFiles(w)
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		excluded, err := matchAny(opts.Exclude, rel)
+		if err != nil {
+			return err
+		}
+		if excluded {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.IsDir() && len(opts.Include) > 0 {
+			included, err := matchAny(opts.Include, rel)
+			if err != nil {
+				return err
+			}
+			if !included {
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			// Devices, sockets and pipes have no meaningful content to back up.
+			return nil
+		} else if isOutput(outputs, info) {
+			// The archive itself, when it is written inside dir.
+			return nil
+		}
+
+		th, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		th.Name = rel
+		if info.IsDir() {
+			th.Name += "/"
+		}
+		th.Format = tar.FormatPAX
+
+		if err := tw.WriteHeader(th); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return buf.Close()
+}
+
+// archiveReader is the tar stream of an opened archive.
+type archiveReader struct {
+	*tar.Reader
+	zr      io.Reader
+	payload io.Reader
+	aead    *AEAD
+}
+
+// finish reads the payload to its end, so that the archive is
+// authenticated up to its final chunk even where the tar stream stopped
+// early.
+func (a *archiveReader) finish() error {
+	if _, err := io.Copy(io.Discard, a.zr); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, a.payload)
+	return err
+}
+
+func (a *archiveReader) close() {
+	a.aead.Close()
+}
+
+func (c *Cipher) openArchive(r io.Reader) (*archiveReader, error) {
+	var raw bytes.Buffer
+	h, err := ReadHeader(io.TeeReader(r, &raw))
+	if err != nil {
+		return nil, err
+	}
+	if h.Kind != KindArchive {
+		return nil, errors.New("container is not an archive")
+	}
+	if err := h.CheckKey(c.key); err != nil {
+		return nil, err
+	}
+
+	aead, err := NewAEAD(c.key, WithMix(h.Mix))
+	if err != nil {
+		return nil, err
+	}
+	a := &archiveReader{aead: aead}
+	a.payload = newChunkReader(r, a.aead, h.Nonce, raw.Bytes())
+
+	if a.zr, err = decompressReader(a.payload, h.Compression); err != nil {
+		a.close()
+		return nil, errors.New("failed to decompress: " + err.Error())
+	}
+	a.Reader = tar.NewReader(a.zr)
+	return a, nil
+}
+
+// ListArchive returns the entries of the archive read from r. Nothing is
+// written to disk. The archive is read and authenticated to its end.
+func (c *Cipher) ListArchive(r io.Reader) ([]ArchiveEntry, error) {
+	tr, err := c.openArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.close()
+
+	var entries []ArchiveEntry
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupt archive or wrong key: %w", err)
+		}
+
+		entries = append(entries, ArchiveEntry{
+			Name:    th.Name,
+			Size:    th.Size,
+			Mode:    th.FileInfo().Mode(),
+			ModTime: th.ModTime.Unix(),
+			IsDir:   th.Typeflag == tar.TypeDir,
+			Link:    th.Linkname,
+		})
+	}
+
+	if err := tr.finish(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// checkNoLinks returns an error if a directory on the way from dest to the
+// entry rel, or the entry itself, is a symbolic link. Links in the archive
+// are only checked lexically when created, and a chain of them can still
+// lead outside dest, so nothing is ever written through one.
+func checkNoLinks(dest, rel string) error {
+	p := dest
+	for _, name := range strings.Split(rel, "/") {
+		p = filepath.Join(p, name)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q would be written through the link %s", rel, p)
+		}
+	}
+	return nil
+}
+
+// ExtractArchive restores the archive read from r under dest. Entries that
+// would land outside dest, or be written through a symbolic link, are
+// rejected. The archive is authenticated chunk by chunk as it is read, so
+// only authenticated data is written; an archive cut short fails
+// at its end, after the entries before the cut have been restored.
+func (c *Cipher) ExtractArchive(r io.Reader, dest string, opts ArchiveOptions) error {
+	tr, err := c.openArchive(r)
+	if err != nil {
+		return err
+	}
+	defer tr.close()
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	type dirTime struct {
+		path string
+		th   *tar.Header
+	}
+	var dirs []dirTime
+
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt archive or wrong key: %w", err)
+		}
+
+		rel := strings.TrimSuffix(th.Name, "/")
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return fmt.Errorf("archive entry %q escapes destination", th.Name)
+		}
+
+		excluded, err := matchAny(opts.Exclude, rel)
+		if err != nil {
+			return err
+		}
+		if excluded {
+			continue
+		}
+		if th.Typeflag != tar.TypeDir && len(opts.Include) > 0 {
+			included, err := matchAny(opts.Include, rel)
+			if err != nil {
+				return err
+			}
+			if !included {
+				continue
+			}
+		}
+
+		switch th.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+			if err := checkNoLinks(dest, rel); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		mode := th.FileInfo().Mode().Perm()
+
+		switch th.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{target, th})
+			continue
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// A link pointing outside dest is refused outright, even though
+			// checkNoLinks keeps later entries from being written through it.
+			resolved := path.Join(path.Dir(rel), th.Linkname)
+			if path.IsAbs(th.Linkname) || !filepath.IsLocal(filepath.FromSlash(resolved)) {
+				return fmt.Errorf("archive link %q points outside destination", th.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(th.Linkname, target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, th.AccessTime, th.ModTime); err != nil {
+			return err
+		}
+	}
+
+	if err := tr.finish(); err != nil {
+		return err
+	}
+
+	// Directory times are restored last, since creating their children
+	// updates them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.th.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.path, d.th.AccessTime, d.th.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
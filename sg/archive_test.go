@@ -0,0 +1,60 @@
+package sg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestArchiveOwnOutput archives a directory into itself, over an earlier
+// archive of the same name: neither the temporary file being written nor
+// the archive it replaces may end up inside.
+func TestArchiveOwnOutput(t *testing.T) {
+	key := KeyFromString("StarGate archive check key")
+	defer key.Destroy()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.sga")
+
+	for range 2 {
+		c, err := NewCipher(key, Nonce{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := CreateAtomic(out, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.CreateArchive(dir, f, ArchiveOptions{})
+		if err == nil {
+			err = f.Commit()
+		}
+		f.Abort()
+		c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	c, err := NewCipher(key, Nonce{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	entries, err := c.ListArchive(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "a" {
+		t.Errorf("archive holds %v, want only a", entries)
+	}
+}
@@ -0,0 +1,138 @@
+package sg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is a temporary file in the directory of its final path. Nothing
+// appears at the final path until Commit, which fsyncs the data and renames
+// it into place, so a crash or error midway never leaves a half-written
+// output or damages a file that is being replaced.
+type AtomicFile struct {
+	*os.File
+	path      string
+	done      bool
+	noReplace bool
+}
+
+func CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	return createAtomic(path, perm, false)
+}
+
+// CreateAtomicNew is CreateAtomic for a file that must not exist yet: if
+// path exists by the time of Commit, Commit fails with an error wrapping
+// os.ErrExist and leaves it alone. The check is part of putting the file in
+// place, so nothing created in between is overwritten either.
+func CreateAtomicNew(path string, perm os.FileMode) (*AtomicFile, error) {
+	return createAtomic(path, perm, true)
+}
+
+func createAtomic(path string, perm os.FileMode, noReplace bool) (*AtomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &AtomicFile{File: f, path: path, noReplace: noReplace}, nil
+}
+
+func (f *AtomicFile) Commit() error {
+	if f.done {
+		return os.ErrClosed
+	}
+	f.done = true
+
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	if err := f.place(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	// Persist the rename itself. Not every platform can sync a directory,
+	// the data is already safe at this point, so errors are ignored.
+	if dir, err := os.Open(filepath.Dir(f.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// place moves the temporary file to its final path.
+func (f *AtomicFile) place() error {
+	if !f.noReplace {
+		return os.Rename(f.File.Name(), f.path)
+	}
+
+	// A hard link fails rather than replace an existing file.
+	err := os.Link(f.File.Name(), f.path)
+	if err == nil {
+		return os.Remove(f.File.Name())
+	}
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("output file %q already exists: %w", f.path, os.ErrExist)
+	}
+
+	// Not every file system has hard links. Claim the path with an
+	// exclusive create instead and rename over the claimed file.
+	claim, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("output file %q already exists: %w", f.path, os.ErrExist)
+		}
+		return err
+	}
+	claim.Close()
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.path)
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary file. It is a no-op after Commit, so it can
+// be deferred right after CreateAtomic.
+func (f *AtomicFile) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
+
+// SameFile reports whether a and b refer to the same existing file, also
+// through links and different spellings of the path.
+func SameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(ai, bi)
+}
@@ -0,0 +1,156 @@
+package sg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAtomic(t *testing.T, f *AtomicFile, data string) {
+	t.Helper()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestAtomicCommit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := CreateAtomic(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAtomic(t, f, "new")
+	if got := readString(t, path); got != "old" {
+		t.Errorf("before Commit the file holds %q", got)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second Commit: got %v, want %v", err, os.ErrClosed)
+	}
+	if err := f.Abort(); err != nil {
+		t.Errorf("Abort after Commit: %v", err)
+	}
+
+	if got := readString(t, path); got != "new" {
+		t.Errorf("file holds %q, want new", got)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode %v, %v", info.Mode(), err)
+	}
+	onlyFiles(t, dir, "out")
+}
+
+func TestAtomicAbort(t *testing.T) {
+	dir := t.TempDir()
+	f, err := CreateAtomic(filepath.Join(dir, "out"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAtomic(t, f, "data")
+	if err := f.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	onlyFiles(t, dir)
+}
+
+// TestAtomicNew creates the output after CreateAtomicNew, as another
+// process might between the check for it and Commit. Commit must leave it
+// alone.
+func TestAtomicNew(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+
+	f, err := CreateAtomicNew(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAtomic(t, f, "new")
+	if err := os.WriteFile(path, []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Commit(); !errors.Is(err, os.ErrExist) {
+		t.Errorf("got %v, want %v", err, os.ErrExist)
+	}
+	if got := readString(t, path); got != "other" {
+		t.Errorf("file holds %q, want other", got)
+	}
+	onlyFiles(t, dir, "out")
+
+	// Without the race it is an ordinary atomic file.
+	path = filepath.Join(dir, "fresh")
+	if f, err = CreateAtomicNew(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeAtomic(t, f, "new")
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, path); got != "new" {
+		t.Errorf("file holds %q, want new", got)
+	}
+	onlyFiles(t, dir, "fresh", "out")
+}
+
+func TestEncryptFileNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	if err := os.WriteFile(in, []byte("plain"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := KeyFromString("StarGate atomic check key")
+	defer key.Destroy()
+
+	c, err := NewCipher(key, Nonce{}, false, WithNoReplace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.EncryptFile(in, out); !errors.Is(err, os.ErrExist) {
+		t.Errorf("got %v, want %v", err, os.ErrExist)
+	}
+	if got := readString(t, out); got != "keep" {
+		t.Errorf("output holds %q, want keep", got)
+	}
+	onlyFiles(t, dir, "in", "out")
+}
+
+func TestSameFile(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	if err := os.WriteFile(a, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if !SameFile(a, filepath.Join(dir, ".", "a")) {
+		t.Error("a and ./a differ")
+	}
+	if SameFile(a, filepath.Join(dir, "b")) {
+		t.Error("a and a missing file are the same")
+	}
+	if err := os.Symlink(a, filepath.Join(dir, "link")); err == nil && !SameFile(a, filepath.Join(dir, "link")) {
+		t.Error("a and a link to it differ")
+	}
+}
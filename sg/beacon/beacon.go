@@ -0,0 +1,126 @@
+package beacon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"stargate/sg"
+	"strconv"
+	"time"
+)
+
+// Beacon emits the pulses of one log.
+type Beacon struct {
+	key  ed25519.PrivateKey
+	drbg *sg.DRBG
+	log  *Log
+	now  func() time.Time
+}
+
+// New continues the chain of log, signing with key and drawing output
+// from drbg.
+func New(key ed25519.PrivateKey, drbg *sg.DRBG, log *Log) *Beacon {
+	return &Beacon{key: key, drbg: drbg, log: log, now: time.Now}
+}
+
+// Next emits one pulse and appends it to the log. The hash of the previous
+// pulse goes into the DRBG as additional input.
+func (b *Beacon) Next() (*Pulse, error) {
+	p := &Pulse{Timestamp: b.now().UTC().Truncate(time.Millisecond)}
+
+	if last := b.log.Last(); last != nil {
+		p.Index = last.Index + 1
+		p.Previous = last.Hash()
+		// A clock that went back must not break the chain.
+		if p.Timestamp.Before(last.Timestamp) {
+			p.Timestamp = last.Timestamp
+		}
+	}
+
+	if err := b.drbg.Generate(p.Output[:], p.Previous[:]); err != nil {
+		return nil, err
+	}
+	p.sign(b.key)
+
+	if err := b.log.Append(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run emits a pulse at every multiple of interval until ctx is done, or
+// until count pulses when count > 0, and hands each to emit.
+func (b *Beacon) Run(ctx context.Context, interval time.Duration, count int, emit func(*Pulse) error) error {
+	if interval <= 0 {
+		return errors.New("beacon: interval must be positive")
+	}
+
+	for n := 0; count <= 0 || n < count; n++ {
+		now := b.now()
+		wait := now.Truncate(interval).Add(interval).Sub(now)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		p, err := b.Next()
+		if err != nil {
+			return err
+		}
+		if emit != nil {
+			if err := emit(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Handler serves the log:
+//
+//	GET /pulse/latest    the newest pulse
+//	GET /pulse/{index}   one pulse
+//	GET /pulses          the whole log as JSON lines
+//	GET /public-key      the verification key in hex
+func Handler(log *Log, pub ed25519.PublicKey) http.Handler {
+	mux := http.NewServeMux()
+
+	writePulse := func(w http.ResponseWriter, p *Pulse) {
+		if p == nil {
+			http.Error(w, "no such pulse", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+
+	mux.HandleFunc("GET /pulse/latest", func(w http.ResponseWriter, r *http.Request) {
+		writePulse(w, log.Last())
+	})
+	mux.HandleFunc("GET /pulse/{index}", func(w http.ResponseWriter, r *http.Request) {
+		i, err := strconv.ParseUint(r.PathValue("index"), 10, 64)
+		if err != nil {
+			http.Error(w, "index must be a number", http.StatusBadRequest)
+			return
+		}
+		writePulse(w, log.Pulse(i))
+	})
+	mux.HandleFunc("GET /pulses", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jsonl")
+		enc := json.NewEncoder(w)
+		for i, n := 0, log.Len(); i < n; i++ {
+			enc.Encode(log.Pulse(uint64(i)))
+		}
+	})
+	mux.HandleFunc("GET /public-key", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(hex.EncodeToString(pub) + "\n"))
+	})
+
+	return mux
+}
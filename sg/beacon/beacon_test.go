@@ -0,0 +1,193 @@
+package beacon
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"stargate/sg"
+	"testing"
+	"time"
+)
+
+// knownPulse is pulse 0 with a fixed key, time and output. Ed25519 is
+// deterministic, so its signature and hash pin the signed message format.
+var knownPulse = struct {
+	seed, signature, hash string
+}{
+	seed: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+	signature: "e8e8851c5d29a4b9fdf19119eab3808ae6e9ba7214652ad448ea2b7bcf183d8e" +
+		"398ef030c030f1c5187b1e48ab1ba86c3f504e13f9d73beab5e60f1abc11c702",
+	hash: "a9847037d9439dd416018ce96627df7d0224472617b16df0e0bb193564628524" +
+		"8de1de5144bda500b2847b82f627d666a817256c9d0e1d61670c4fdaf7d0b0ec",
+}
+
+func knownKey() ed25519.PrivateKey {
+	seed, _ := hex.DecodeString(knownPulse.seed)
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestKnownPulse(t *testing.T) {
+	p := &Pulse{Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for i := range p.Output {
+		p.Output[i] = byte(i)
+	}
+	p.sign(knownKey())
+
+	if got := hex.EncodeToString(p.Signature[:]); got != knownPulse.signature {
+		t.Errorf("signature: got %s, want %s", got, knownPulse.signature)
+	}
+	h := p.Hash()
+	if got := hex.EncodeToString(h[:]); got != knownPulse.hash {
+		t.Errorf("hash: got %s, want %s", got, knownPulse.hash)
+	}
+
+	// Through JSON and back it must still verify.
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q Pulse
+	if err := json.Unmarshal(data, &q); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Verify(knownKey().Public().(ed25519.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestChain builds a chain in a temporary log and checks that reopening
+// and serving it verify, and that a changed, dropped or torn pulse and a
+// wrong key are caught.
+func TestChain(t *testing.T) {
+	key := knownKey()
+	pub := key.Public().(ed25519.PublicKey)
+
+	path := filepath.Join(t.TempDir(), "pulses.jsonl")
+
+	log, err := OpenLog(path, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	drbg, err := sg.Instantiate([]byte("StarGate beacon test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drbg.Uninstantiate()
+
+	b := New(key, drbg, log)
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+
+	const pulses = 5
+	for range pulses {
+		if _, err := b.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Append refuses a pulse that does not continue the chain.
+	if err := log.Append(log.Pulse(1)); !errors.Is(err, ErrChain) {
+		t.Errorf("replayed pulse: got %v, want %v", err, ErrChain)
+	}
+
+	srv := httptest.NewServer(Handler(log, pub))
+	defer srv.Close()
+	served, err := httpVerify(srv.URL+"/pulses", pub)
+	if err != nil {
+		t.Fatalf("served log: %v", err)
+	}
+	if served.Index != pulses-1 {
+		t.Errorf("served log ends at pulse %d", served.Index)
+	}
+	log.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines = lines[:len(lines)-1]
+
+	if _, err := Verify(bytes.NewReader(data), pub); err != nil {
+		t.Fatal(err)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+
+	cases := []struct {
+		name string
+		data []byte
+		pub  ed25519.PublicKey
+		want error
+	}{
+		{"wrong key", data, otherPub, ErrSignature},
+		{"changed output", flipOutput(lines, 2), pub, ErrSignature},
+		{"dropped pulse", bytes.Join(append(append([][]byte{}, lines[:2]...), lines[3:]...), nil), pub, ErrChain},
+		{"torn last line", data[:len(data)-10], pub, ErrChain},
+	}
+	for _, c := range cases {
+		if _, err := Verify(bytes.NewReader(c.data), c.pub); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// OpenLog drops a torn last line and keeps the pulses before it.
+	if err := os.WriteFile(path, data[:len(data)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenLog(path, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != pulses-1 {
+		t.Errorf("reopened torn log has %d pulses, want %d", reopened.Len(), pulses-1)
+	}
+}
+
+// flipOutput changes one output digit of pulse i.
+func flipOutput(lines [][]byte, i int) []byte {
+	var out [][]byte
+	for j, line := range lines {
+		if j == i {
+			line = bytes.Clone(line)
+			at := bytes.Index(line, []byte(`"output":"`)) + len(`"output":"`)
+			if line[at] == '0' {
+				line[at] = '1'
+			} else {
+				line[at] = '0'
+			}
+		}
+		out = append(out, line)
+	}
+	return bytes.Join(out, nil)
+}
+
+func httpVerify(url string, pub ed25519.PublicKey) (*Pulse, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	last, err := Verify(resp.Body, pub)
+	if err == nil && last == nil {
+		err = errors.New("empty log")
+	}
+	return last, err
+}
@@ -0,0 +1,159 @@
+package beacon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Log is the append-only pulse log: one JSON pulse per line. Opening a log
+// verifies the whole chain, and Append only takes the next pulse of it.
+type Log struct {
+	mu     sync.RWMutex
+	f      *os.File
+	v      *Verifier
+	pulses []*Pulse
+}
+
+// OpenLog opens or creates the log at path and checks every pulse in it
+// against pub. A last line without a newline is a write cut short by a
+// crash; it is not a pulse yet and is cut off.
+func OpenLog(path string, pub ed25519.PublicKey) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{f: f, v: NewVerifier(pub)}
+
+	var good int64
+	err = readLines(f, func(line []byte) error {
+		p := new(Pulse)
+		if err := json.Unmarshal(line, p); err != nil {
+			return err
+		}
+		if err := l.v.Check(p); err != nil {
+			return err
+		}
+		l.pulses = append(l.pulses, p)
+		good += int64(len(line)) + 1
+		return nil
+	})
+	if err == nil {
+		err = f.Truncate(good)
+	}
+	if err == nil {
+		_, err = f.Seek(good, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// readLines calls fn for every complete line of r.
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(bytes.TrimSuffix(line, []byte("\n"))); err != nil {
+			return err
+		}
+	}
+}
+
+// Append checks that p is the next pulse and writes it through to disk.
+func (l *Log) Append(p *Pulse) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.v.Check(p); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+
+	l.pulses = append(l.pulses, p)
+	return nil
+}
+
+// Last returns the newest pulse, or nil for an empty log.
+func (l *Log) Last() *Pulse {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.v.Last()
+}
+
+// Pulse returns the pulse with index i, or nil.
+func (l *Log) Pulse(i uint64) *Pulse {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if i >= uint64(len(l.pulses)) {
+		return nil
+	}
+	return l.pulses[i]
+}
+
+// Len returns the number of pulses.
+func (l *Log) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.pulses)
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Verify checks a log read from r from pulse 0 on and returns the last
+// pulse. Unlike OpenLog it treats a torn last line as an error.
+func Verify(r io.Reader, pub ed25519.PublicKey) (*Pulse, error) {
+	v := NewVerifier(pub)
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if !bytes.HasSuffix(line, []byte("\n")) {
+				return v.Last(), fmt.Errorf("%w: last line is incomplete", ErrChain)
+			}
+			p := new(Pulse)
+			if err := json.Unmarshal(line, p); err != nil {
+				return v.Last(), err
+			}
+			if err := v.Check(p); err != nil {
+				return v.Last(), err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return v.Last(), nil
+		}
+		if err != nil {
+			return v.Last(), err
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package beacon is a local randomness beacon. At fixed intervals it emits
+// a pulse: an index, a timestamp, 64 bytes of StarGate DRBG output and the
+// hash of the previous pulse, signed with Ed25519. Each pulse commits to
+// the whole chain before it, so an auditor holding the public key can
+// check that no pulse was changed, dropped or inserted afterwards.
+package beacon
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	OutputSize = 64
+	HashSize   = sha512.Size
+)
+
+var (
+	ErrSignature = errors.New("beacon: bad pulse signature")
+	ErrChain     = errors.New("beacon: broken pulse chain")
+)
+
+// signContext separates pulse signatures from anything else signed with
+// the same key.
+const signContext = "StarGate beacon pulse v1"
+
+type Pulse struct {
+	Index     uint64
+	Timestamp time.Time
+	Output    [OutputSize]byte
+	// Previous is the Hash of the pulse before; zero for pulse 0.
+	Previous  [HashSize]byte
+	Signature [ed25519.SignatureSize]byte
+}
+
+// signed is the message the signature covers:
+//
+//	context | index(8) | unix nanoseconds(8) | output(64) | previous(64)
+func (p *Pulse) signed() []byte {
+	b := make([]byte, 0, len(signContext)+16+OutputSize+HashSize)
+	b = append(b, signContext...)
+	b = binary.BigEndian.AppendUint64(b, p.Index)
+	b = binary.BigEndian.AppendUint64(b, uint64(p.Timestamp.UnixNano()))
+	b = append(b, p.Output[:]...)
+	return append(b, p.Previous[:]...)
+}
+
+func (p *Pulse) sign(key ed25519.PrivateKey) {
+	copy(p.Signature[:], ed25519.Sign(key, p.signed()))
+}
+
+// Hash is SHA-512 over the signed message and the signature. The next
+// pulse carries it as Previous.
+func (p *Pulse) Hash() [HashSize]byte {
+	return sha512.Sum512(append(p.signed(), p.Signature[:]...))
+}
+
+// Verify checks the signature alone; Verifier checks the chain.
+func (p *Pulse) Verify(pub ed25519.PublicKey) error {
+	if !ed25519.Verify(pub, p.signed(), p.Signature[:]) {
+		return fmt.Errorf("%w: pulse %d", ErrSignature, p.Index)
+	}
+	return nil
+}
+
+type pulseJSON struct {
+	Index     uint64    `json:"index"`
+	Timestamp time.Time `json:"timestamp"`
+	Output    string    `json:"output"`
+	Previous  string    `json:"previous"`
+	Signature string    `json:"signature"`
+}
+
+// MarshalJSON writes the byte fields as hex.
+func (p *Pulse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pulseJSON{
+		Index:     p.Index,
+		Timestamp: p.Timestamp,
+		Output:    hex.EncodeToString(p.Output[:]),
+		Previous:  hex.EncodeToString(p.Previous[:]),
+		Signature: hex.EncodeToString(p.Signature[:]),
+	})
+}
+
+func (p *Pulse) UnmarshalJSON(data []byte) error {
+	var j pulseJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	p.Index, p.Timestamp = j.Index, j.Timestamp
+	for _, f := range []struct {
+		name string
+		hex  string
+		dst  []byte
+	}{
+		{"output", j.Output, p.Output[:]},
+		{"previous", j.Previous, p.Previous[:]},
+		{"signature", j.Signature, p.Signature[:]},
+	} {
+		b, err := hex.DecodeString(f.hex)
+		if err != nil || len(b) != len(f.dst) {
+			return fmt.Errorf("beacon: pulse %d: %s must be %d hex bytes", j.Index, f.name, len(f.dst))
+		}
+		copy(f.dst, b)
+	}
+	return nil
+}
+
+// Verifier checks a sequence of pulses from index 0 on: signatures,
+// consecutive indexes, links to the previous hash and timestamps that do
+// not go back.
+type Verifier struct {
+	pub  ed25519.PublicKey
+	last *Pulse
+	hash [HashSize]byte
+}
+
+func NewVerifier(pub ed25519.PublicKey) *Verifier {
+	return &Verifier{pub: pub}
+}
+
+// Check checks p as the next pulse of the chain.
+func (v *Verifier) Check(p *Pulse) error {
+	var want uint64
+	if v.last != nil {
+		want = v.last.Index + 1
+	}
+	if p.Index != want {
+		return fmt.Errorf("%w: pulse %d where %d was expected", ErrChain, p.Index, want)
+	}
+	if p.Previous != v.hash {
+		return fmt.Errorf("%w: pulse %d does not link to the pulse before", ErrChain, p.Index)
+	}
+	if v.last != nil && p.Timestamp.Before(v.last.Timestamp) {
+		return fmt.Errorf("%w: pulse %d is older than the pulse before", ErrChain, p.Index)
+	}
+	if err := p.Verify(v.pub); err != nil {
+		return err
+	}
+
+	v.last, v.hash = p, p.Hash()
+	return nil
+}
+
+// Last returns the last pulse checked, or nil.
+func (v *Verifier) Last() *Pulse {
+	return v.last
+}
@@ -0,0 +1,309 @@
+// Package bench holds the StarGate benchmark suite. Each Case prepares an
+// operation, and Run times it the way testing.Benchmark does, growing the
+// iteration count until the run takes long enough, so "stargate bench"
+// needs no testing package. bench_test.go runs the same cases as
+// Benchmark functions under go test.
+package bench
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"stargate/sg"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// BulkSize is the buffer size used by the throughput benchmarks.
+const BulkSize = 64 * 1024
+
+var (
+	benchKey   = sg.KeyFromString("StarGate benchmark key")
+	benchNonce = sg.Nonce{0: 1, 15: 1}
+)
+
+// Case is one benchmark of the suite.
+type Case struct {
+	Name string
+	// Bytes is the number of bytes one operation processes, 0 where
+	// throughput does not apply.
+	Bytes int64
+	// Setup prepares the benchmark. It returns the operation to time and
+	// a function that releases what Setup acquired.
+	Setup func() (op func() error, done func(), err error)
+	// Baseline marks reference ciphers that are not part of StarGate.
+	Baseline bool
+	// ZeroAlloc marks hot paths that must not allocate per operation.
+	ZeroAlloc bool
+}
+
+func nothing() {}
+
+func newWaver() (*sg.Waver, error) {
+	return sg.NewWaver(benchKey, benchNonce, false)
+}
+
+// waverCase builds a case timing op on a fresh Waver.
+func waverCase(op func(w *sg.Waver, i int)) func() (func() error, func(), error) {
+	return func() (func() error, func(), error) {
+		w, err := newWaver()
+		if err != nil {
+			return nil, nil, err
+		}
+		i := 0
+		return func() error {
+			op(w, i)
+			i++
+			return nil
+		}, w.Close, nil
+	}
+}
+
+// setupNewWaver measures key setup, including HKDF and the 10000-byte
+// WarmUp.
+func setupNewWaver() (func() error, func(), error) {
+	return func() error {
+		w, err := newWaver()
+		if err != nil {
+			return err
+		}
+		w.Close()
+		return nil
+	}, nothing, nil
+}
+
+func setupRead() (func() error, func(), error) {
+	w, err := newWaver()
+	if err != nil {
+		return nil, nil, err
+	}
+	buf := make([]byte, BulkSize)
+	return func() error {
+		_, err := w.Read(buf)
+		return err
+	}, w.Close, nil
+}
+
+// encryptFileSize is the size of the file encrypted by EncryptFile.
+const encryptFileSize = 1 << 20
+
+// setupEncryptFile encrypts a 1 MiB file per operation, including the
+// container header, the cipher setup and the atomic output.
+func setupEncryptFile() (func() error, func(), error) {
+	dir, err := os.MkdirTemp("", "stargate-bench")
+	if err != nil {
+		return nil, nil, err
+	}
+	done := func() { os.RemoveAll(dir) }
+
+	in := filepath.Join(dir, "plain")
+	out := filepath.Join(dir, "cipher")
+	if err := os.WriteFile(in, make([]byte, encryptFileSize), 0o600); err != nil {
+		done()
+		return nil, nil, err
+	}
+
+	return func() error {
+		c, err := sg.NewCipher(benchKey, benchNonce, false)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return c.EncryptFile(in, out)
+	}, done, nil
+}
+
+func streamOp(s cipher.Stream) func() error {
+	buf := make([]byte, BulkSize)
+	return func() error {
+		s.XORKeyStream(buf, buf)
+		return nil
+	}
+}
+
+// setupXORKeyStream is the StarGate counterpart of the ChaCha20 and
+// AES-CTR cases: the same buffer size through cipher.Stream.
+func setupXORKeyStream() (func() error, func(), error) {
+	c, err := sg.NewCipher(benchKey, benchNonce, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamOp(c), c.Close, nil
+}
+
+func setupChaCha20() (func() error, func(), error) {
+	s, err := chacha20.NewUnauthenticatedCipher(make([]byte, chacha20.KeySize), make([]byte, chacha20.NonceSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamOp(s), nothing, nil
+}
+
+func setupAESCTR() (func() error, func(), error) {
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamOp(cipher.NewCTR(block, make([]byte, aes.BlockSize))), nothing, nil
+}
+
+// setupMAC measures absorbing bulk data into the MAC.
+func setupMAC() (func() error, func(), error) {
+	m, err := sg.NewMAC(benchKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	buf := make([]byte, BulkSize)
+	return func() error {
+		_, err := m.Write(buf)
+		return err
+	}, m.Close, nil
+}
+
+// setupDRBG measures Generate with the largest request, including the
+// fast key erasure that follows each call.
+func setupDRBG() (func() error, func(), error) {
+	d, err := sg.Instantiate([]byte("StarGate benchmark"))
+	if err != nil {
+		return nil, nil, err
+	}
+	buf := make([]byte, sg.MaxDRBGRequest)
+	return func() error {
+		return d.Generate(buf, nil)
+	}, d.Uninstantiate, nil
+}
+
+// Suite lists the benchmarks in the order they are reported.
+var Suite = []Case{
+	{Name: "NewWaver", Setup: setupNewWaver},
+	{Name: "GetNext", Bytes: 1, Setup: waverCase(func(w *sg.Waver, _ int) { w.GetNext() }), ZeroAlloc: true},
+	{Name: "Read", Bytes: BulkSize, Setup: setupRead, ZeroAlloc: true},
+	{Name: "XORCross", Setup: waverCase(func(w *sg.Waver, i int) { w.XORCross(i%16, (i/16)%16) }), ZeroAlloc: true},
+	{Name: "ReinitFromHash", Setup: waverCase(func(w *sg.Waver, _ int) { w.ReinitFromHash() }), ZeroAlloc: true},
+	{Name: "EncryptFile", Bytes: encryptFileSize, Setup: setupEncryptFile},
+	{Name: "XORKeyStream", Bytes: BulkSize, Setup: setupXORKeyStream, ZeroAlloc: true},
+	{Name: "MAC", Bytes: BulkSize, Setup: setupMAC, ZeroAlloc: true},
+	{Name: "DRBG", Bytes: sg.MaxDRBGRequest, Setup: setupDRBG},
+	{Name: "ChaCha20", Bytes: BulkSize, Setup: setupChaCha20, Baseline: true},
+	{Name: "AES-256-CTR", Bytes: BulkSize, Setup: setupAESCTR, Baseline: true},
+}
+
+// Benchtime is how long each case runs: for D, or for exactly N
+// operations if N is set.
+type Benchtime struct {
+	D time.Duration
+	N int
+}
+
+// ParseBenchtime parses a duration such as "1s" or an operation count
+// such as "1000x", like go test -benchtime.
+func ParseBenchtime(s string) (Benchtime, error) {
+	if n, ok := strings.CutSuffix(s, "x"); ok {
+		v, err := strconv.Atoi(n)
+		if err != nil || v <= 0 {
+			return Benchtime{}, fmt.Errorf("invalid count %q", s)
+		}
+		return Benchtime{N: v}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return Benchtime{}, fmt.Errorf("invalid duration %q", s)
+	}
+	return Benchtime{D: d}, nil
+}
+
+// Result is the outcome of Run.
+type Result struct {
+	N      int
+	T      time.Duration
+	Bytes  int64
+	Allocs uint64
+	// AllocBytes is the number of bytes allocated in all N operations.
+	AllocBytes uint64
+}
+
+func (r Result) NsPerOp() float64 {
+	return float64(r.T.Nanoseconds()) / float64(r.N)
+}
+
+func (r Result) AllocsPerOp() int64 {
+	return int64(r.Allocs) / int64(r.N)
+}
+
+func (r Result) AllocedBytesPerOp() int64 {
+	return int64(r.AllocBytes) / int64(r.N)
+}
+
+// MBPerSec is the throughput in MB/s, 0 for cases without Bytes.
+func (r Result) MBPerSec() float64 {
+	if r.Bytes == 0 || r.T <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * float64(r.N) / 1e6 / r.T.Seconds()
+}
+
+// Run times c. Like testing.Benchmark it starts with one operation and
+// predicts the count that fills bt.D from the runs before, and only the
+// last run is reported. Allocations are counted with runtime.MemStats
+// around the timed loop.
+func Run(c Case, bt Benchtime) (Result, error) {
+	op, done, err := c.Setup()
+	if err != nil {
+		return Result{}, err
+	}
+	defer done()
+
+	if bt.N > 0 {
+		return runN(c, op, bt.N)
+	}
+
+	n := 1
+	for {
+		r, err := runN(c, op, n)
+		if err != nil || r.T >= bt.D || n >= 1e9 {
+			return r, err
+		}
+
+		// Aim 20% past the target, and grow at least by one and at most
+		// a hundredfold per round.
+		next := int64(n) * 100
+		if ns := r.T.Nanoseconds(); ns > 0 {
+			next = int64(float64(bt.D.Nanoseconds()) * 1.2 * float64(n) / float64(ns))
+		}
+		next = min(max(next, int64(n)+1), int64(n)*100, 1e9)
+		n = int(next)
+	}
+}
+
+func runN(c Case, op func() error, n int) (Result, error) {
+	runtime.GC()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range n {
+		if err := op(); err != nil {
+			return Result{}, err
+		}
+	}
+	t := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if t <= 0 {
+		return Result{}, errors.New("timer did not advance")
+	}
+	return Result{
+		N:          n,
+		T:          t,
+		Bytes:      c.Bytes,
+		Allocs:     after.Mallocs - before.Mallocs,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
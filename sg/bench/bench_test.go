@@ -0,0 +1,89 @@
+package bench
+
+import "testing"
+
+func lookup(t testing.TB, name string) Case {
+	for _, c := range Suite {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no case %q in Suite", name)
+	return Case{}
+}
+
+func benchmark(b *testing.B, name string) {
+	c := lookup(b, name)
+	op, done, err := c.Setup()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer done()
+
+	b.SetBytes(c.Bytes)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := op(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewWaver(b *testing.B)       { benchmark(b, "NewWaver") }
+func BenchmarkGetNext(b *testing.B)        { benchmark(b, "GetNext") }
+func BenchmarkRead(b *testing.B)           { benchmark(b, "Read") }
+func BenchmarkXORCross(b *testing.B)       { benchmark(b, "XORCross") }
+func BenchmarkReinitFromHash(b *testing.B) { benchmark(b, "ReinitFromHash") }
+func BenchmarkEncryptFile(b *testing.B)    { benchmark(b, "EncryptFile") }
+func BenchmarkXORKeyStream(b *testing.B)   { benchmark(b, "XORKeyStream") }
+func BenchmarkMAC(b *testing.B)            { benchmark(b, "MAC") }
+func BenchmarkDRBG(b *testing.B)           { benchmark(b, "DRBG") }
+func BenchmarkChaCha20(b *testing.B)       { benchmark(b, "ChaCha20") }
+func BenchmarkAESCTR(b *testing.B)         { benchmark(b, "AES-256-CTR") }
+
+func TestZeroAlloc(t *testing.T) {
+	for _, c := range Suite {
+		if !c.ZeroAlloc {
+			continue
+		}
+
+		op, done, err := c.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := testing.AllocsPerRun(100, func() { op() }); n != 0 {
+			t.Errorf("%s allocates %v times per op, want 0", c.Name, n)
+		}
+		done()
+	}
+}
+
+func TestRun(t *testing.T) {
+	r, err := Run(lookup(t, "GetNext"), Benchtime{N: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.N != 1000 || r.Bytes != 1 || r.T <= 0 {
+		t.Errorf("Run(GetNext, 1000x) = %+v", r)
+	}
+}
+
+func TestParseBenchtime(t *testing.T) {
+	for s, want := range map[string]Benchtime{
+		"1s":    {D: 1e9},
+		"250ms": {D: 250e6},
+		"1000x": {N: 1000},
+	} {
+		got, err := ParseBenchtime(s)
+		if err != nil || got != want {
+			t.Errorf("ParseBenchtime(%q) = %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0s", "-1s", "0x", "x", "fast"} {
+		if _, err := ParseBenchtime(s); err == nil {
+			t.Errorf("ParseBenchtime(%q) succeeded", s)
+		}
+	}
+}
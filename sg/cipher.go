@@ -1,107 +1,215 @@
 package sg
 
 import (
+	"bufio"
+	"crypto/cipher"
 	"errors"
+	"io"
 	"os"
-
-	"github.com/schollz/progressbar/v3"
 )
 
 type Cipher struct {
-	key          string
-	Nonce        string
-	waver        *Waver
-	CorrTestMode bool
+	key              *Key
+	Nonce            Nonce
+	waver            *Waver
+	CorrTestMode     bool
+	Compression      Compression
+	CompressionLevel int
+	opts             options
 }
 
-func NewCipher(key, nonce string, corrTestMode bool) (*Cipher, error) {
-	waver, err := NewWaver(key, nonce, corrTestMode)
+// NewCipher keeps its own copy of key to rebuild the Waver for new nonces,
+// so the caller may Destroy key right away. Close wipes the copy.
+func NewCipher(key *Key, nonce Nonce, corrTestMode bool, opts ...Option) (*Cipher, error) {
+	o := newOptions(opts)
+	waver, err := newWaver(key, nonce, corrTestMode, o)
 
 	if err != nil {
 		return nil, err
 	}
 
 	return &Cipher{
-		key:          key,
+		key:          key.Clone(),
 		waver:        waver,
 		Nonce:        waver.Nonce,
 		CorrTestMode: corrTestMode,
+		opts:         o,
 	}, nil
 }
 
-func (c *Cipher) ReinitializeWithNewNonce(nonce string) error {
-	waver, err := NewWaver(c.key, nonce, true)
+func (c *Cipher) ReinitializeWithNewNonce(nonce Nonce) error {
+	return c.reinitialize(nonce, c.opts)
+}
+
+func (c *Cipher) reinitialize(nonce Nonce, o options) error {
+	waver, err := newWaver(c.key, nonce, c.CorrTestMode, o)
 
 	if err != nil {
 		return err
 	}
 
+	c.waver.Close()
 	c.waver = waver
+	c.Nonce = waver.Nonce
 	return nil
 }
 
-func (c *Cipher) EncryptFile(filepath, newFilePath string) error {
-	b, err := os.ReadFile(filepath)
+// Close wipes the key copy and the generator state.
+func (c *Cipher) Close() {
+	c.key.Destroy()
+	c.waver.Close()
+}
+
+// KeyID returns the public identifier of the cipher's key.
+func (c *Cipher) KeyID() KeyID {
+	return c.key.ID()
+}
+
+// XORKeyStream implements cipher.Stream, so a Cipher can be used with
+// cipher.StreamReader and cipher.StreamWriter.
+func (c *Cipher) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("sg: output smaller than input")
+	}
 
+	for i := 0; i < len(src); i++ {
+		dst[i] = src[i] ^ c.waver.GetNext()
+	}
+}
+
+func (c *Cipher) EncryptFile(filepath, newFilePath string) error {
+	in, err := os.Open(filepath)
 	if err != nil {
 		return err
 	}
+	defer in.Close()
 
-	workedBytes := make([]byte, len(b))
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
 
-	bar := progressbar.Default(int64(len(b)))
+	// Writing through a temporary file also makes filepath == newFilePath
+	// safe: the input stays intact until the output is complete.
+	file, err := c.opts.createOutput(newFilePath, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
 
-	for i := 0; i < len(b); i++ {
-		workedBytes[i] = b[i] ^ c.waver.GetNext()
-		bar.Add(1)
+	h := &Header{Kind: KindFile, Nonce: c.waver.Nonce, Compression: c.Compression, Mix: c.opts.mix}
+	h.commit(c.key)
+	if _, err := h.WriteTo(file); err != nil {
+		return err
 	}
 
-	file, _ := os.Create(newFilePath)
-	_, err = file.Write(append([]byte(c.waver.Nonce), workedBytes...))
+	progress := c.opts.newProgress(info.Size())
+
+	zw, err := compressWriter(cipher.StreamWriter{S: c, W: file}, c.Compression, c.CompressionLevel)
 	if err != nil {
 		return err
 	}
 
-	file.Close()
+	if _, err := io.Copy(zw, progress.reader(in)); err != nil {
+		return err
+	}
+	progress.finish()
 
-	return nil
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return file.Commit()
 }
 
+// DecryptFile accepts both containers and the legacy [nonce(16)] +
+// [ciphertext] layout written before containers were introduced.
 func (c *Cipher) DecryptFile(filepath, newFilePath string) error {
-	b, err := os.ReadFile(filepath)
+	in, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
+	info, err := in.Stat()
 	if err != nil {
 		return err
 	}
 
-	nonceB := b[:16]
-	nonce := string(nonceB)
+	progress := c.opts.newProgress(info.Size())
+	br := bufio.NewReader(progress.reader(in))
+
+	var nonce Nonce
+	compression := CompressNone
+	o := c.opts
+
+	if magic, _ := br.Peek(len(ContainerMagic)); IsContainer(magic) {
+		h, err := ReadHeader(br)
+		if err != nil {
+			return err
+		}
+		if h.Kind != KindFile {
+			return errors.New("container is not an encrypted file")
+		}
+		if err := h.CheckKey(c.key); err != nil {
+			return err
+		}
+		nonce = h.Nonce
+		compression = h.Compression
+		o.mix = h.Mix
+	} else {
+		if _, err := io.ReadFull(br, nonce[:]); err != nil {
+			return errors.New("input is too short to contain a nonce")
+		}
+		o.legacyNonce = true
+		o.mix = MixXXH3
+	}
 
-	err = c.ReinitializeWithNewNonce(nonce)
+	err = c.reinitialize(nonce, o)
 	if err != nil {
 		return errors.New("failed to reinitialize cipher with new nonce: " + err.Error())
 	}
 
-	b = b[16:]
+	zr, err := decompressReader(cipher.StreamReader{S: c, R: br}, compression)
+	if err != nil {
+		return errors.New("failed to decompress: " + err.Error())
+	}
+	defer zr.Close()
 
-	workedBytes := make([]byte, len(b))
+	file, err := c.opts.createOutput(newFilePath, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
 
-	bar := progressbar.Default(int64(len(b)))
+	if _, err := io.Copy(file, zr); err != nil {
+		return err
+	}
+	progress.finish()
 
-	for i := 0; i < len(b); i++ {
-		workedBytes[i] = b[i] ^ c.waver.GetNext()
-		bar.Add(1)
+	return file.Commit()
+}
+
+// DecryptFileWithKeys decrypts a container with whichever of keys it was
+// written with, chosen by the key ID in its header, and returns that key.
+func DecryptFileWithKeys(filepath, newFilePath string, keys []*Key, opts ...Option) (*Key, error) {
+	h, err := ReadFileHeader(filepath)
+	if err != nil {
+		return nil, err
 	}
 
-	file, _ := os.Create(newFilePath)
-	_, err = file.Write(workedBytes)
+	key, err := h.SelectKey(keys)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	file.Close()
+	c, err := NewCipher(key, h.Nonce, false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
 
-	return nil
+	return key, c.DecryptFile(filepath, newFilePath)
 }
 
 func (c *Cipher) WorkWithFile(filepath, newFilePath string) error {
@@ -113,22 +221,26 @@ func (c *Cipher) WorkWithFile(filepath, newFilePath string) error {
 
 	workedBytes := make([]byte, len(b))
 
-	bar := progressbar.Default(int64(len(b)))
+	progress := c.opts.newProgress(int64(len(b)))
 
-	for i := 0; i < len(b); i++ {
-		workedBytes[i] = b[i] ^ c.waver.GetNext()
-		bar.Add(1)
+	for i := 0; i < len(b); i += BlockSize {
+		end := min(i+BlockSize, len(b))
+		c.XORKeyStream(workedBytes[i:end], b[i:end])
+		progress.add(int64(end - i))
 	}
+	progress.finish()
 
-	file, _ := os.Create(newFilePath)
-	_, err = file.Write(workedBytes)
+	file, err := CreateAtomic(newFilePath, 0o644)
 	if err != nil {
 		return err
 	}
+	defer file.Abort()
 
-	file.Close()
+	if _, err := file.Write(workedBytes); err != nil {
+		return err
+	}
 
-	return nil
+	return file.Commit()
 }
 
 func (c *Cipher) WorkWithMessage(message string) string {
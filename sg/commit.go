@@ -0,0 +1,63 @@
+package sg
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const CommitmentSize = 32
+
+var ErrWrongKey = errors.New("wrong key")
+
+// KeyCommitment binds a container to its key and nonce. It is stored in the
+// header, so decryption with another key fails before any output is written
+// instead of producing garbage. It is derived independently of the
+// keystream state and reveals nothing about it.
+func KeyCommitment(key *Key, nonce Nonce) [CommitmentSize]byte {
+	var c [CommitmentSize]byte
+
+	h := hkdf.New(sha512.New, key.Bytes(), nonce[:], []byte("StarGate Key Commitment"))
+	io.ReadFull(h, c[:])
+
+	return c
+}
+
+// CheckKey reports ErrWrongKey unless key matches the key ID and commitment
+// recorded in h. Headers without them cannot be checked and pass.
+func (h *Header) CheckKey(key *Key) error {
+	if h.KeyID != nil && *h.KeyID != key.ID() {
+		return ErrWrongKey
+	}
+
+	if h.Commitment != nil {
+		c := KeyCommitment(key, h.Nonce)
+		if subtle.ConstantTimeCompare(c[:], h.Commitment[:]) != 1 {
+			return ErrWrongKey
+		}
+	}
+
+	return nil
+}
+
+// SelectKey returns the candidate that matches h. Candidates are matched by
+// key ID first, and every match is confirmed with the commitment.
+func (h *Header) SelectKey(keys []*Key) (*Key, error) {
+	for _, k := range keys {
+		if h.CheckKey(k) == nil {
+			return k, nil
+		}
+	}
+	return nil, ErrWrongKey
+}
+
+// commit records the key ID and commitment of key in h.
+func (h *Header) commit(key *Key) {
+	id := key.ID()
+	c := KeyCommitment(key, h.Nonce)
+	h.KeyID = &id
+	h.Commitment = &c
+}
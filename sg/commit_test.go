@@ -0,0 +1,76 @@
+package sg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// committedHeader returns the header of a file written with key, as read
+// back from its encoding.
+func committedHeader(t *testing.T, key *Key, nonce Nonce) *Header {
+	t.Helper()
+	h := &Header{Kind: KindFile, Nonce: nonce}
+	h.commit(key)
+	raw, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadHeader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestCheckKey(t *testing.T) {
+	key, other := KeyFromString("StarGate commit key"), KeyFromString("StarGate other key")
+	h := committedHeader(t, key, Nonce{15: 1})
+
+	if err := h.CheckKey(key); err != nil {
+		t.Errorf("right key: %v", err)
+	}
+	if err := h.CheckKey(other); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key: got %v, want %v", err, ErrWrongKey)
+	}
+
+	// A key ID alone is no proof: with the right ID but another
+	// commitment the key is still refused.
+	forged := *h
+	c := KeyCommitment(other, h.Nonce)
+	forged.Commitment = &c
+	if err := forged.CheckKey(key); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("changed commitment: got %v, want %v", err, ErrWrongKey)
+	}
+
+	if KeyCommitment(key, Nonce{15: 1}) == KeyCommitment(key, Nonce{15: 2}) {
+		t.Error("commitment does not depend on the nonce")
+	}
+
+	if err := (&Header{Kind: KindFile}).CheckKey(other); err != nil {
+		t.Errorf("header without commitment: %v", err)
+	}
+}
+
+func TestSelectKey(t *testing.T) {
+	keys := []*Key{KeyFromString("key 0"), KeyFromString("key 1"), KeyFromString("key 2")}
+
+	for i, key := range keys {
+		h := committedHeader(t, key, Nonce{15: byte(i)})
+		got, err := h.SelectKey(keys)
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		if got != key {
+			t.Errorf("key %d: selected another key", i)
+		}
+	}
+
+	h := committedHeader(t, KeyFromString("key 3"), Nonce{})
+	if _, err := h.SelectKey(keys); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("no matching key: got %v, want %v", err, ErrWrongKey)
+	}
+	if _, err := h.SelectKey(nil); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("no keys: got %v, want %v", err, ErrWrongKey)
+	}
+}
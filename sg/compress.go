@@ -0,0 +1,115 @@
+package sg
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Compression is applied to the plaintext before encryption, since
+// ciphertext does not compress. The algorithm is recorded in the container
+// header, the level is not needed to decompress.
+type Compression byte
+
+const (
+	CompressNone Compression = iota
+	CompressGzip
+	CompressFlate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressGzip:
+		return "gzip"
+	case CompressFlate:
+		return "flate"
+	}
+	return fmt.Sprintf("compression(%d)", byte(c))
+}
+
+// Named levels, so users do not have to remember what 1 and 9 mean.
+var compressionLevels = map[string]int{
+	"fastest": flate.BestSpeed,
+	"fast":    3,
+	"default": flate.DefaultCompression,
+	"better":  7,
+	"best":    flate.BestCompression,
+}
+
+// ParseCompression parses "none", "gzip", "flate" with an optional
+// ":level" suffix, where level is 1-9 or one of fastest, fast, default,
+// better, best. For example "gzip:best" or "flate:1".
+func ParseCompression(s string) (Compression, int, error) {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(s), ":")
+
+	var alg Compression
+	switch name {
+	case "", "none":
+		alg = CompressNone
+	case "gzip", "gz":
+		alg = CompressGzip
+	case "flate", "deflate":
+		alg = CompressFlate
+	default:
+		return 0, 0, fmt.Errorf("unknown compression %q", name)
+	}
+
+	level := flate.DefaultCompression
+	if hasLevel {
+		if alg == CompressNone {
+			return 0, 0, fmt.Errorf("compression level given without an algorithm")
+		}
+		if l, ok := compressionLevels[levelStr]; ok {
+			level = l
+		} else {
+			l, err := strconv.Atoi(levelStr)
+			if err != nil || l < flate.BestSpeed || l > flate.BestCompression {
+				return 0, 0, fmt.Errorf("bad compression level %q", levelStr)
+			}
+			level = l
+		}
+	}
+
+	return alg, level, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressWriter treats level 0 as the default level, so a zero Cipher or
+// ArchiveOptions value still compresses when an algorithm is set.
+func compressWriter(w io.Writer, alg Compression, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	switch alg {
+	case CompressNone:
+		return nopWriteCloser{w}, nil
+	case CompressGzip:
+		return gzip.NewWriterLevel(w, level)
+	case CompressFlate:
+		return flate.NewWriter(w, level)
+	}
+	return nil, fmt.Errorf("unsupported compression %s", alg)
+}
+
+func decompressReader(r io.Reader, alg Compression) (io.ReadCloser, error) {
+	switch alg {
+	case CompressNone:
+		return io.NopCloser(r), nil
+	case CompressGzip:
+		return gzip.NewReader(r)
+	case CompressFlate:
+		return flate.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %s", alg)
+}
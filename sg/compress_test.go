@@ -0,0 +1,133 @@
+package sg
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func compress(t *testing.T, data []byte, alg Compression, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := compressWriter(&buf, alg, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decompress(data []byte, alg Compression) ([]byte, error) {
+	zr, err := decompressReader(bytes.NewReader(data), alg)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("StarGate compresses the plaintext before encryption. "), 1000)
+	random := make([]byte, 64<<10)
+	rand.Read(random)
+
+	for _, alg := range []Compression{CompressNone, CompressGzip, CompressFlate} {
+		for _, level := range []int{0, flate.BestSpeed, flate.BestCompression} {
+			for name, data := range map[string][]byte{"empty": {}, "text": text, "random": random} {
+				z := compress(t, data, alg, level)
+				got, err := decompress(z, alg)
+				if err != nil {
+					t.Fatalf("%s level %d, %s: %v", alg, level, name, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("%s level %d, %s: round trip differs", alg, level, name)
+				}
+
+				if alg != CompressNone && name == "text" && len(z) > len(data)/10 {
+					t.Errorf("%s level %d: text compressed to %d of %d bytes", alg, level, len(z), len(data))
+				}
+				// Incompressible input grows by no more than the framing.
+				if name == "random" && len(z) > len(data)+len(data)/100+64 {
+					t.Errorf("%s level %d: random input grew to %d of %d bytes", alg, level, len(z), len(data))
+				}
+			}
+		}
+	}
+}
+
+// TestDecompressDamaged checks that a cut or changed compressed stream is
+// an error, not shorter or different output.
+func TestDecompressDamaged(t *testing.T) {
+	data := bytes.Repeat([]byte("StarGate damaged stream. "), 1000)
+
+	for _, alg := range []Compression{CompressGzip, CompressFlate} {
+		z := compress(t, data, alg, 0)
+		if _, err := decompress(z[:len(z)/2], alg); err == nil {
+			t.Errorf("%s: truncated stream decompressed", alg)
+		}
+	}
+
+	// Only gzip carries a checksum that catches any changed byte.
+	z := compress(t, data, CompressGzip, 0)
+	z[len(z)/2] ^= 0x40
+	if _, err := decompress(z, CompressGzip); err == nil {
+		t.Error("gzip: changed stream decompressed")
+	}
+}
+
+// TestCompressedFile encrypts a file with compression and decrypts it, then
+// decrypts a truncated copy, which must fail without leaving output.
+func TestCompressedFile(t *testing.T) {
+	dir := t.TempDir()
+	plain := bytes.Repeat([]byte("StarGate compressed file. "), 2000)
+	in := filepath.Join(dir, "plain")
+	if err := os.WriteFile(in, plain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := KeyFromString("StarGate compress key")
+	c, err := NewCipher(key, Nonce{15: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Compression = CompressGzip
+
+	enc := filepath.Join(dir, "enc.sg")
+	if err := c.EncryptFile(in, enc); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(enc)
+	if len(data) > len(plain)/10 {
+		t.Errorf("encrypted %d bytes into %d", len(plain), len(data))
+	}
+
+	out := filepath.Join(dir, "out")
+	if _, err := DecryptFileWithKeys(enc, out, []*Key{key}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, plain) {
+		t.Error("decrypted file differs")
+	}
+
+	cut := filepath.Join(dir, "cut.sg")
+	if err := os.WriteFile(cut, data[:len(data)-20], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cutOut := filepath.Join(dir, "cut")
+	if _, err := DecryptFileWithKeys(cut, cutOut, []*Key{key}); err == nil {
+		t.Error("truncated file decrypted")
+	}
+	if _, err := os.Stat(cutOut); !os.IsNotExist(err) {
+		t.Errorf("truncated file left output: %v", err)
+	}
+}
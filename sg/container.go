@@ -0,0 +1,220 @@
+package sg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Container layout:
+//
+//	magic   "STGT"            4 bytes
+//	version                   1 byte
+//	length  (big endian)      2 bytes, size of the field section
+//	fields  [tag(1) len(2) value(len)]...
+//
+// Unknown tags are skipped on read, so new fields can be added without
+// bumping the version. Version 2 added the mix field, which changes how
+// the payload decrypts and so must not be skipped: containers in the
+// MixXXH3 mix are still written as version 1, without it, and stay
+// readable by older releases.
+var ContainerMagic = [4]byte{'S', 'T', 'G', 'T'}
+
+const ContainerVersion = 2
+
+type ContainerKind byte
+
+const (
+	KindFile ContainerKind = iota + 1
+	// KindArchive is a tar stream sealed in chunks, see CreateArchive.
+	KindArchive
+	// KindLog is a log of separately encrypted records, see LogWriter.
+	KindLog
+	// KindKV is a key-value store file, see package sg/kv.
+	KindKV
+)
+
+const (
+	fieldNonce byte = iota + 1
+	fieldKind
+	fieldCompression
+	fieldKeyID
+	fieldCommitment
+	fieldMix
+)
+
+var ErrNoHeader = errors.New("input is not a StarGate container")
+
+type Header struct {
+	Version     byte
+	Kind        ContainerKind
+	Nonce       Nonce
+	Compression Compression
+	// KeyID and Commitment are nil in containers written without them.
+	KeyID      *KeyID
+	Commitment *[CommitmentSize]byte
+	// Mix is the reinit mix of the payload. Version 1 containers are
+	// MixXXH3.
+	Mix Mix
+}
+
+func (h *Header) MarshalBinary() ([]byte, error) {
+	var fields bytes.Buffer
+
+	putField := func(tag byte, val []byte) {
+		fields.WriteByte(tag)
+		binary.Write(&fields, binary.BigEndian, uint16(len(val)))
+		fields.Write(val)
+	}
+
+	putField(fieldNonce, h.Nonce[:])
+	putField(fieldKind, []byte{byte(h.Kind)})
+	putField(fieldCompression, []byte{byte(h.Compression)})
+	if h.KeyID != nil {
+		putField(fieldKeyID, h.KeyID[:])
+	}
+	if h.Commitment != nil {
+		putField(fieldCommitment, h.Commitment[:])
+	}
+	version := byte(1)
+	if h.Mix != MixXXH3 {
+		putField(fieldMix, []byte{byte(h.Mix)})
+		version = 2
+	}
+
+	if fields.Len() > 0xffff {
+		return nil, errors.New("container header is too large")
+	}
+
+	out := make([]byte, 0, 7+fields.Len())
+	out = append(out, ContainerMagic[:]...)
+	out = append(out, version)
+	out = binary.BigEndian.AppendUint16(out, uint16(fields.Len()))
+	out = append(out, fields.Bytes()...)
+
+	return out, nil
+}
+
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadHeader reads a container header from r. If r does not start with
+// ContainerMagic, ErrNoHeader is returned and the consumed bytes are lost,
+// so callers that need to fall back to the legacy layout should peek first.
+func ReadHeader(r io.Reader) (*Header, error) {
+	var prefix [7]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNoHeader
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(prefix[:4], ContainerMagic[:]) {
+		return nil, ErrNoHeader
+	}
+
+	h := &Header{Version: prefix[4]}
+	if h.Version < 1 || h.Version > ContainerVersion {
+		return nil, fmt.Errorf("unsupported container version %d", h.Version)
+	}
+	if h.Version == 1 {
+		h.Mix = MixXXH3
+	}
+	hasMix := false
+
+	fields := make([]byte, binary.BigEndian.Uint16(prefix[5:]))
+	if _, err := io.ReadFull(r, fields); err != nil {
+		return nil, fmt.Errorf("truncated container header: %w", err)
+	}
+
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, errors.New("malformed container header")
+		}
+
+		tag := fields[0]
+		size := int(binary.BigEndian.Uint16(fields[1:3]))
+		fields = fields[3:]
+
+		if size > len(fields) {
+			return nil, errors.New("malformed container header")
+		}
+
+		val := fields[:size]
+		fields = fields[size:]
+
+		switch tag {
+		case fieldNonce:
+			if len(val) != NonceSize {
+				return nil, errors.New("malformed container nonce")
+			}
+			copy(h.Nonce[:], val)
+		case fieldKind:
+			if len(val) != 1 {
+				return nil, errors.New("malformed container kind")
+			}
+			h.Kind = ContainerKind(val[0])
+		case fieldCompression:
+			if len(val) != 1 {
+				return nil, errors.New("malformed container compression")
+			}
+			h.Compression = Compression(val[0])
+		case fieldKeyID:
+			var id KeyID
+			if len(val) != len(id) {
+				return nil, errors.New("malformed container key ID")
+			}
+			copy(id[:], val)
+			h.KeyID = &id
+		case fieldCommitment:
+			var c [CommitmentSize]byte
+			if len(val) != len(c) {
+				return nil, errors.New("malformed container key commitment")
+			}
+			copy(c[:], val)
+			h.Commitment = &c
+		case fieldMix:
+			if len(val) != 1 || h.Version < 2 {
+				return nil, errors.New("malformed container mix")
+			}
+			if Mix(val[0]) > MixXXH3 {
+				return nil, fmt.Errorf("unsupported container mix %d", val[0])
+			}
+			h.Mix = Mix(val[0])
+			hasMix = true
+		}
+	}
+	if h.Version >= 2 && !hasMix {
+		return nil, errors.New("container header has no mix")
+	}
+
+	return h, nil
+}
+
+// ReadFileHeader reads the container header of the file at path.
+func ReadFileHeader(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadHeader(bufio.NewReader(f))
+}
+
+// IsContainer reports whether b starts with a StarGate container header.
+func IsContainer(b []byte) bool {
+	return len(b) >= len(ContainerMagic) && bytes.Equal(b[:len(ContainerMagic)], ContainerMagic[:])
+}
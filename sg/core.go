@@ -0,0 +1,28 @@
+package sg
+
+import (
+	"crypto/sha256"
+
+	"stargate/sg/core"
+)
+
+// CoreSeed derives the seed from which a core.Generator produces the same
+// keystream as NewWaver(key, nonce, false). Set its Mix for another mix.
+// Clear the seed once the generator is initialized.
+func CoreSeed(key *Key, nonce Nonce) (*core.Seed, error) {
+	if key == nil || key.Len() == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	state, err := DeriveStateFromKey(key.Bytes(), nonce[:])
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(state)
+	hash := sha256.Sum256(key.Bytes())
+	defer wipe(hash[:])
+
+	s := &core.Seed{Nonce: nonce, X: hash[0] % 16, Y: hash[1] % 16}
+	copy(s.State[:], state)
+	return s, nil
+}
@@ -0,0 +1,198 @@
+// Package core is the StarGate keystream generator for small targets. It
+// produces the same output as sg.Waver from the same key and nonce, but
+// keeps all state in fixed arrays inside the Generator, allocates nothing
+// after the Generator itself exists, and depends on nothing beyond
+// math/bits. In particular it does not import fmt, os or reflect, so it
+// builds under TinyGo and for GOOS=wasip1 and GOARCH=arm.
+//
+// Key derivation (HKDF-SHA512 and SHA-256) is left to the caller: Init
+// takes the 512 bytes of derived state ready made. On a full Go target
+// sg.CoreSeed derives a Seed from a key and nonce; elsewhere derive it the
+// same way:
+//
+//	State = HKDF-SHA512(key, salt = nonce, info = "StarGate Initial State"), 512 bytes
+//	X, Y  = SHA-256(key)[0] % 16, SHA-256(key)[1] % 16
+//
+// Seed.Mix picks the reinit mix as sg.WithMix does. Its zero value is the
+// default, MixStarGate.
+package core
+
+const (
+	// StateSize is the size of the derived state a Generator starts from.
+	StateSize = 512
+
+	// NonceSize is the size of a nonce.
+	NonceSize = 16
+
+	// BlockSize is the number of bytes produced per refill.
+	BlockSize = 64
+
+	// warmUp is the number of bytes discarded after Init.
+	warmUp = 10000
+)
+
+// Seed is what Init needs, all derived from the key beforehand. Clear it
+// once the Generator is initialized.
+type Seed struct {
+	State [StateSize]byte
+	Nonce [NonceSize]byte
+	X, Y  uint8
+	Mix   Mix
+}
+
+// Generator is the keystream state. The zero value is not usable; call
+// Init. A Generator may be declared as a global or on the stack; none of
+// its methods allocate.
+type Generator struct {
+	matrix     [16][16]byte
+	gates      [16][4][4]byte
+	x, y       uint64
+	offsetSum  uint64
+	blockIndex uint64
+	blockPos   int
+	block      [BlockSize]byte
+	mix        Mix
+}
+
+// Init sets g up from s, applies the nonce and discards the warm-up bytes,
+// so the next byte out is the first byte of the keystream.
+func (g *Generator) Init(s *Seed) {
+	for i := range g.matrix {
+		copy(g.matrix[i][:], s.State[i*16:(i+1)*16])
+	}
+	for i := range g.gates {
+		vals := s.State[256+i*16 : 256+(i+1)*16]
+		for r := range g.gates[i] {
+			copy(g.gates[i][r][:], vals[r*4:(r+1)*4])
+		}
+	}
+
+	// The nonce is XORed over the matrix and then the gates, cycling
+	// through its bytes.
+	idx := 0
+	for i := range g.matrix {
+		for j := range g.matrix[i] {
+			g.matrix[i][j] ^= s.Nonce[idx%NonceSize]
+			idx++
+		}
+	}
+	for k := range g.gates {
+		for i := range g.gates[k] {
+			for j := range g.gates[k][i] {
+				g.gates[k][i][j] ^= s.Nonce[idx%NonceSize]
+				idx++
+			}
+		}
+	}
+
+	g.x, g.y = uint64(s.X%16), uint64(s.Y%16)
+	g.mix = s.Mix
+	g.offsetSum, g.blockIndex = 0, 0
+	g.blockPos = BlockSize
+
+	for range warmUp {
+		g.Next()
+	}
+}
+
+// Next returns the next keystream byte.
+func (g *Generator) Next() byte {
+	if g.blockPos == BlockSize {
+		g.refill()
+	}
+	b := g.block[g.blockPos]
+	g.offsetSum += uint64(b)
+	g.blockPos++
+	return b
+}
+
+// Read fills p with keystream. It never fails.
+func (g *Generator) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = g.Next()
+	}
+	return len(p), nil
+}
+
+// XORKeyStream XORs src with the keystream into dst, which encrypts and
+// decrypts alike. dst must be at least as long as src; they may be the
+// same slice but must not otherwise overlap.
+func (g *Generator) XORKeyStream(dst, src []byte) {
+	_ = dst[:len(src)]
+	for i := range src {
+		dst[i] = src[i] ^ g.Next()
+	}
+}
+
+// Wipe clears the state. g must be initialized again before further use.
+func (g *Generator) Wipe() {
+	*g = Generator{}
+}
+
+// pass is MatrixGate.PassValue: the gate cell picked by accum is added to
+// val, and val is added to the cell.
+func pass(gate *[4][4]byte, val byte, accum uint64) byte {
+	x, y := accum%4, (accum/4)%4
+	v := gate[x][y]
+	gate[x][y] = v + val
+	return val + v
+}
+
+// xorCross XORs the cell at x, y over the rest of its column and row,
+// reverses the row and rotates every byte of the column left by one.
+func (g *Generator) xorCross(x, y uint64) {
+	m := &g.matrix
+	val := m[x][y]
+	for i := range uint64(16) {
+		if i != x {
+			m[i][y] ^= val
+		}
+	}
+	for i := range uint64(16) {
+		if i != y {
+			m[x][i] ^= val
+		}
+	}
+	for i, j := 0, 15; i < j; i, j = i+1, j-1 {
+		m[x][i], m[x][j] = m[x][j], m[x][i]
+	}
+	for i := range m {
+		m[i][y] = m[i][y]<<1 | m[i][y]>>7
+	}
+}
+
+// refill mixes the matrix, takes the next block from its top four rows and
+// rebuilds the matrix from its hash.
+func (g *Generator) refill() {
+	x, y := g.y%16, g.x%16
+	for r := range uint64(8) {
+		g.xorCross((x+r)%16, (y-r+16)%16)
+	}
+
+	gate := &g.gates[g.blockIndex%16]
+	for r := range uint64(4) {
+		row := &g.matrix[r]
+		for i := range uint64(16) {
+			row[i] = pass(gate, row[i], g.offsetSum+i+r+g.blockIndex)
+		}
+	}
+
+	for r := range 4 {
+		copy(g.block[r*16:], g.matrix[r][:])
+	}
+
+	post := &g.gates[(g.blockIndex+1)%16]
+	for i := range g.block {
+		g.block[i] = pass(post, g.block[i]^byte(g.offsetSum), g.blockIndex)
+	}
+
+	g.blockIndex++
+	g.blockPos = 0
+
+	Reinit(&g.matrix, g.mix)
+
+	dx := (g.offsetSum ^ uint64(g.matrix[(g.x+1)%16][g.y])) % 16
+	dy := (g.offsetSum + uint64(g.matrix[g.x][(g.y+1)%16])) % 16
+	g.x = (g.x + dx) % 16
+	g.y = (g.y + dy) % 16
+}
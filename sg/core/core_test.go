@@ -0,0 +1,84 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func testSeed(mix Mix) *Seed {
+	s := &Seed{X: 3, Y: 11, Mix: mix}
+	for i := range s.State {
+		s.State[i] = byte(i*7 + 1)
+	}
+	for i := range s.Nonce {
+		s.Nonce[i] = byte(i)
+	}
+	return s
+}
+
+// TestAllocs checks that none of the keystream paths allocate, which is
+// what lets the package run without a garbage collector to speak of.
+func TestAllocs(t *testing.T) {
+	for _, mix := range []Mix{MixStarGate, MixXXH3} {
+		var g Generator
+		seed := testSeed(mix)
+		g.Init(seed)
+		buf := make([]byte, 4*BlockSize+5)
+		var m [16][16]byte
+
+		for name, f := range map[string]func(){
+			"Init":         func() { g.Init(seed) },
+			"Next":         func() { g.Next() },
+			"Read":         func() { g.Read(buf) },
+			"XORKeyStream": func() { g.XORKeyStream(buf, buf) },
+			"HashMatrix":   func() { HashMatrix(&m, mix) },
+			"Reinit":       func() { Reinit(&m, mix) },
+			"Wipe":         g.Wipe,
+		} {
+			if n := testing.AllocsPerRun(10, f); n != 0 {
+				t.Errorf("mix %s: %s allocates %v times per call, want 0", mix, name, n)
+			}
+		}
+	}
+}
+
+// TestSmallTargets builds the package for WASI and 32-bit ARM and checks
+// that it does not pull in fmt, os or reflect there, as the Makefile does
+// with TinyGo left out.
+func TestSmallTargets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross builds are slow")
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found:", err)
+	}
+
+	for _, target := range []string{"wasip1/wasm", "linux/arm"} {
+		goos, goarch, _ := strings.Cut(target, "/")
+		env := append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+
+		build := exec.Command(gotool, "build", ".")
+		build.Env = env
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Errorf("%s: build failed: %v\n%s", target, err, out)
+			continue
+		}
+
+		list := exec.Command(gotool, "list", "-deps", ".")
+		list.Env = env
+		out, err := list.Output()
+		if err != nil {
+			t.Errorf("%s: go list failed: %v", target, err)
+			continue
+		}
+		for _, dep := range strings.Fields(string(out)) {
+			switch dep {
+			case "fmt", "os", "reflect":
+				t.Errorf("%s: sg/core imports %s", target, dep)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+// Mix selects the function that rebuilds the matrix after every block (the
+// reinit step) and hashes it for the walk position. See docs/mix.md for
+// the specification of both.
+type Mix uint8
+
+const (
+	// MixStarGate is the mix defined in docs/mix.md on SplitMix64. It is
+	// the default.
+	MixStarGate Mix = iota
+
+	// MixXXH3 reproduces the output of releases that hashed the matrix
+	// with XXH3-64, to process data written by them.
+	MixXXH3
+)
+
+func (m Mix) String() string {
+	switch m {
+	case MixStarGate:
+		return "stargate"
+	case MixXXH3:
+		return "xxh3"
+	}
+	return "unknown"
+}
+
+// golden is the SplitMix64 increment, 2^64 divided by the golden ratio.
+const golden = 0x9E3779B97F4A7C15
+
+// splitmix is the SplitMix64 output function, a bijection on 64 bits.
+func splitmix(z uint64) uint64 {
+	z ^= z >> 30
+	z *= 0xBF58476D1CE4E5B9
+	z ^= z >> 27
+	z *= 0x94D049BB133111EB
+	z ^= z >> 31
+	return z
+}
+
+// stargateMatrix hashes the 32 little endian words of the matrix in four
+// lanes, word k into lane k mod 4, and folds the lanes in order.
+func stargateMatrix(m *[16][16]byte) uint64 {
+	var lanes [4]uint64
+	for j := range lanes {
+		lanes[j] = uint64(j+1) * golden
+	}
+	for k := range 32 {
+		lanes[k%4] = splitmix(lanes[k%4] ^ matrixWord(m, 8*k))
+	}
+
+	var h uint64
+	for _, lane := range lanes {
+		h = splitmix(h ^ lane)
+	}
+	return h
+}
+
+// stargateByte is output b+1 of SplitMix64 started from seed.
+func stargateByte(b byte, seed uint64) uint64 {
+	return splitmix(seed + (uint64(b)+1)*golden)
+}
+
+// HashMatrix returns the 64-bit hash of the matrix m under mix.
+func HashMatrix(m *[16][16]byte, mix Mix) uint64 {
+	if mix == MixXXH3 {
+		return xxh3Matrix(m)
+	}
+	return stargateMatrix(m)
+}
+
+// Reinit rebuilds every row of m from the hash of the whole matrix: row i
+// is h1 = H(i, seed) followed by H(i+100, seed^h1), both little endian,
+// where seed is HashMatrix(m, mix) and H the byte hash of mix.
+func Reinit(m *[16][16]byte, mix Mix) {
+	hash := stargateByte
+	if mix == MixXXH3 {
+		hash = xxh3Byte
+	}
+
+	seed := HashMatrix(m, mix)
+	for i := range m {
+		h1 := hash(byte(i), seed)
+		putLE64(m[i][:8], h1)
+		h2 := hash(byte(i+100), seed^h1)
+		putLE64(m[i][8:], h2)
+	}
+}
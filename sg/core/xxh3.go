@@ -0,0 +1,126 @@
+package core
+
+import "math/bits"
+
+// MixXXH3 hashes with XXH3-64 on exactly two input shapes: the 256-byte
+// matrix with seed 0, and single bytes with a seed. These are those two
+// paths of XXH3 (https://github.com/Cyan4973/xxHash, v0.8), with the
+// default secret, written out so that they need no allocation, no unsafe
+// and no package beyond math/bits.
+
+const (
+	prime32_1 = 0x9E3779B1
+	prime32_2 = 0x85EBCA77
+	prime32_3 = 0xC2B2AE3D
+	prime64_1 = 0x9E3779B185EBCA87
+	prime64_2 = 0xC2B2AE3D27D4EB4F
+	prime64_3 = 0x165667B19E3779F9
+	prime64_4 = 0x85EBCA77C2B2AE63
+	prime64_5 = 0x27D4EB2F165667C5
+
+	stripeLen = 64
+)
+
+// kSecret is the default XXH3 secret.
+var kSecret = [192]byte{
+	0xb8, 0xfe, 0x6c, 0x39, 0x23, 0xa4, 0x4b, 0xbe, 0x7c, 0x01, 0x81, 0x2c, 0xf7, 0x21, 0xad, 0x1c,
+	0xde, 0xd4, 0x6d, 0xe9, 0x83, 0x90, 0x97, 0xdb, 0x72, 0x40, 0xa4, 0xa4, 0xb7, 0xb3, 0x67, 0x1f,
+	0xcb, 0x79, 0xe6, 0x4e, 0xcc, 0xc0, 0xe5, 0x78, 0x82, 0x5a, 0xd0, 0x7d, 0xcc, 0xff, 0x72, 0x21,
+	0xb8, 0x08, 0x46, 0x74, 0xf7, 0x43, 0x24, 0x8e, 0xe0, 0x35, 0x90, 0xe6, 0x81, 0x3a, 0x26, 0x4c,
+	0x3c, 0x28, 0x52, 0xbb, 0x91, 0xc3, 0x00, 0xcb, 0x88, 0xd0, 0x65, 0x8b, 0x1b, 0x53, 0x2e, 0xa3,
+	0x71, 0x64, 0x48, 0x97, 0xa2, 0x0d, 0xf9, 0x4e, 0x38, 0x19, 0xef, 0x46, 0xa9, 0xde, 0xac, 0xd8,
+	0xa8, 0xfa, 0x76, 0x3f, 0xe3, 0x9c, 0x34, 0x3f, 0xf9, 0xdc, 0xbb, 0xc7, 0xc7, 0x0b, 0x4f, 0x1d,
+	0x8a, 0x51, 0xe0, 0x4b, 0xcd, 0xb4, 0x59, 0x31, 0xc8, 0x9f, 0x7e, 0xc9, 0xd9, 0x78, 0x73, 0x64,
+	0xea, 0xc5, 0xac, 0x83, 0x34, 0xd3, 0xeb, 0xc3, 0xc5, 0x81, 0xa0, 0xff, 0xfa, 0x13, 0x63, 0xeb,
+	0x17, 0x0d, 0xdd, 0x51, 0xb7, 0xf0, 0xda, 0x49, 0xd3, 0x16, 0x55, 0x26, 0x29, 0xd4, 0x68, 0x9e,
+	0x2b, 0x16, 0xbe, 0x58, 0x7d, 0x47, 0xa1, 0xfc, 0x8f, 0xf8, 0xb8, 0xd1, 0x7a, 0xd0, 0x31, 0xce,
+	0x45, 0xcb, 0x3a, 0x8f, 0x95, 0x16, 0x04, 0x28, 0xaf, 0xd7, 0xfb, 0xca, 0xbb, 0x4b, 0x40, 0x7e,
+}
+
+func le32(b []byte) uint32 {
+	_ = b[3]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func le64(b []byte) uint64 {
+	_ = b[7]
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func putLE64(b []byte, v uint64) {
+	_ = b[7]
+	b[0], b[1], b[2], b[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+	b[4], b[5], b[6], b[7] = byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56)
+}
+
+func mulFold64(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+func xxh64Avalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= prime64_2
+	h ^= h >> 29
+	h *= prime64_3
+	h ^= h >> 32
+	return h
+}
+
+func xxh3Avalanche(h uint64) uint64 {
+	h ^= h >> 37
+	h *= 0x165667919E3779F9
+	h ^= h >> 32
+	return h
+}
+
+// matrixWord reads the little endian word at byte offset off of the
+// matrix laid out row after row. Offsets are multiples of 8, so a word
+// never spans two rows.
+func matrixWord(m *[16][16]byte, off int) uint64 {
+	return le64(m[off>>4][off&15:])
+}
+
+// accumulate512 is XXH3_accumulate_512 on the stripe of m at off with the
+// secret at secretOff.
+func accumulate512(acc *[8]uint64, m *[16][16]byte, off, secretOff int) {
+	for i := range 8 {
+		data := matrixWord(m, off+8*i)
+		key := data ^ le64(kSecret[secretOff+8*i:])
+		acc[i^1] += data
+		acc[i] += uint64(uint32(key)) * (key >> 32)
+	}
+}
+
+// xxh3Matrix is XXH3-64 with seed 0 of the 256 bytes of m, the long input
+// path: three stripes of 64 bytes, the last stripe, then the merge.
+func xxh3Matrix(m *[16][16]byte) uint64 {
+	const length = 256
+
+	acc := [8]uint64{prime32_3, prime64_1, prime64_2, prime64_3, prime64_4, prime32_2, prime64_5, prime32_1}
+
+	// (length-1)/stripeLen stripes, with the secret advancing 8 bytes each.
+	for s := range (length - 1) / stripeLen {
+		accumulate512(&acc, m, s*stripeLen, s*8)
+	}
+	// The last stripe, with the secret at its end less 7 bytes.
+	accumulate512(&acc, m, length-stripeLen, len(kSecret)-stripeLen-7)
+
+	// Merge with the secret at offset 11.
+	h := uint64(prime64_1)
+	h *= length
+	for i := 0; i < 4; i++ {
+		h += mulFold64(acc[2*i]^le64(kSecret[11+16*i:]), acc[2*i+1]^le64(kSecret[11+16*i+8:]))
+	}
+	return xxh3Avalanche(h)
+}
+
+// xxh3Byte is XXH3-64 of the single byte b with seed, the 1 to 3 byte
+// path.
+func xxh3Byte(b byte, seed uint64) uint64 {
+	c := uint64(b)
+	combined := c<<16 | c<<24 | c | 1<<8
+	bitflip := uint64(le32(kSecret[0:])^le32(kSecret[4:])) + seed
+	return xxh64Avalanche(combined ^ bitflip)
+}
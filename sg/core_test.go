@@ -0,0 +1,98 @@
+package sg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"stargate/sg/core"
+)
+
+// coreCompareLen is how far TestCoreMatchesWaver compares a
+// core.Generator with the Waver, several hundred blocks past the known
+// answers.
+const coreCompareLen = 1 << 16
+
+func coreSeed(t *testing.T, ka KnownAnswer) (*core.Seed, []byte) {
+	nonce, err := ParseNonce(ka.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := KeyFromString(ka.Key)
+	defer key.Destroy()
+
+	seed, err := CoreSeed(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.Mix = ka.Mix
+
+	w, err := NewWaver(key, nonce, false, WithMix(ka.Mix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ref := make([]byte, coreCompareLen)
+	w.Read(ref)
+	return seed, ref
+}
+
+// TestCoreMatchesWaver checks that core.Generator matches the keystream
+// known answers and the Waver.
+func TestCoreMatchesWaver(t *testing.T) {
+	var g core.Generator
+	defer g.Wipe()
+	out := make([]byte, coreCompareLen)
+
+	for _, ka := range KnownAnswers {
+		if ka.Legacy {
+			continue
+		}
+		seed, ref := coreSeed(t, ka)
+
+		// Read in uneven pieces, then XOR over zeros, both from the start.
+		g.Init(seed)
+		for i, n := 0, 1; i < len(out); i, n = i+n, n%97+1 {
+			g.Read(out[i:min(i+n, len(out))])
+		}
+		prefix, _ := hex.DecodeString(ka.Prefix)
+		digest, _ := hex.DecodeString(ka.Digest)
+		sum := sha256.Sum256(out[:knownAnswerLen])
+		if !bytes.Equal(out[:len(prefix)], prefix) || !bytes.Equal(sum[:], digest) {
+			t.Errorf("core known answer mismatch for key %q nonce %s mix %s: got prefix %x", ka.Key, ka.Nonce, ka.Mix, out[:len(prefix)])
+		}
+		if !bytes.Equal(out, ref) {
+			t.Errorf("core keystream for key %q nonce %s mix %s differs from the Waver", ka.Key, ka.Nonce, ka.Mix)
+		}
+
+		g.Init(seed)
+		clear(out)
+		g.XORKeyStream(out, out)
+		if !bytes.Equal(out, ref) {
+			t.Errorf("core XORKeyStream for key %q nonce %s mix %s differs from the Waver", ka.Key, ka.Nonce, ka.Mix)
+		}
+		*seed = core.Seed{}
+	}
+}
+
+// TestCoreAllocs checks that initializing the generator and producing
+// keystream allocate nothing.
+func TestCoreAllocs(t *testing.T) {
+	var g core.Generator
+	defer g.Wipe()
+	out := make([]byte, 4096)
+
+	for _, mix := range []Mix{MixStarGate, MixXXH3} {
+		seed, _ := coreSeed(t, KnownAnswer{Key: "StarGate KAT key 1", Nonce: "000102030405060708090a0b0c0d0e0f", Mix: mix})
+		n := testing.AllocsPerRun(10, func() {
+			g.Init(seed)
+			g.Read(out)
+			g.XORKeyStream(out, out)
+		})
+		if n != 0 {
+			t.Errorf("mix %s: core generator made %v allocations", mix, n)
+		}
+		*seed = core.Seed{}
+	}
+}
@@ -0,0 +1,301 @@
+package sg
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DRBG limits, shaped after NIST SP 800-90A.
+const (
+	// DRBGEntropySize is the entropy input read per instantiate and reseed
+	// for 256 bits of security strength. Instantiate also reads a nonce.
+	DRBGEntropySize = 32
+	// MaxDRBGRequest is the most bytes a single Generate call returns.
+	MaxDRBGRequest = 1 << 16
+	// DefaultReseedInterval is how many Generate calls may pass between
+	// reseeds.
+	DefaultReseedInterval = 1 << 20
+	// MaxReseedInterval is the upper bound SP 800-90A sets.
+	MaxReseedInterval = 1 << 48
+)
+
+var (
+	ErrDRBGRequestTooLarge = errors.New("DRBG request exceeds MaxDRBGRequest")
+	ErrDRBGClosed          = errors.New("DRBG is uninstantiated")
+	// ErrDRBGHealth is returned once a health test has failed. The DRBG
+	// then refuses all further requests and has to be instantiated again.
+	ErrDRBGHealth = errors.New("DRBG health test failed")
+)
+
+// WithEntropySource replaces crypto/rand as the DRBG entropy source. A
+// deterministic source is only meant for known-answer tests.
+func WithEntropySource(r io.Reader) Option {
+	return func(o *options) {
+		o.entropy = r
+	}
+}
+
+// WithReseedInterval sets how many Generate calls may pass between
+// reseeds, at most MaxReseedInterval.
+func WithReseedInterval(n uint64) Option {
+	return func(o *options) {
+		if n > 0 && n <= MaxReseedInterval {
+			o.reseedInterval = n
+		}
+	}
+}
+
+// WithPredictionResistance makes every Generate call reseed first.
+func WithPredictionResistance() Option {
+	return func(o *options) {
+		o.predictionResistance = true
+	}
+}
+
+// DRBG is a deterministic random bit generator on top of the Waver with the
+// SP 800-90A life cycle: Instantiate, Generate, Reseed, Uninstantiate.
+//
+// Reseeding and additional input are mixed into the matrix and the gates
+// through HKDF-SHA512. After every Generate the whole state is replaced by
+// fresh generator output (fast key erasure), so a later compromise of the
+// state does not reveal earlier output.
+//
+// Health tests: the keystream known answers are checked once per process
+// before the first instantiation, every entropy input is checked against
+// the previous one and for being constant, and every output block is
+// compared with the one before it. A failure puts the DRBG into an error
+// state.
+//
+// A DRBG is safe for concurrent use.
+type DRBG struct {
+	mu            sync.Mutex
+	w             *Waver
+	o             options
+	reseedCounter uint64
+	lastEntropy   [DRBGEntropySize]byte
+	lastBlock     [BlockSize]byte
+	failed        bool
+}
+
+var (
+	drbgSelfTestOnce sync.Once
+	drbgSelfTestErr  error
+)
+
+// Instantiate seeds a new DRBG from the entropy source. personalization
+// is optional and separates instances, for example by device or purpose.
+func Instantiate(personalization []byte, opts ...Option) (*DRBG, error) {
+	drbgSelfTestOnce.Do(func() {
+		drbgSelfTestErr = KnownAnswers[0].Check()
+	})
+	if drbgSelfTestErr != nil {
+		return nil, errors.Join(ErrDRBGHealth, drbgSelfTestErr)
+	}
+
+	d := &DRBG{o: newOptions(opts)}
+
+	entropy, err := d.readEntropy()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(entropy)
+
+	var nonce Nonce
+	if _, err := io.ReadFull(d.o.entropy, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	material := append(entropy, personalization...)
+	defer wipe(material)
+
+	seed := NewKey(material)
+	defer seed.Destroy()
+
+	if d.w, err = newWaver(seed, nonce, false, options{mix: d.o.mix}); err != nil {
+		return nil, err
+	}
+	d.reseedCounter = 1
+
+	return d, nil
+}
+
+// readEntropy reads one entropy input and runs the repetition health tests
+// on it.
+func (d *DRBG) readEntropy() ([]byte, error) {
+	entropy := make([]byte, DRBGEntropySize)
+	if _, err := io.ReadFull(d.o.entropy, entropy); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(entropy, d.lastEntropy[:]) ||
+		bytes.Count(entropy, entropy[:1]) == len(entropy) {
+		d.failed = true
+		return nil, ErrDRBGHealth
+	}
+	copy(d.lastEntropy[:], entropy)
+
+	return entropy, nil
+}
+
+// Reseed mixes fresh entropy and the optional additional input into the
+// state and resets the reseed counter.
+func (d *DRBG) Reseed(additional []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.reseed(additional)
+}
+
+func (d *DRBG) reseed(additional []byte) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	entropy, err := d.readEntropy()
+	if err != nil {
+		return err
+	}
+	defer wipe(entropy)
+
+	material := append(entropy, additional...)
+	defer wipe(material)
+
+	d.w.mixSeed(material, "StarGate DRBG Reseed")
+	d.reseedCounter = 1
+	return nil
+}
+
+// Generate fills out with random bytes. additional is optional input mixed
+// into the state before generating. Requests are limited to
+// MaxDRBGRequest bytes. The DRBG reseeds itself when the reseed interval
+// has passed, or before every call with prediction resistance.
+func (d *DRBG) Generate(out, additional []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(); err != nil {
+		return err
+	}
+	if len(out) > MaxDRBGRequest {
+		return ErrDRBGRequestTooLarge
+	}
+
+	if d.o.predictionResistance || d.reseedCounter > d.o.reseedInterval {
+		if err := d.reseed(additional); err != nil {
+			return err
+		}
+		additional = nil
+	}
+
+	if len(additional) > 0 {
+		d.w.mixSeed(additional, "StarGate DRBG Additional Input")
+	}
+
+	var block [BlockSize]byte
+	for len(out) > 0 {
+		d.w.Read(block[:])
+		if block == d.lastBlock {
+			d.failed = true
+			clear(block[:])
+			return ErrDRBGHealth
+		}
+		d.lastBlock = block
+
+		out = out[copy(out, block[:]):]
+	}
+	clear(block[:])
+
+	d.w.eraseKey()
+	d.reseedCounter++
+	return nil
+}
+
+// Read implements io.Reader through Generate without additional input,
+// splitting large reads into several requests.
+func (d *DRBG) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); n += MaxDRBGRequest {
+		if err := d.Generate(p[n:min(n+MaxDRBGRequest, len(p))], nil); err != nil {
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReseedCounter returns the number of Generate calls since the last
+// (re)seed, plus one.
+func (d *DRBG) ReseedCounter() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reseedCounter
+}
+
+// Uninstantiate wipes the state. The DRBG cannot be used afterwards.
+func (d *DRBG) Uninstantiate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.w != nil {
+		d.w.Close()
+		d.w = nil
+	}
+	clear(d.lastEntropy[:])
+	clear(d.lastBlock[:])
+}
+
+func (d *DRBG) check() error {
+	if d.failed {
+		return ErrDRBGHealth
+	}
+	if d.w == nil {
+		return ErrDRBGClosed
+	}
+	return nil
+}
+
+// mixSeed XORs HKDF-SHA512 output over seed material into the matrix and
+// the gates, then runs a few blocks to spread it along the walk.
+func (w *Waver) mixSeed(material []byte, info string) {
+	var mix [StateLen]byte
+	io.ReadFull(hkdf.New(sha512.New, material, nil, []byte(info)), mix[:])
+
+	w.xorState(&mix)
+	wipe(mix[:])
+
+	w.blockPos = BlockSize
+	w.WarmUp(4 * BlockSize)
+}
+
+// eraseKey replaces the whole state with generator output, so the state
+// that produced earlier output is gone.
+func (w *Waver) eraseKey() {
+	var next [StateLen]byte
+	w.Read(next[:])
+
+	w.Matrix = [16][16]byte{}
+	w.Gates = [16]MatrixGate{}
+	w.xorState(&next)
+	wipe(next[:])
+
+	w.blockPos = BlockSize
+}
+
+func (w *Waver) xorState(s *[StateLen]byte) {
+	for i := range 16 {
+		for j := range 16 {
+			w.Matrix[i][j] ^= s[i*16+j]
+		}
+	}
+
+	for g := range w.Gates {
+		for i := range 4 {
+			for j := range 4 {
+				w.Gates[g].Matrix[i][j] ^= s[256+g*16+i*4+j]
+			}
+		}
+	}
+}
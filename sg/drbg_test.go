@@ -0,0 +1,46 @@
+package sg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// TestDRBGKnownAnswer runs the DRBG through its life cycle with the
+// keystream of a fixed key as entropy source: three 64-byte Generate
+// calls, the second with additional input and the third after a Reseed.
+func TestDRBGKnownAnswer(t *testing.T) {
+	const want = "e555c1c34a85df5869628eb7998f7c93c61c52a046da8184c614111b89d8ab12"
+
+	key := KeyFromString("StarGate DRBG KAT entropy")
+	defer key.Destroy()
+
+	entropy, err := NewWaver(key, Nonce{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entropy.Close()
+
+	d, err := Instantiate([]byte("StarGate DRBG KAT"), WithEntropySource(entropy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Uninstantiate()
+
+	out := make([]byte, 3*BlockSize)
+	steps := []func() error{
+		func() error { return d.Generate(out[:64], nil) },
+		func() error { return d.Generate(out[64:128], []byte("additional input")) },
+		func() error { return d.Reseed(nil) },
+		func() error { return d.Generate(out[128:], nil) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if sum := sha256.Sum256(out); hex.EncodeToString(sum[:]) != want {
+		t.Errorf("got %x, want %s", sum, want)
+	}
+}
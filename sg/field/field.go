@@ -0,0 +1,291 @@
+// Package field encrypts single values, such as struct fields, JSON
+// properties and SQL columns, with StarGate AEAD.
+//
+// A Column names what a value is, and the name is the associated data of
+// every value sealed for it: a value copied from the ssn column into the
+// email column does not open there. Encrypted[T] holds a value together
+// with its Column and implements json.Marshaler, json.Unmarshaler,
+// sql.Scanner and driver.Valuer, so it can stand in for T in a struct:
+//
+//	type User struct {
+//		ID  int64
+//		SSN field.Encrypted[string]
+//	}
+//
+//	u.SSN = field.New(ssnColumn, "078-05-1120")
+//
+// Decoding needs the Column too. Set it on the destination first:
+//
+//	u.SSN.Column = ssnColumn
+//	err := row.Scan(&u.ID, &u.SSN)
+//
+// Sealed values are base64 text: version(1) | nonce(16) | ciphertext | tag(32).
+// The plaintext is T encoded as JSON.
+//
+// # Deterministic encryption
+//
+// By default every value gets a random nonce, so the same value sealed
+// twice gives two different ciphertexts and nothing about equal values is
+// revealed. That also means a column cannot be searched by value.
+//
+// A column created with Deterministic derives the nonce from the column
+// name and the plaintext instead, with the StarGate MAC under a separate
+// key, so equal values give equal ciphertexts and
+//
+//	v, _ := field.New(emailColumn, "alice@example.com").Value()
+//	db.Query("SELECT id FROM users WHERE email = ?", v)
+//
+// finds the row. The price is that anyone who can read the column sees
+// which rows hold the same value, and how often each value occurs. Use it
+// only for columns that must be looked up and whose values are close to
+// unique, like e-mail addresses, never for low-cardinality values such as
+// booleans, states or birth years.
+package field
+
+import (
+	"crypto/sha512"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"stargate/sg"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// version is the version byte of sealed values.
+const version = 1
+
+var (
+	ErrNoColumn = errors.New("field: value has no Column")
+	ErrFormat   = errors.New("field: malformed sealed value")
+)
+
+// Cipher holds the keys of a set of columns.
+type Cipher struct {
+	aead *sg.AEAD
+
+	// siv derives the nonces of deterministic columns.
+	mu  sync.Mutex
+	siv *sg.MAC
+}
+
+// NewCipher derives the field keys from key.
+func NewCipher(key *sg.Key) (*Cipher, error) {
+	aead, err := sg.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var b [64]byte
+	io.ReadFull(hkdf.New(sha512.New, key.Bytes(), nil, []byte("StarGate field nonce")), b[:])
+	sivKey := sg.NewKey(b[:])
+	clear(b[:])
+	defer sivKey.Destroy()
+
+	siv, err := sg.NewMAC(sivKey)
+	if err != nil {
+		aead.Close()
+		return nil, err
+	}
+
+	return &Cipher{aead: aead, siv: siv}, nil
+}
+
+// Close wipes the keys. Columns of the Cipher must not be used afterwards.
+func (c *Cipher) Close() {
+	c.aead.Close()
+	c.siv.Close()
+}
+
+// Column is a named column of a Cipher.
+type Column struct {
+	c             *Cipher
+	name          string
+	deterministic bool
+}
+
+// Column returns the column name with a random nonce for every value.
+func (c *Cipher) Column(name string) *Column {
+	return &Column{c: c, name: name}
+}
+
+// Deterministic returns the column name with nonces derived from the
+// values, so equal values seal to equal ciphertexts. See the package
+// documentation for what that gives away.
+func (c *Cipher) Deterministic(name string) *Column {
+	return &Column{c: c, name: name, deterministic: true}
+}
+
+func (col *Column) Name() string {
+	return col.name
+}
+
+// Seal encrypts plaintext for the column.
+func (col *Column) Seal(plaintext []byte) ([]byte, error) {
+	var nonce sg.Nonce
+	if col.deterministic {
+		nonce = col.c.syntheticNonce(col.name, plaintext)
+	} else {
+		var err error
+		if nonce, err = sg.GenNonce(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, 0, 1+sg.NonceSize+len(plaintext)+sg.AEADOverhead)
+	out = append(out, version)
+	out = append(out, nonce[:]...)
+	return col.c.aead.Seal(out, nonce[:], plaintext, []byte(col.name)), nil
+}
+
+// Open checks and decrypts a value sealed by Seal for the same column.
+func (col *Column) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < 1+sg.NonceSize+sg.AEADOverhead || sealed[0] != version {
+		return nil, ErrFormat
+	}
+	nonce := sealed[1 : 1+sg.NonceSize]
+	return col.c.aead.Open(nil, nonce, sealed[1+sg.NonceSize:], []byte(col.name))
+}
+
+// syntheticNonce is the first NonceSize bytes of the MAC of the column name
+// and the plaintext, each length-prefixed.
+func (c *Cipher) syntheticNonce(name string, plaintext []byte) sg.Nonce {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lens [8]byte
+	c.siv.Reset()
+	binary.BigEndian.PutUint64(lens[:], uint64(len(name)))
+	c.siv.Write(lens[:])
+	c.siv.Write([]byte(name))
+	binary.BigEndian.PutUint64(lens[:], uint64(len(plaintext)))
+	c.siv.Write(lens[:])
+	c.siv.Write(plaintext)
+
+	var n sg.Nonce
+	copy(n[:], c.siv.Sum(nil))
+	return n
+}
+
+// Encrypted holds Plain, a value of type T stored encrypted for Column. The
+// zero value has no Column and can neither be encoded nor decoded. Null
+// stands for SQL NULL and JSON null, which are stored as they are.
+type Encrypted[T any] struct {
+	Plain  T
+	Null   bool
+	Column *Column
+}
+
+// New returns v to be stored in col.
+func New[T any](col *Column, v T) Encrypted[T] {
+	return Encrypted[T]{Plain: v, Column: col}
+}
+
+// seal returns the base64 text of the sealed value.
+func (e Encrypted[T]) seal() (string, error) {
+	if e.Column == nil {
+		return "", ErrNoColumn
+	}
+
+	plaintext, err := json.Marshal(e.Plain)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := e.Column.Seal(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts the base64 text s into e.Plain.
+func (e *Encrypted[T]) open(s []byte) error {
+	if e.Column == nil {
+		return ErrNoColumn
+	}
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
+	n, err := base64.StdEncoding.Decode(sealed, s)
+	if err != nil {
+		return ErrFormat
+	}
+	plaintext, err := e.Column.Open(sealed[:n])
+	if err != nil {
+		return fmt.Errorf("field %s: %w", e.Column.name, err)
+	}
+
+	var v T
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return fmt.Errorf("field %s: %w", e.Column.name, err)
+	}
+	e.Plain, e.Null = v, false
+	return nil
+}
+
+// MarshalJSON encodes the sealed value as a JSON string.
+func (e Encrypted[T]) MarshalJSON() ([]byte, error) {
+	if e.Null {
+		return []byte("null"), nil
+	}
+	s, err := e.seal()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON decrypts a JSON string written by MarshalJSON. e.Column
+// must be set.
+func (e *Encrypted[T]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		var zero T
+		e.Plain, e.Null = zero, true
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return e.open([]byte(s))
+}
+
+// Value returns the sealed value as a string, for TEXT and BLOB columns
+// alike.
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	if e.Null {
+		return nil, nil
+	}
+	return e.seal()
+}
+
+// Scan decrypts a string or []byte written by Value. e.Column must be set.
+func (e *Encrypted[T]) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return e.open([]byte(src))
+	case []byte:
+		return e.open(src)
+	case nil:
+		var zero T
+		e.Plain, e.Null = zero, true
+		return nil
+	default:
+		return fmt.Errorf("field: cannot scan %T into Encrypted", src)
+	}
+}
+
+// String never reveals the value, so an Encrypted printed with %v by
+// mistake does not leak it.
+func (e Encrypted[T]) String() string {
+	return "field.Encrypted(REDACTED)"
+}
+
+func (e Encrypted[T]) GoString() string {
+	return e.String()
+}
@@ -0,0 +1,137 @@
+package field
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"stargate/sg"
+	"testing"
+)
+
+// knownDeterministic is "alice@example.com" sealed for the deterministic
+// column "email" under knownKey. It pins the nonce derivation, the sealed
+// format and the plaintext encoding: if it changes, lookups no longer
+// match the values already stored.
+const knownDeterministic = "AWaX2WXoGFi5e5T++wNJHPfMpO+H18w/kCCKIvTRvqLnaEXnedZAd5tUPSnPieDVaNCXdlZAN94Kw2lif+i9sfCkkmY="
+
+func knownKey() *sg.Key {
+	b := make([]byte, 64)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return sg.NewKey(b)
+}
+
+type checkRecord struct {
+	Email Encrypted[string]   `json:"email"`
+	Notes Encrypted[[]string] `json:"notes"`
+	Age   Encrypted[int]      `json:"age"`
+}
+
+func testCipher(t *testing.T, key *sg.Key) *Cipher {
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// TestField checks the known deterministic value, round trips through JSON
+// and the SQL interfaces, and that values do not open in another column,
+// under another key or after a change.
+func TestField(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+	c := testCipher(t, key)
+
+	email := c.Deterministic("email")
+	notes := c.Column("notes")
+	age := c.Column("age")
+
+	known, err := New(email, "alice@example.com").seal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known != knownDeterministic {
+		t.Errorf("deterministic value: got %s, want %s", known, knownDeterministic)
+	}
+	if b, _ := base64.StdEncoding.DecodeString(sqlValue(New(notes, "x")).(string)); len(b) == 0 || b[0] != version {
+		t.Error("randomized value does not start with the version byte")
+	}
+
+	// JSON round trip, with a NULL.
+	in := checkRecord{
+		Email: New(email, "alice@example.com"),
+		Notes: New(notes, []string{"prefers e-mail", "VIP"}),
+		Age:   Encrypted[int]{Null: true, Column: age},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := checkRecord{
+		Email: Encrypted[string]{Column: email},
+		Notes: Encrypted[[]string]{Column: notes},
+		Age:   Encrypted[int]{Column: age},
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if out.Email.Plain != "alice@example.com" || len(out.Notes.Plain) != 2 || out.Notes.Plain[1] != "VIP" || !out.Age.Null {
+		t.Error("json: values changed in the round trip")
+	}
+
+	// SQL round trip.
+	v, err := New(age, 42).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned := Encrypted[int]{Column: age}
+	if err := scanned.Scan([]byte(v.(string))); err != nil || scanned.Plain != 42 {
+		t.Errorf("sql: got %d, %v", scanned.Plain, err)
+	}
+	if v, err := (Encrypted[int]{Null: true, Column: age}).Value(); v != nil || err != nil {
+		t.Error("sql: NULL is not stored as NULL")
+	}
+
+	// Equality lookups work on deterministic columns only.
+	if a, b := sqlValue(New(email, "bob@example.com")), sqlValue(New(email, "bob@example.com")); a != b {
+		t.Error("deterministic column sealed equal values differently")
+	}
+	if a, b := sqlValue(New(notes, "x")), sqlValue(New(notes, "x")); a == b {
+		t.Error("randomized column sealed equal values equally")
+	}
+
+	other := sg.KeyFromString("another key")
+	defer other.Destroy()
+	oc := testCipher(t, other)
+
+	cases := []struct {
+		name string
+		dst  *Encrypted[string]
+		src  string
+	}{
+		{"other column", &Encrypted[string]{Column: c.Deterministic("name")}, known},
+		{"other key", &Encrypted[string]{Column: oc.Deterministic("email")}, known},
+		{"changed value", &Encrypted[string]{Column: email}, known[:10] + flipBase64(known[10]) + known[11:]},
+		{"no column", &Encrypted[string]{}, known},
+	}
+	for _, tc := range cases {
+		if err := tc.dst.Scan(tc.src); err == nil {
+			t.Errorf("%s: value opened", tc.name)
+		}
+	}
+}
+
+func sqlValue[T any](e Encrypted[T]) driver.Value {
+	v, _ := e.Value()
+	return v
+}
+
+func flipBase64(c byte) string {
+	if c == 'A' {
+		return "B"
+	}
+	return "A"
+}
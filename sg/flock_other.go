@@ -0,0 +1,15 @@
+//go:build !unix
+
+package sg
+
+import "os"
+
+// lockFile is a no-op where flock is not available: only one process may
+// use a file that relies on it at a time.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
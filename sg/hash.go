@@ -0,0 +1,174 @@
+package sg
+
+import (
+	"errors"
+	"sync"
+)
+
+// HashRate is how many bytes the sponge absorbs and squeezes per
+// permutation: rows 0-3 of the matrix, the rows refillBlock extracts.
+const HashRate = 4 * 16
+
+// HashRounds is the number of mixing rounds in one permutation. With four,
+// "stargate hash analyze" finds truncated digests of counters far from
+// uniform; eight is the fewest that pass.
+const HashRounds = 8
+
+// Hash is an EXPERIMENTAL sponge hash over the Waver matrix permutation,
+// meant for studying the construction, not for production use. It
+// implements hash.Hash with a configurable Size, and its output can also be
+// read as an extendable-output function through Read.
+//
+// The state is the matrix, the gates and the walk position, fixed at start
+// by keying a Waver with a public constant. Message blocks are XORed into
+// rows 0-3 and followed by one permutation. A round of the permutation is
+// eight XORCross steps along the walk, a gate pass over rows 0-3, a
+// LightShuffle and a step of the walk; ReinitFromHash is left out, as it
+// rebuilds the matrix from 64 bits and would cap collision resistance at
+// 2^32. Padding is 0x01, zeros, 0x80.
+type Hash struct {
+	w         Waver
+	size      int
+	buf       [HashRate]byte
+	n         int
+	squeezing bool
+}
+
+var (
+	hashIVOnce sync.Once
+	hashIV     Waver
+)
+
+func hashInitialState() Waver {
+	hashIVOnce.Do(func() {
+		key := KeyFromString("StarGate Hash")
+		defer key.Destroy()
+
+		w, err := newWaver(key, Nonce{}, false, options{})
+		if err != nil {
+			panic(err)
+		}
+		hashIV = *w
+		hashIV.LastPool = nil
+	})
+	return hashIV
+}
+
+// NewHash returns a Hash whose Sum yields size bytes.
+func NewHash(size int) (*Hash, error) {
+	if size < 1 {
+		return nil, errors.New("hash size must be positive")
+	}
+
+	h := &Hash{size: size}
+	h.Reset()
+	return h, nil
+}
+
+func (h *Hash) Write(p []byte) (int, error) {
+	if h.squeezing {
+		panic("sg: Hash written to after Read")
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		k := copy(h.buf[h.n:], p)
+		h.n += k
+		p = p[k:]
+
+		if h.n == HashRate {
+			h.w.absorbRate(&h.buf)
+			h.n = 0
+		}
+	}
+
+	return n, nil
+}
+
+// Sum appends Size bytes of output to b without changing the state.
+func (h *Hash) Sum(b []byte) []byte {
+	d := *h
+	out := make([]byte, h.size)
+	d.Read(out)
+	d.w.Close()
+	return append(b, out...)
+}
+
+// Read squeezes output of any length. The first call pads and finishes
+// the input; writing afterwards panics.
+func (h *Hash) Read(p []byte) (int, error) {
+	if !h.squeezing {
+		clear(h.buf[h.n:])
+		h.buf[h.n] ^= 0x01
+		h.buf[HashRate-1] ^= 0x80
+		h.w.absorbRate(&h.buf)
+
+		h.squeezing = true
+		h.squeezeRate()
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		if h.n == HashRate {
+			h.w.permute()
+			h.squeezeRate()
+		}
+
+		k := copy(p, h.buf[h.n:])
+		h.n += k
+		p = p[k:]
+	}
+
+	return n, nil
+}
+
+func (h *Hash) squeezeRate() {
+	for r := range 4 {
+		copy(h.buf[r*16:], h.w.Matrix[r][:])
+	}
+	h.n = 0
+}
+
+func (h *Hash) Reset() {
+	h.w = hashInitialState()
+	h.buf = [HashRate]byte{}
+	h.n = 0
+	h.squeezing = false
+}
+
+func (h *Hash) Size() int {
+	return h.size
+}
+
+func (h *Hash) BlockSize() int {
+	return HashRate
+}
+
+// absorbRate XORs one block into rows 0-3 and permutes.
+func (w *Waver) absorbRate(block *[HashRate]byte) {
+	for i, b := range block {
+		w.Matrix[i/16][i%16] ^= b
+	}
+	w.permute()
+}
+
+func (w *Waver) permute() {
+	for range HashRounds {
+		for r := 0; r < 8; r++ {
+			w.XORCross((w.Y+r)%16, (w.X-r+16)%16)
+		}
+
+		gate := &w.Gates[w.blockIndex%len(w.Gates)]
+		for r := 0; r < 4; r++ {
+			row := &w.Matrix[r]
+			for i := 0; i < 16; i++ {
+				row[i] = gate.PassValue(row[i], w.OffsetSum+i+r+w.blockIndex)
+				w.OffsetSum += int(row[i])
+			}
+		}
+
+		w.LightShuffle()
+		w.changePosition()
+		w.blockIndex++
+	}
+}
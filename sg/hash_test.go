@@ -0,0 +1,47 @@
+package sg
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// hashVectors pin the digest of a message. A size beyond HashRate
+// squeezes more than one block.
+var hashVectors = []struct {
+	message string
+	size    int
+	digest  string
+}{
+	{"", 32, "ca376aae036121ee9e5c0b5ea38105060b2c429efe5127ea39e1935d54d3f272"},
+	{"abc", 32, "dfb1f5e1ccab03db6d276986c8ca916ea086d1c8eb97315f81b4ceda15465dd7"},
+	{strings.Repeat("StarGate hash known answer. ", 10), 32, "dcfd90122a44db3d397a2211ba7edf54ffb4d2afa970a67b64d7148115a61f53"},
+	{"abc", 100, "dfb1f5e1ccab03db6d276986c8ca916ea086d1c8eb97315f81b4ceda15465dd7" +
+		"51e87aa102728dd6797baf42dc55c06b23a5f03f9384c26a5c35f24a8135aadf" +
+		"5941fdc73234e2a13a4136bab0e23f30bc2eecf5d106c02cfa1da0c0646eb9b5" +
+		"0975b241"},
+}
+
+// TestHashVectors computes every digest with Sum and again by reading it
+// byte by byte.
+func TestHashVectors(t *testing.T) {
+	for _, tt := range hashVectors {
+		h, err := NewHash(tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.Write([]byte(tt.message))
+		sum := hex.EncodeToString(h.Sum(nil))
+
+		read := make([]byte, tt.size)
+		for i := range read {
+			h.Read(read[i : i+1])
+		}
+
+		if sum != tt.digest || hex.EncodeToString(read) != tt.digest {
+			t.Errorf("message of %d bytes, size %d: got %s and %x read, want %s",
+				len(tt.message), tt.size, sum, read, tt.digest)
+		}
+	}
+}
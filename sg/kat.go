@@ -0,0 +1,226 @@
+package sg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"stargate/sg/core"
+	"strings"
+)
+
+// KnownAnswer pins the keystream for a key and nonce. Prefix is the first
+// 32 bytes, Digest the SHA-256 of the first 4096 bytes. Any change to the
+// algorithm that alters output must fail these.
+type KnownAnswer struct {
+	Key    string
+	Nonce  string
+	Legacy bool
+	Mix    Mix
+	Prefix string
+	Digest string
+}
+
+var KnownAnswers = []KnownAnswer{
+	{
+		Key:    "StarGate KAT key 1",
+		Nonce:  "000102030405060708090a0b0c0d0e0f",
+		Prefix: "fdfb17854804f6ee6c7e834e25f7bbe5b5a408dca4c8df6d898b31bdd8547a98",
+		Digest: "444500f4813627230ef54a74b67457223fc4f63cb00f7fa0f775a19cba8c9a3d",
+	},
+	{
+		Key:    "StarGate KAT key 2",
+		Nonce:  "ffffffffffffffffffffffffffffffff",
+		Prefix: "4b558b3b3dd8c62a6e17107f8d215f13756fab81ff5dc40b6ee83e75bc5db76e",
+		Digest: "e6bd948ccde003663fda2eab9706f8b7a49cc8a42b48226db2d54ff789388684",
+	},
+	{
+		Key:    "StarGate KAT key 1",
+		Nonce:  "000102030405060708090a0b0c0d0e0f",
+		Mix:    MixXXH3,
+		Prefix: "81eeb7ca4aa64b653bb0f8db5b6f314509c1d863647035f8a1d34f92a1ca67d3",
+		Digest: "401a364047e7d893eeff3fc824b3e1cf5dbd643d2791859b8bf59f891ce77de6",
+	},
+	{
+		Key:    "StarGate KAT key 2",
+		Nonce:  "ffffffffffffffffffffffffffffffff",
+		Mix:    MixXXH3,
+		Prefix: "d52d32263778aa4c1b2e4b71636cd56e5fc913a98885705c3a834cca50d2426d",
+		Digest: "71e500e98eac215718cfa6348dca3a77ccc1727f50e8ed61bb11cc3072be4c63",
+	},
+	{
+		Key:    "StarGate KAT key 1",
+		Nonce:  "0123456789abcdef",
+		Legacy: true,
+		Mix:    MixXXH3,
+		Prefix: "02bfd78b068a91b0c75c960fd42a363a6b673a618383bd80570d21ac1edd2f29",
+		Digest: "76801661b84658a7efe4f8fccd4efc2b048b95b7473f178b3ced176428f0607e",
+	},
+}
+
+const knownAnswerLen = 4096
+
+func (ka KnownAnswer) Check() error {
+	nonce, err := ParseNonce(ka.Nonce)
+	if err != nil {
+		return err
+	}
+
+	opts := []Option{WithMix(ka.Mix)}
+	if ka.Legacy {
+		opts = append(opts, WithLegacyNonceSchedule())
+	}
+
+	key := KeyFromString(ka.Key)
+	defer key.Destroy()
+
+	w, err := NewWaver(key, nonce, false, opts...)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	out := make([]byte, knownAnswerLen)
+	for i := range out {
+		out[i] = w.GetNext()
+	}
+
+	prefix, _ := hex.DecodeString(ka.Prefix)
+	digest, _ := hex.DecodeString(ka.Digest)
+	sum := sha256.Sum256(out)
+
+	if !bytes.Equal(out[:len(prefix)], prefix) || !bytes.Equal(sum[:], digest) {
+		return fmt.Errorf("known answer mismatch for key %q nonce %s mix %s: got prefix %x", ka.Key, ka.Nonce, ka.Mix, out[:len(prefix)])
+	}
+
+	return nil
+}
+
+// AEADKnownAnswer pins the output of AEAD.Seal. Sealed is the ciphertext
+// followed by the tag. They are checked by the sg tests and, through
+// capi/internal/katgen, by the C tests.
+type AEADKnownAnswer struct {
+	Key       string
+	Nonce     string
+	Plaintext string
+	AD        string
+	Mix       Mix
+	Sealed    string
+}
+
+var AEADKnownAnswers = []AEADKnownAnswer{
+	{
+		Key:    "StarGate AEAD key 1",
+		Nonce:  "000102030405060708090a0b0c0d0e0f",
+		AD:     "header",
+		Sealed: "653f1dc4be4fc1422483b54024269e7099ef10d749dbe2b5a8943e4dc0d49094",
+	},
+	{
+		Key:       "StarGate AEAD key 1",
+		Nonce:     "000102030405060708090a0b0c0d0e0f",
+		Plaintext: "StarGate AEAD known answer",
+		AD:        "header",
+		Sealed: "f5bc6a2ca719b2c15409e768c60be5491cbd581d02576518edb7ce291a358773" +
+			"e13933179cfa5978ac23d4ea95629960a42838729e9247ceea6a",
+	},
+	{
+		Key:       "StarGate AEAD key 2",
+		Nonce:     "ffffffffffffffffffffffffffffffff",
+		Plaintext: strings.Repeat("StarGate AEAD known answer. ", 10),
+		Sealed: "54dff99bb31c10c5a51690404aa2acb849c805c65944f0cc727a106fa1fc8da3" +
+			"250095c25aca9027fb1695f9b4a1dd77b91e359b3031455b8b6ec5a307a9ce72" +
+			"473929093c2a8ed6ca30548b77aceeb535744c133238276d38bfe4bfedf812c4" +
+			"4af0163ff445afb2fca06e14d9dd7856aa6f481baeb9316c58a9848ccf543003" +
+			"47eba7d9c421f47f4fa10dfe9b6a766242fb105061e7213c668e32d19f926f20" +
+			"dc6b60c31e0c3083389c4f7ec0e0ab16003e0fdfed6ee574080368b4e6fff8b8" +
+			"059db68ed077582a50c7e12dd9bf55a24d0a58e58dfce430ec5812dbb68ed5ca" +
+			"b8eedc025b33eae610891448ce016ea2ea4706b3ffb8d2173f771208cfe44a33" +
+			"e00ed7eb8f355b4045fa92a1c49b17b70cddc7c68b7138e1ea38a5a8c1c3bc6c" +
+			"fa9346676331e3537a6f07f2eb5ed4354ff61199477656f9",
+	},
+	{
+		Key:       "StarGate AEAD key 1",
+		Nonce:     "000102030405060708090a0b0c0d0e0f",
+		Plaintext: "StarGate AEAD known answer",
+		AD:        "header",
+		Mix:       MixXXH3,
+		Sealed: "04677ca841a08580e18a120ff344489a87f2a550747fc910303de11146375146" +
+			"01a10df53a1256fc80a2227e771f9c5f3e1a4bc6ad60eb51844c",
+	},
+}
+
+// MixKnownAnswer pins a reinit mix on the matrix that holds the bytes 0 to
+// 255 row by row: Hash is core.HashMatrix of it, Reinit the matrix after
+// core.Reinit.
+type MixKnownAnswer struct {
+	Mix    Mix
+	Hash   uint64
+	Reinit string
+}
+
+var MixKnownAnswers = []MixKnownAnswer{
+	{
+		Mix:  MixStarGate,
+		Hash: 0x4f400d58e33418c2,
+		Reinit: "b381170ac3d327fb1c27f79b6d35662900abb8b7485873a6cb346884790620f8" +
+			"d31462634254c9c43c9a622eea76a865e695f53291428f5b7c2e5acba7c442c7" +
+			"36782d028be4eec93eb6e69beaf569399b75c3b1bebd86998999487f5130ad86" +
+			"7d1372fb25a9bcb7aff9a7154ed82e276537bfcecb11b3fd1e0f02a0e7294625" +
+			"4c41c978cd6bed4d90b1fd040e3186e879635d9ce84869500df59c3819083ef2" +
+			"484775630e473d8631b21b4d7a3ca188ecfeb2cfebc0344420adc4452c9f5343" +
+			"0ace56fce531915c4e12a5a6aefb822efdc36f1cd635957ce1365bb482ff1f2a" +
+			"b49a82f3cc26647b70240a967e12bd39dcf2c94b12ccbb96773bf6b0a202def8",
+	},
+	{
+		Mix:  MixXXH3,
+		Hash: 0x9408a4433b952d71,
+		Reinit: "9edb47c974680818e442d3c86580d37b037ac046b5910c1ef6a7947c415724c3" +
+			"0daa959e24835da53d5f6fd90eaddb1943b86f2de91d7516e43b58123e7b46a6" +
+			"5943f7881af67885a00b34ef77b0f0af2a5f1b07062a547ced72b449b78fcc90" +
+			"36730730293c1db890582980279a8261401bd19e3c97c78d8968889051c2f2d6" +
+			"025d94b418d6d0f96796ead605927742ea77be2e371138c38488f0266e22ecf4" +
+			"7508ac979bcf4bf389244d6d13f6e4cbd443b9c52ee0e2e8b795c95ef0416e15" +
+			"e6190ccb0a6d9f5f9aa565d180a3e46aa8e3578714a9fa8b4e6a3533124b39bc" +
+			"3f2eb0276bc8a33cfe3b5032b5627556a418b58f68f20655de7c29d3b3ff846c",
+	},
+}
+
+// Check hashes and rebuilds the counting matrix.
+func (ka MixKnownAnswer) Check() error {
+	var m [16][16]byte
+	for i := range m {
+		for j := range m[i] {
+			m[i][j] = byte(16*i + j)
+		}
+	}
+
+	if h := core.HashMatrix(&m, ka.Mix); h != ka.Hash {
+		return fmt.Errorf("mix %s known answer mismatch: got hash %#016x", ka.Mix, h)
+	}
+
+	core.Reinit(&m, ka.Mix)
+	var got []byte
+	for i := range m {
+		got = append(got, m[i][:]...)
+	}
+	if hex.EncodeToString(got) != ka.Reinit {
+		return fmt.Errorf("mix %s known answer mismatch: got reinit %x", ka.Mix, got)
+	}
+
+	return nil
+}
+
+// SelfTest checks all MixKnownAnswers and KnownAnswers.
+func SelfTest() error {
+	for _, ka := range MixKnownAnswers {
+		if err := ka.Check(); err != nil {
+			return err
+		}
+	}
+	for _, ka := range KnownAnswers {
+		if err := ka.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
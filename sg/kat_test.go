@@ -0,0 +1,11 @@
+package sg
+
+import "testing"
+
+// TestSelfTest runs what stargate selftest runs: the mix and keystream
+// known answers.
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package sg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrEmptyKey              = errors.New("key is empty")
+	ErrMemoryLockUnsupported = errors.New("memory locking is not supported on this platform")
+)
+
+// Key holds key material outside of Go strings, so it can be wiped once it
+// is no longer needed. Keys created with NewLockedKey live in memory that is
+// locked against swapping where the platform supports it.
+//
+// String and GoString never reveal the key, so a Key can be logged or
+// printed with %v by mistake without leaking it.
+type Key struct {
+	b      []byte
+	locked bool
+}
+
+// NewKey copies b into a new Key. The caller remains responsible for
+// wiping b.
+func NewKey(b []byte) *Key {
+	k := &Key{b: make([]byte, len(b))}
+	copy(k.b, b)
+	return k
+}
+
+// NewLockedKey is NewKey with the copy placed in mlock'ed memory. It returns
+// ErrMemoryLockUnsupported on platforms without memory locking.
+func NewLockedKey(b []byte) (*Key, error) {
+	buf, err := lockedAlloc(len(b))
+	if err != nil {
+		return nil, err
+	}
+
+	copy(buf, b)
+	return &Key{b: buf, locked: true}, nil
+}
+
+// KeyFromString uses the bytes of s as the key, which is how keys given on
+// the command line have always been interpreted.
+func KeyFromString(s string) *Key {
+	return &Key{b: []byte(s)}
+}
+
+// GenKey256 generates 256 random bytes and returns them hex encoded, the
+// 512-character key format the CLI prints and accepts.
+func GenKey256() (*Key, error) {
+	raw := make([]byte, 256)
+	defer wipe(raw)
+
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	k := &Key{b: make([]byte, hex.EncodedLen(len(raw)))}
+	hex.Encode(k.b, raw)
+	return k, nil
+}
+
+// Bytes returns the key material itself, not a copy. It is wiped by Destroy.
+func (k *Key) Bytes() []byte {
+	return k.b
+}
+
+func (k *Key) Len() int {
+	return len(k.b)
+}
+
+// Clone returns an independent copy, locked if k is locked.
+func (k *Key) Clone() *Key {
+	if k.locked {
+		if c, err := NewLockedKey(k.b); err == nil {
+			return c
+		}
+	}
+	return NewKey(k.b)
+}
+
+// ID returns a short public identifier of the key. It is a truncated
+// domain-separated SHA-256 and reveals nothing useful about the key.
+func (k *Key) ID() KeyID {
+	h := sha256.New()
+	h.Write([]byte("StarGate key id\x00"))
+	h.Write(k.b)
+
+	var id KeyID
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// Destroy wipes the key material and releases locked memory. The Key must
+// not be used afterwards.
+func (k *Key) Destroy() {
+	if k == nil || k.b == nil {
+		return
+	}
+
+	if k.locked {
+		lockedFree(k.b)
+	} else {
+		wipe(k.b)
+	}
+	k.b = nil
+}
+
+func (k *Key) String() string {
+	return "sg.Key(REDACTED)"
+}
+
+func (k *Key) GoString() string {
+	return "sg.Key{REDACTED}"
+}
+
+func wipe(b []byte) {
+	clear(b)
+}
@@ -0,0 +1,77 @@
+package sg
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestKeyDestroy(t *testing.T) {
+	key := NewKey([]byte("StarGate destroy check key"))
+	b := key.Bytes()
+	key.Destroy()
+
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Errorf("Destroy left %q behind", b)
+	}
+	if key.Len() != 0 {
+		t.Errorf("destroyed key has length %d", key.Len())
+	}
+	key.Destroy()
+
+	var nilKey *Key
+	nilKey.Destroy()
+}
+
+func TestLockedKeyDestroy(t *testing.T) {
+	key, err := NewLockedKey([]byte("StarGate locked check key"))
+	if err != nil {
+		// ErrMemoryLockUnsupported, or RLIMIT_MEMLOCK is too low.
+		t.Skip("cannot lock memory:", err)
+	}
+
+	clone := key.Clone()
+	defer clone.Destroy()
+	if !clone.locked || !bytes.Equal(clone.Bytes(), key.Bytes()) {
+		t.Error("clone of a locked key is not an equal locked key")
+	}
+
+	// The memory is unmapped, so it cannot be inspected afterwards.
+	key.Destroy()
+	if key.Len() != 0 {
+		t.Errorf("destroyed key has length %d", key.Len())
+	}
+	key.Destroy()
+}
+
+func TestKeyRedacted(t *testing.T) {
+	key := KeyFromString("StarGate secret key")
+	defer key.Destroy()
+
+	for _, s := range []string{fmt.Sprint(key), fmt.Sprintf("%v %+v %#v %s", key, key, key, key)} {
+		if bytes.Contains([]byte(s), []byte("secret")) {
+			t.Errorf("key printed as %q", s)
+		}
+	}
+}
+
+func TestCipherClose(t *testing.T) {
+	key := KeyFromString("StarGate close check key")
+	defer key.Destroy()
+
+	c, err := NewCipher(key, Nonce{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	if c.key.Len() != 0 {
+		t.Error("Close left the key copy behind")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("XORKeyStream after Close did not panic")
+		}
+	}()
+	c.XORKeyStream(make([]byte, 1), make([]byte, 1))
+}
@@ -0,0 +1,294 @@
+// Package keyring stores named StarGate keys in a single file encrypted
+// under a master passphrase.
+//
+// File layout:
+//
+//	magic "STGK" | version(1) | log2 N(1) | r(1) | p(1) | salt(16) | nonce(16)
+//	| ciphertext | HMAC-SHA256 over everything before it
+//
+// The passphrase is stretched with scrypt into a StarGate key that encrypts
+// the JSON encoded entries and a separate HMAC key that authenticates the
+// whole file, so a wrong passphrase and a damaged file are both detected.
+package keyring
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"stargate/sg"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var magic = [4]byte{'S', 'T', 'G', 'K'}
+
+const (
+	version    = 1
+	saltSize   = 16
+	headerSize = 4 + 4 + saltSize + sg.NonceSize
+
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+var (
+	ErrBadPassphrase = errors.New("wrong passphrase or corrupted keyring")
+	ErrNotFound      = errors.New("no such key in keyring")
+	ErrExists        = errors.New("a key with this name already exists")
+)
+
+type Entry struct {
+	Name    string    `json:"name"`
+	Key     []byte    `json:"key"`
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Note    string    `json:"note,omitempty"`
+}
+
+type Keyring struct {
+	path       string
+	passphrase []byte
+	entries    []Entry
+}
+
+// DefaultPath is $XDG_CONFIG_HOME/stargate/keyring, falling back to the
+// platform's user config directory.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "stargate", "keyring"), nil
+}
+
+// Exists reports whether a keyring file is present at path.
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Open decrypts the keyring at path. A missing file yields an empty keyring
+// that is created on the first Save.
+func Open(path string, passphrase []byte) (*Keyring, error) {
+	kr := &Keyring{path: path, passphrase: bytes.Clone(passphrase)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return kr, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, magic[:]) {
+		return nil, errors.New("not a StarGate keyring")
+	}
+	if len(data) < headerSize+sha256.Size {
+		return nil, errors.New("truncated keyring")
+	}
+	if data[4] != version {
+		return nil, fmt.Errorf("unsupported keyring version %d", data[4])
+	}
+
+	logN, r, p := data[5], data[6], data[7]
+	salt := data[8 : 8+saltSize]
+
+	var nonce sg.Nonce
+	copy(nonce[:], data[8+saltSize:headerSize])
+
+	encKey, macKey, err := deriveKeys(passphrase, salt, logN, r, p)
+	if err != nil {
+		return nil, err
+	}
+	defer encKey.Destroy()
+
+	body, tag := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, ErrBadPassphrase
+	}
+
+	c, err := sg.NewCipher(encKey, nonce, false)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	plain := make([]byte, len(body)-headerSize)
+	c.XORKeyStream(plain, body[headerSize:])
+	defer clear(plain)
+
+	if err := json.Unmarshal(plain, &kr.entries); err != nil {
+		return nil, fmt.Errorf("corrupted keyring: %w", err)
+	}
+
+	return kr, nil
+}
+
+func deriveKeys(passphrase, salt []byte, logN, r, p byte) (*sg.Key, []byte, error) {
+	if logN < 10 || logN > 30 {
+		return nil, nil, fmt.Errorf("bad scrypt parameter log2 N = %d", logN)
+	}
+
+	dk, err := scrypt.Key(passphrase, salt, 1<<logN, int(r), int(p), 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer clear(dk)
+
+	return sg.NewKey(dk[:32]), bytes.Clone(dk[32:]), nil
+}
+
+// Save re-encrypts the keyring under a fresh salt and nonce and replaces the
+// file atomically.
+func (kr *Keyring) Save() error {
+	var salt [saltSize]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return err
+	}
+
+	nonce, err := sg.GenNonce()
+	if err != nil {
+		return err
+	}
+
+	encKey, macKey, err := deriveKeys(kr.passphrase, salt[:], scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return err
+	}
+	defer encKey.Destroy()
+
+	plain, err := json.Marshal(kr.entries)
+	if err != nil {
+		return err
+	}
+	defer clear(plain)
+
+	c, err := sg.NewCipher(encKey, nonce, false)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	out := make([]byte, 0, headerSize+len(plain)+sha256.Size)
+	out = append(out, magic[:]...)
+	out = append(out, version, scryptLogN, scryptR, scryptP)
+	out = append(out, salt[:]...)
+	out = append(out, nonce[:]...)
+
+	ct := make([]byte, len(plain))
+	c.XORKeyStream(ct, plain)
+	out = append(out, ct...)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(out)
+	out = mac.Sum(out)
+
+	if err := os.MkdirAll(filepath.Dir(kr.path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := sg.CreateAtomic(kr.path, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	if _, err := f.Write(out); err != nil {
+		return err
+	}
+
+	return f.Commit()
+}
+
+func (kr *Keyring) Add(name string, key *sg.Key, note string) error {
+	if name == "" {
+		return errors.New("key name is empty")
+	}
+	if _, err := kr.find(name); err == nil {
+		return ErrExists
+	}
+
+	kr.entries = append(kr.entries, Entry{
+		Name:    name,
+		Key:     bytes.Clone(key.Bytes()),
+		ID:      key.ID().String(),
+		Created: time.Now().UTC().Truncate(time.Second),
+		Note:    note,
+	})
+	return nil
+}
+
+func (kr *Keyring) Remove(name string) error {
+	i, err := kr.find(name)
+	if err != nil {
+		return err
+	}
+
+	clear(kr.entries[i].Key)
+	kr.entries = append(kr.entries[:i], kr.entries[i+1:]...)
+	return nil
+}
+
+func (kr *Keyring) find(name string) (int, error) {
+	for i, e := range kr.entries {
+		if e.Name == name {
+			return i, nil
+		}
+	}
+	return -1, ErrNotFound
+}
+
+// Get returns a copy of the named key. The caller should Destroy it.
+func (kr *Keyring) Get(name string) (*sg.Key, error) {
+	i, err := kr.find(name)
+	if err != nil {
+		return nil, err
+	}
+	return sg.NewKey(kr.entries[i].Key), nil
+}
+
+// FindByID returns the name and a copy of the key with the given key ID.
+func (kr *Keyring) FindByID(id sg.KeyID) (string, *sg.Key, error) {
+	want := id.String()
+	for _, e := range kr.entries {
+		if e.ID == want {
+			return e.Name, sg.NewKey(e.Key), nil
+		}
+	}
+	return "", nil, ErrNotFound
+}
+
+// Entries lists the keyring sorted by name, without key material.
+func (kr *Keyring) Entries() []Entry {
+	out := make([]Entry, len(kr.entries))
+	for i, e := range kr.entries {
+		e.Key = nil
+		out[i] = e
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Close wipes the key material and the passphrase held in memory.
+func (kr *Keyring) Close() {
+	for i := range kr.entries {
+		clear(kr.entries[i].Key)
+	}
+	clear(kr.passphrase)
+	kr.entries = nil
+}
@@ -0,0 +1,155 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"stargate/sg"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "keyring")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestOpenShort opens every prefix of a valid header, none of which may
+// panic or be taken for a keyring.
+func TestOpenShort(t *testing.T) {
+	full := append(append(magic[:], version, scryptLogN, scryptR, scryptP), make([]byte, saltSize+16+32)...)
+
+	for n := 0; n < len(full); n++ {
+		_, err := Open(writeFile(t, full[:n]), []byte("passphrase"))
+		if err == nil {
+			t.Fatalf("%d bytes: opened", n)
+		}
+		want := "truncated keyring"
+		if n < len(magic) {
+			want = "not a StarGate keyring"
+		}
+		if err.Error() != want {
+			t.Errorf("%d bytes: got %q, want %q", n, err, want)
+		}
+	}
+}
+
+func TestOpenGarbage(t *testing.T) {
+	garbage := make([]byte, 4096)
+	rand.Read(garbage)
+
+	cases := map[string][]byte{
+		"random":      garbage,
+		"text":        []byte(strings.Repeat("not a keyring\n", 20)),
+		"other magic": append([]byte("STGT"), garbage[:100]...),
+		"version 0":   append(append(magic[:], 0), garbage[:100]...),
+		"version 9":   append(append(magic[:], 9), garbage[:100]...),
+		"bad scrypt":  append(append(magic[:], version, 99, scryptR, scryptP), garbage[:100]...),
+		"random body": append(append(magic[:], version, scryptLogN, scryptR, scryptP), garbage[:100]...),
+	}
+	for name, data := range cases {
+		if _, err := Open(writeFile(t, data), []byte("passphrase")); err == nil {
+			t.Errorf("%s: opened", name)
+		}
+	}
+}
+
+// TestRoundTrip saves a keyring, reopens it and finds its keys by name and
+// by key ID.
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "keyring")
+	pass := []byte("correct horse")
+
+	kr, err := Open(path, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]*sg.Key{"b": sg.KeyFromString("key b"), "a": sg.KeyFromString("key a")}
+	for name, key := range keys {
+		if err := kr.Add(name, key, "note "+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kr.Add("a", keys["b"], ""); !errors.Is(err, ErrExists) {
+		t.Errorf("duplicate name: got %v, want %v", err, ErrExists)
+	}
+	if err := kr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	kr.Close()
+
+	kr, err = Open(path, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kr.Close()
+
+	entries := kr.Entries()
+	if len(entries) != 2 || entries[0].Name != "a" || entries[1].Name != "b" || entries[0].Note != "note a" {
+		t.Fatalf("entries %+v", entries)
+	}
+	if entries[0].Key != nil || entries[1].Key != nil {
+		t.Error("Entries returned key material")
+	}
+	for name, want := range keys {
+		got, err := kr.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("key %q differs", name)
+		}
+		found, byID, err := kr.FindByID(want.ID())
+		if err != nil || found != name || !bytes.Equal(byID.Bytes(), want.Bytes()) {
+			t.Errorf("key ID of %q: found %q, %v", name, found, err)
+		}
+	}
+
+	if _, err := kr.Get("c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing name: got %v, want %v", err, ErrNotFound)
+	}
+	if err := kr.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removed key: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+// TestTampered checks that a wrong passphrase and every changed byte of a
+// saved keyring are refused.
+func TestTampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring")
+	kr, err := Open(path, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr.Add("k", sg.KeyFromString("key"), "")
+	if err := kr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	kr.Close()
+
+	if _, err := Open(path, []byte("Passphrase")); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong passphrase: got %v, want %v", err, ErrBadPassphrase)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Past the scrypt parameters, which are refused before any key is
+	// derived, every byte is covered by the HMAC.
+	for _, i := range []int{8, headerSize - 1, headerSize, len(data) / 2, len(data) - 1} {
+		changed := bytes.Clone(data)
+		changed[i] ^= 1
+		if _, err := Open(writeFile(t, changed), []byte("passphrase")); !errors.Is(err, ErrBadPassphrase) {
+			t.Errorf("byte %d changed: got %v, want %v", i, err, ErrBadPassphrase)
+		}
+	}
+}
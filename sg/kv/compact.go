@@ -0,0 +1,114 @@
+package kv
+
+import (
+	"os"
+	"stargate/sg"
+)
+
+// Compact rewrites the file with only the live records. The new file
+// replaces the old one atomically, so a crash during compaction leaves the
+// old file as it was.
+func (s *Store) Compact() error {
+	return s.compact(nil)
+}
+
+// Rekey compacts the store into a file under newKey, in the default mix.
+// The store keeps working with newKey afterwards; the old key no longer
+// opens the file.
+func (s *Store) Rekey(newKey *sg.Key) error {
+	return s.compact(newKey)
+}
+
+func (s *Store) compact(newKey *sg.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	// The header nonce only salts the key commitment, records have nonces
+	// of their own, so without a new key the header is kept as it is, and
+	// with it the mix.
+	keys, raw := s.keys, s.header
+	if newKey != nil {
+		var err error
+		if raw, err = newHeader(newKey); err != nil {
+			return err
+		}
+		if keys, err = newKeys(newKey, sg.MixStarGate); err != nil {
+			return err
+		}
+	}
+
+	out, err := sg.CreateAtomic(s.path, 0o600)
+	if err != nil {
+		return s.abandon(keys, err)
+	}
+	defer out.Abort()
+
+	if _, err := out.Write(raw); err != nil {
+		return s.abandon(keys, err)
+	}
+
+	// Reseal every live record in file order into the new chain.
+	index := make(map[blindKey]entry, len(s.index))
+	off, last := int64(len(raw)), headerChain(raw)
+	for _, e := range s.entries() {
+		rec, err := s.read(e)
+		if err != nil {
+			return s.abandon(keys, err)
+		}
+
+		b := rec.blind
+		if newKey != nil {
+			b = keys.blindKey(rec.key)
+		}
+		sealed, err := keys.seal(opPut, &b, rec.key, rec.value, &last)
+		clear(rec.key)
+		clear(rec.value)
+		if err != nil {
+			return s.abandon(keys, err)
+		}
+		if _, err := out.Write(sealed); err != nil {
+			return s.abandon(keys, err)
+		}
+
+		index[b] = entry{off: off, size: int64(len(sealed))}
+		copy(last[:], sealed[len(sealed)-chainSize:])
+		off += int64(len(sealed))
+	}
+
+	if err := out.Commit(); err != nil {
+		return s.abandon(keys, err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		// The new file is in place but cannot be used from here. Close the
+		// store rather than keep writing to the replaced one.
+		s.f.Close()
+		s.f = nil
+		s.abandon(keys, nil)
+		s.keys.close()
+		return err
+	}
+
+	s.f.Close()
+	if keys != s.keys {
+		s.keys.close()
+	}
+	s.f, s.keys, s.index = f, keys, index
+	s.header, s.start, s.first = raw, int64(len(raw)), headerChain(raw)
+	s.end, s.last, s.records = off, last, len(index)
+	return nil
+}
+
+// abandon closes keys made for a compaction that did not complete and
+// returns err.
+func (s *Store) abandon(keys *keys, err error) error {
+	if keys != s.keys {
+		keys.close()
+	}
+	return err
+}
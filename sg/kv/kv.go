@@ -0,0 +1,353 @@
+// Package kv is an embedded key-value store in a single encrypted file, for
+// the small devices StarGate is meant for.
+//
+// The file is a StarGate container header followed by a log of records,
+// one per Put or Delete. Every record is sealed with StarGate AEAD under a
+// random nonce, and records are chained: each one's tag covers the tag of
+// the record before, so a record that is changed, removed or reordered
+// makes Open fail. Keys are blinded with the StarGate MAC as a PRF; only
+// the blinded key is stored in clear, and the in-memory index maps
+// blinded keys to file offsets without holding keys or values.
+//
+// Opening a store replays the log to rebuild the index. A record cut short
+// by a crash is the end of the log and is dropped; any other bad record
+// makes Open fail. Records that were overwritten or deleted stay in the
+// file until Compact rewrites it with the live records only.
+//
+// What is not hidden: the number and sizes of records, and which records
+// belong to the same key, as its blinded key repeats. As with sg.LogWriter,
+// cutting whole records off the end of the file leaves a valid, older
+// store.
+package kv
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"stargate/sg"
+	"sync"
+)
+
+const (
+	MaxKeySize   = 1 << 16
+	MaxValueSize = 1 << 24
+)
+
+var (
+	ErrNotFound = errors.New("kv: key not found")
+	ErrCorrupt  = errors.New("kv: record failed authentication: the file was changed")
+	ErrClosed   = errors.New("kv: store is closed")
+)
+
+type entry struct {
+	off  int64
+	size int64
+}
+
+// Store is an open key-value store. It is safe for concurrent use.
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	f     *os.File
+	keys  *keys
+	index map[blindKey]entry
+
+	header  []byte
+	start   int64 // offset of the first record
+	first   chain // chain value of the first record, from the header
+	end     int64 // offset after the last record
+	last    chain
+	records int
+}
+
+// Stats describes the file of a store.
+type Stats struct {
+	Keys    int   // live keys
+	Records int   // records in the file, live or not
+	Size    int64 // file size in bytes
+	Live    int64 // bytes of live records, what Compact would keep
+}
+
+// Open opens the store at path, creating it if it does not exist.
+func Open(path string, key *sg.Key) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := open(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.path = path
+	return s, nil
+}
+
+func open(f *os.File, key *sg.Key) (*Store, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		raw, err := newHeader(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(raw); err != nil {
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	h, err := sg.ReadHeader(io.TeeReader(f, &raw))
+	if err != nil {
+		return nil, err
+	}
+	if h.Kind != sg.KindKV {
+		return nil, errors.New("container is not a key-value store")
+	}
+	if err := h.CheckKey(key); err != nil {
+		return nil, err
+	}
+
+	k, err := newKeys(key, h.Mix)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		f:      f,
+		keys:   k,
+		index:  make(map[blindKey]entry),
+		header: raw.Bytes(),
+		start:  int64(raw.Len()),
+		first:  headerChain(raw.Bytes()),
+	}
+
+	s.end, s.last, err = k.replay(f, s.start, s.first, s.apply)
+	if err != nil {
+		k.close()
+		return nil, err
+	}
+
+	// Drop a torn last record and append after the whole ones.
+	if err := f.Truncate(s.end); err != nil {
+		k.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// newHeader returns a header for a new store file under key.
+func newHeader(key *sg.Key) ([]byte, error) {
+	nonce, err := sg.GenNonce()
+	if err != nil {
+		return nil, err
+	}
+	id := key.ID()
+	c := sg.KeyCommitment(key, nonce)
+	h := &sg.Header{Kind: sg.KindKV, Nonce: nonce, KeyID: &id, Commitment: &c}
+	return h.MarshalBinary()
+}
+
+// apply updates the index with the record at off.
+func (s *Store) apply(off int64, rec *record) {
+	s.records++
+	switch rec.op {
+	case opPut:
+		s.index[rec.blind] = entry{off: off, size: rec.size}
+	case opDelete:
+		delete(s.index, rec.blind)
+	}
+	clear(rec.key)
+	clear(rec.value)
+}
+
+// Get returns the value of key, or ErrNotFound.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.f == nil {
+		return nil, ErrClosed
+	}
+
+	b := s.keys.blindKey(key)
+	e, ok := s.index[b]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	rec, err := s.read(e)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(rec.key, key) {
+		return nil, ErrCorrupt
+	}
+	return rec.value, nil
+}
+
+// read reads and opens the record at e. The record before it, or the
+// header, holds the chain value it was sealed with.
+func (s *Store) read(e entry) (*record, error) {
+	prev := s.first
+	if e.off > s.start {
+		if _, err := s.f.ReadAt(prev[:], e.off-chainSize); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, e.size)
+	if _, err := s.f.ReadAt(buf, e.off); err != nil {
+		return nil, err
+	}
+	rec, err := s.keys.open(buf, &prev)
+	if err != nil {
+		return nil, fmt.Errorf("record at offset %d: %w", e.off, err)
+	}
+	return rec, nil
+}
+
+// Put sets key to value. Like Delete, it returns once the record is
+// written to the file; Sync makes it durable.
+func (s *Store) Put(key, value []byte) error {
+	if len(value) > MaxValueSize {
+		return fmt.Errorf("kv: value of %d bytes exceeds MaxValueSize", len(value))
+	}
+	return s.write(opPut, key, value)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *Store) Delete(key []byte) error {
+	return s.write(opDelete, key, nil)
+}
+
+func (s *Store) write(op byte, key, value []byte) error {
+	if len(key) > MaxKeySize {
+		return fmt.Errorf("kv: key of %d bytes exceeds MaxKeySize", len(key))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	b := s.keys.blindKey(key)
+	if _, ok := s.index[b]; !ok && op == opDelete {
+		return nil
+	}
+
+	rec, err := s.keys.seal(op, &b, key, value, &s.last)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(rec, s.end); err != nil {
+		// Whatever part of the record made it to the file is cut off on
+		// the next write or Open.
+		s.f.Truncate(s.end)
+		return err
+	}
+
+	if op == opPut {
+		s.index[b] = entry{off: s.end, size: int64(len(rec))}
+	} else {
+		delete(s.index, b)
+	}
+	copy(s.last[:], rec[len(rec)-chainSize:])
+	s.end += int64(len(rec))
+	s.records++
+	return nil
+}
+
+// Iterate calls fn for every key and value, in the order they were last
+// written, and stops at the first error fn returns. fn must not modify
+// the store.
+func (s *Store) Iterate(fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	for _, e := range s.entries() {
+		rec, err := s.read(e)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec.key, rec.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries returns the live entries in file order.
+func (s *Store) entries() []entry {
+	es := make([]entry, 0, len(s.index))
+	for _, e := range s.index {
+		es = append(es, e)
+	}
+	slices.SortFunc(es, func(a, b entry) int { return cmp.Compare(a.off, b.off) })
+	return es
+}
+
+// Len returns the number of keys.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := Stats{Keys: len(s.index), Records: s.records, Size: s.end, Live: s.start}
+	for _, e := range s.index {
+		st.Live += e.size
+	}
+	return st
+}
+
+// Sync flushes the records written so far to disk.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+	return s.f.Sync()
+}
+
+// Close syncs and closes the file and wipes the keys.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	s.keys.close()
+	return err
+}
@@ -0,0 +1,251 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"stargate/sg"
+	"testing"
+)
+
+// knownBlinds are the blinded keys of "alice" under knownKey in each mix.
+// Record nonces are random, so they are what pins the key derivation.
+var knownBlinds = []struct {
+	mix   sg.Mix
+	blind string
+}{
+	{sg.MixStarGate, "417d253f39d34ade09a16be1ee0bdde50d267de266ba094f2cc9faeac58c899d"},
+	{sg.MixXXH3, "770b0c5436b1fa46334f1bfccd5203e6c01c8d0ed4c839b145d9e7d3baee98d7"},
+}
+
+func knownKey() *sg.Key {
+	b := make([]byte, 64)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return sg.NewKey(b)
+}
+
+func TestKnownBlinds(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+
+	for _, ka := range knownBlinds {
+		k, err := newKeys(key, ka.mix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := k.blindKey([]byte("alice"))
+		k.close()
+		if got := hex.EncodeToString(b[:]); got != ka.blind {
+			t.Errorf("blinded key in mix %s: got %s, want %s", ka.mix, got, ka.blind)
+		}
+	}
+}
+
+// testStore writes a store with puts and deletes and returns its path and
+// the contents it should have.
+func testStore(t *testing.T, key *sg.Key) (string, map[string]string) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+
+	want := map[string]string{}
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := range 20 {
+		k, v := fmt.Sprintf("key-%d", i%8), fmt.Sprintf("value-%d", i)
+		if err := s.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		want[k] = v
+	}
+	for _, k := range []string{"key-3", "key-5", "missing"} {
+		if err := s.Delete([]byte(k)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, k)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, want
+}
+
+func TestReopen(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+
+	path, want := testStore(t, key)
+	checkStore(t, path, key, want)
+}
+
+// TestTornRecord checks that a torn last record is dropped with the write
+// it belonged to.
+func TestTornRecord(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+
+	path, _ := testStore(t, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-3], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// The last record deleted key-5, which is back now.
+	if s.Stats().Records != 21 {
+		t.Errorf("%d records left, want 21", s.Stats().Records)
+	}
+	if _, err := s.Get([]byte("key-5")); err != nil {
+		t.Errorf("key-5: %v", err)
+	}
+}
+
+// TestCorrupt checks that a changed or removed record is refused and the
+// file left as it is.
+func TestCorrupt(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+
+	path, _ := testStore(t, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.start
+	s.Close()
+	size, _ := recordSize(data[first:])
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"changed record", flip(data, int(first)+recordHead+2)},
+		{"removed record", append(bytes.Clone(data[:first]), data[first+size:]...)},
+		// Runs past the end of the file like a torn record would.
+		{"changed length", flip(data, int(first)+1)},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(path, c.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := Open(path, key); !errors.Is(err, ErrCorrupt) {
+			if err == nil {
+				s.Close()
+			}
+			t.Errorf("%s: got %v, want %v", c.name, err, ErrCorrupt)
+		}
+		if after, err := os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(after, c.data) {
+			t.Errorf("%s: file changed from %d to %d bytes", c.name, len(c.data), len(after))
+		}
+	}
+}
+
+// TestCompactRekey checks that compaction keeps the live records only,
+// and that rekeying moves them to another key.
+func TestCompactRekey(t *testing.T) {
+	key := knownKey()
+	defer key.Destroy()
+
+	path, want := testStore(t, key)
+
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if st := s.Stats(); st.Records != len(want) || st.Size != st.Live {
+		t.Fatalf("compact: %+v left for %d keys", st, len(want))
+	}
+	if err := s.Put([]byte("after"), []byte("compaction")); err != nil {
+		t.Fatal(err)
+	}
+	want["after"] = "compaction"
+
+	newKey := sg.KeyFromString("another key")
+	defer newKey.Destroy()
+	if err := s.Rekey(newKey); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := Open(path, key); !errors.Is(err, sg.ErrWrongKey) {
+		if err == nil {
+			s.Close()
+		}
+		t.Errorf("old key after rekey: got %v, want %v", err, sg.ErrWrongKey)
+	}
+	checkStore(t, path, newKey, want)
+}
+
+// checkStore opens the store at path and checks that it holds want.
+func checkStore(t *testing.T, path string, key *sg.Key, want map[string]string) {
+	t.Helper()
+	s, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Len() != len(want) {
+		t.Errorf("%d keys, want %d", s.Len(), len(want))
+	}
+	for k, v := range want {
+		got, err := s.Get([]byte(k))
+		if err != nil {
+			t.Errorf("get %s: %v", k, err)
+		} else if string(got) != v {
+			t.Errorf("get %s: got %q, want %q", k, got, v)
+		}
+	}
+	if _, err := s.Get([]byte("key-3")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key: got %v, want %v", err, ErrNotFound)
+	}
+
+	seen := 0
+	err = s.Iterate(func(k, v []byte) error {
+		if want[string(k)] != string(v) {
+			return fmt.Errorf("iterate: %s = %q", k, v)
+		}
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	} else if seen != len(want) {
+		t.Errorf("iterate: %d keys, want %d", seen, len(want))
+	}
+}
+
+func flip(data []byte, i int) []byte {
+	data = bytes.Clone(data)
+	data[i] ^= 1
+	return data
+}
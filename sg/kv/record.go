@@ -0,0 +1,226 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"stargate/sg"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Record layout:
+//
+//	length(4) | check(4) | blinded key(32) | nonce(16) | ciphertext(length) | tag(32)
+//
+// check is the CRC-32C of length. It tells a length that was changed,
+// which is refused, from a record cut short by a crash, which is dropped:
+// without it both run past the end of the file alike.
+//
+// The plaintext is op(1) | key length(4) | key | value, sealed with AEAD
+// under a random nonce. The associated data is the blinded key and the tag
+// of the record before, or for the first record the SHA-256 of the header,
+// so records are chained like those of sg.LogWriter.
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+const (
+	blindSize  = sg.MACSize
+	chainSize  = sg.AEADOverhead
+	lengthSize = 8
+	recordHead = lengthSize + blindSize + sg.NonceSize
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type blindKey [blindSize]byte
+
+type chain [chainSize]byte
+
+// keys holds the subkeys of a store.
+type keys struct {
+	aead *sg.AEAD
+
+	mu    sync.Mutex
+	blind *sg.MAC
+}
+
+// newKeys derives the subkeys of key, with the mix recorded in the store
+// header.
+func newKeys(key *sg.Key, mix sg.Mix) (*keys, error) {
+	aeadKey := subkey(key, "StarGate kv encryption")
+	defer aeadKey.Destroy()
+	blindKey := subkey(key, "StarGate kv blinding")
+	defer blindKey.Destroy()
+
+	aead, err := sg.NewAEAD(aeadKey, sg.WithMix(mix))
+	if err != nil {
+		return nil, err
+	}
+	blind, err := sg.NewMAC(blindKey, sg.WithMix(mix))
+	if err != nil {
+		aead.Close()
+		return nil, err
+	}
+	return &keys{aead: aead, blind: blind}, nil
+}
+
+func subkey(key *sg.Key, info string) *sg.Key {
+	var b [64]byte
+	io.ReadFull(hkdf.New(sha512.New, key.Bytes(), nil, []byte(info)), b[:])
+	k := sg.NewKey(b[:])
+	clear(b[:])
+	return k
+}
+
+func (k *keys) close() {
+	k.aead.Close()
+	k.blind.Close()
+}
+
+// blindKey is the StarGate MAC of key under the blinding subkey. It stands
+// for the key in the index and in the file.
+func (k *keys) blindKey(key []byte) blindKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.blind.Reset()
+	k.blind.Write(key)
+
+	var b blindKey
+	copy(b[:], k.blind.Sum(nil))
+	return b
+}
+
+func recordAD(b *blindKey, prev *chain) []byte {
+	ad := make([]byte, 0, blindSize+chainSize)
+	ad = append(ad, b[:]...)
+	return append(ad, prev[:]...)
+}
+
+// seal builds the record of op on key and value, following prev.
+func (k *keys) seal(op byte, b *blindKey, key, value []byte, prev *chain) ([]byte, error) {
+	nonce, err := sg.GenNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, 0, 5+len(key)+len(value))
+	plain = append(plain, op)
+	plain = binary.BigEndian.AppendUint32(plain, uint32(len(key)))
+	plain = append(plain, key...)
+	plain = append(plain, value...)
+	defer clear(plain)
+
+	rec := make([]byte, 0, recordHead+len(plain)+sg.AEADOverhead)
+	rec = binary.BigEndian.AppendUint32(rec, uint32(len(plain)))
+	rec = binary.BigEndian.AppendUint32(rec, crc32.Checksum(rec[:4], crcTable))
+	rec = append(rec, b[:]...)
+	rec = append(rec, nonce[:]...)
+	return k.aead.Seal(rec, nonce[:], plain, recordAD(b, prev)), nil
+}
+
+// record is an opened record.
+type record struct {
+	op         byte
+	blind      blindKey
+	key, value []byte
+	tag        chain
+	size       int64
+}
+
+// open checks and decrypts a whole record read from the file.
+func (k *keys) open(rec []byte, prev *chain) (*record, error) {
+	r := &record{size: int64(len(rec))}
+	copy(r.blind[:], rec[lengthSize:])
+	nonce := rec[lengthSize+blindSize : recordHead]
+	copy(r.tag[:], rec[len(rec)-chainSize:])
+
+	plain, err := k.aead.Open(nil, nonce, rec[recordHead:], recordAD(&r.blind, prev))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if len(plain) < 5 {
+		return nil, ErrCorrupt
+	}
+	r.op = plain[0]
+	n := binary.BigEndian.Uint32(plain[1:])
+	if uint64(n) > uint64(len(plain)-5) || (r.op != opPut && r.op != opDelete) {
+		return nil, ErrCorrupt
+	}
+	r.key, r.value = plain[5:5+n], plain[5+n:]
+
+	// A record must sit under the blinded key of the key it holds.
+	if k.blindKey(r.key) != r.blind {
+		return nil, ErrCorrupt
+	}
+	return r, nil
+}
+
+// recordSize returns the size of the record whose first lengthSize bytes
+// are head.
+func recordSize(head []byte) (int64, error) {
+	n := binary.BigEndian.Uint32(head)
+	if crc32.Checksum(head[:4], crcTable) != binary.BigEndian.Uint32(head[4:]) {
+		return 0, fmt.Errorf("%w: record length checksum", ErrCorrupt)
+	}
+	if n > 5+MaxKeySize+MaxValueSize {
+		return 0, fmt.Errorf("%w: record length %d", ErrCorrupt, n)
+	}
+	return recordHead + int64(n) + sg.AEADOverhead, nil
+}
+
+// replay reads the records following the header from r and calls fn for
+// each with its offset. It returns the offset after the last whole record,
+// where a record cut short by a crash starts, and the chain value there.
+// Only a record whose length checks out and that runs past the end of the
+// file counts as cut short; any other bad record is ErrCorrupt.
+func (k *keys) replay(r io.Reader, off int64, prev chain, fn func(off int64, rec *record)) (int64, chain, error) {
+	br := bufio.NewReader(r)
+	buf := new(bytes.Buffer)
+
+	for {
+		head, err := br.Peek(lengthSize)
+		if len(head) < lengthSize {
+			if err == io.EOF {
+				return off, prev, nil
+			}
+			return off, prev, err
+		}
+
+		size, err := recordSize(head)
+		if err != nil {
+			return off, prev, fmt.Errorf("record at offset %d: %w", off, err)
+		}
+
+		buf.Reset()
+		if _, err := io.CopyN(buf, br, size); err != nil {
+			if errors.Is(err, io.EOF) {
+				return off, prev, nil
+			}
+			return off, prev, err
+		}
+
+		rec, err := k.open(buf.Bytes(), &prev)
+		if err != nil {
+			return off, prev, fmt.Errorf("record at offset %d: %w", off, err)
+		}
+		fn(off, rec)
+		prev = rec.tag
+		off += size
+	}
+}
+
+func headerChain(raw []byte) chain {
+	return sha256.Sum256(raw)
+}
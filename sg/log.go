@@ -0,0 +1,354 @@
+package sg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Encrypted log layout:
+//
+//	container header, Kind KindLog, with key ID and commitment
+//	records: length(4) | check(4) | ciphertext(length) | tag(32)
+//
+// check is the CRC-32C of length, so a changed length is told from a
+// record cut short by a crash, which it would otherwise look like when it
+// runs past the end of the file.
+//
+// Record i is sealed with AEAD under the log key and the nonce
+// header nonce + i, so every record has its own Waver and appending never
+// touches earlier records. The associated data is
+//
+//	i(8) | length(4) | chain
+//
+// where chain is the tag of record i-1, and for record 0 the SHA-256 of
+// the header. Every tag thus depends on all records before it: a record
+// that is changed, removed, inserted or moved fails authentication. Only
+// cutting records off the end goes unnoticed, as the shorter log is still
+// a valid one; compare LogReader.Head with a value kept elsewhere to catch
+// that.
+
+// MaxLogRecord is the largest record a log holds.
+const MaxLogRecord = 1 << 24
+
+var ErrLogCorrupt = errors.New("log record failed authentication: records were changed, removed or reordered")
+
+// logHead is the size of the length and its check.
+const logHead = 8
+
+var logCRC = crc32.MakeTable(crc32.Castagnoli)
+
+type logChain [AEADOverhead]byte
+
+func logAD(index uint64, size int, chain *logChain) []byte {
+	ad := make([]byte, 0, 12+len(chain))
+	ad = binary.BigEndian.AppendUint64(ad, index)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(size))
+	return append(ad, chain[:]...)
+}
+
+// LogWriter appends encrypted records to a log file. Each Write is one
+// record. It is safe for concurrent use.
+type LogWriter struct {
+	mu    sync.Mutex
+	f     *os.File
+	aead  *AEAD
+	nonce Nonce
+	index uint64
+	chain logChain
+	buf   []byte
+}
+
+// OpenLogWriter opens the log at path for appending, creating it with a
+// random nonce if it does not exist. An existing log is verified to its
+// end first. A last record cut short by a crash is dropped; any other bad
+// record is an error and leaves the file as it is.
+func OpenLogWriter(path string, key *Key) (*LogWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := openLogWriter(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+func openLogWriter(f *os.File, key *Key) (*LogWriter, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		nonce, err := GenNonce()
+		if err != nil {
+			return nil, err
+		}
+
+		h := &Header{Kind: KindLog, Nonce: nonce}
+		h.commit(key)
+		raw, err := h.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(raw); err != nil {
+			return nil, err
+		}
+
+		aead, err := NewAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		return &LogWriter{f: f, aead: aead, nonce: nonce, chain: sha256.Sum256(raw)}, nil
+	}
+
+	r, err := NewLogReader(f, key)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		_, err := r.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	// Drop a torn last record, then append after the verified ones.
+	if err := f.Truncate(r.offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return &LogWriter{f: f, aead: r.aead, nonce: r.nonce, index: r.index, chain: r.chain}, nil
+}
+
+// Write appends p as one record.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	if len(p) > MaxLogRecord {
+		return 0, fmt.Errorf("log record of %d bytes exceeds MaxLogRecord", len(p))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	rec := binary.BigEndian.AppendUint32(w.buf[:0], uint32(len(p)))
+	rec = binary.BigEndian.AppendUint32(rec, crc32.Checksum(rec, logCRC))
+	rec = w.aead.Seal(rec, w.logNonce(), p, logAD(w.index, len(p), &w.chain))
+	w.buf = rec
+
+	if _, err := w.f.Write(rec); err != nil {
+		return 0, err
+	}
+
+	copy(w.chain[:], rec[len(rec)-AEADOverhead:])
+	w.index++
+	return len(p), nil
+}
+
+func (w *LogWriter) logNonce() []byte {
+	n := w.nonce.Add(w.index)
+	return n[:]
+}
+
+// Sync flushes the records written so far to disk.
+func (w *LogWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	return w.f.Sync()
+}
+
+// Len returns the number of records in the log.
+func (w *LogWriter) Len() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.index
+}
+
+// Close syncs and closes the file and wipes the keys.
+func (w *LogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	w.aead.Close()
+	return err
+}
+
+// LogReader reads and verifies the records of a log.
+type LogReader struct {
+	r      io.Reader
+	aead   *AEAD
+	nonce  Nonce
+	index  uint64
+	chain  logChain
+	buf    []byte
+	offset int64
+}
+
+// NewLogReader reads the log header from r and picks among keys by its key
+// ID.
+func NewLogReader(r io.Reader, keys ...*Key) (*LogReader, error) {
+	var raw bytes.Buffer
+	h, err := ReadHeader(io.TeeReader(r, &raw))
+	if err != nil {
+		return nil, err
+	}
+	if h.Kind != KindLog {
+		return nil, errors.New("container is not an encrypted log")
+	}
+
+	key, err := h.SelectKey(keys)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := NewAEAD(key, WithMix(h.Mix))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogReader{
+		r:      r,
+		aead:   aead,
+		nonce:  h.Nonce,
+		chain:  sha256.Sum256(raw.Bytes()),
+		offset: int64(raw.Len()),
+	}, nil
+}
+
+// fill reads until the buffer holds n bytes. If the input ends first it
+// returns io.EOF and keeps what it read, so a later call continues once
+// more has been written.
+func (r *LogReader) fill(n int) error {
+	if cap(r.buf) < n {
+		r.buf = append(make([]byte, 0, n), r.buf...)
+	}
+	for len(r.buf) < n {
+		m, err := r.r.Read(r.buf[len(r.buf):n])
+		r.buf = r.buf[:len(r.buf)+m]
+		if err != nil && len(r.buf) < n {
+			return err
+		}
+		if m == 0 && err == nil {
+			return io.EOF
+		}
+	}
+	return nil
+}
+
+// Next returns the next record. At the end of the log it returns io.EOF,
+// or io.ErrUnexpectedEOF if the log ends inside a record whose length
+// checks out, which is what a crash during a write leaves behind. Any
+// record that fails authentication yields ErrLogCorrupt, and so does every
+// later call.
+func (r *LogReader) Next() ([]byte, error) {
+	if err := r.fill(logHead); err != nil {
+		if err == io.EOF && len(r.buf) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	size := int(binary.BigEndian.Uint32(r.buf))
+	if crc32.Checksum(r.buf[:4], logCRC) != binary.BigEndian.Uint32(r.buf[4:]) {
+		return nil, fmt.Errorf("%w: record %d has a changed length", ErrLogCorrupt, r.index)
+	}
+	if size > MaxLogRecord {
+		return nil, fmt.Errorf("%w: record %d has length %d", ErrLogCorrupt, r.index, size)
+	}
+
+	total := logHead + size + AEADOverhead
+	if err := r.fill(total); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	n := r.nonce.Add(r.index)
+	sealed := r.buf[logHead:total]
+	rec, err := r.aead.Open(nil, n[:], sealed, logAD(r.index, size, &r.chain))
+	if err != nil {
+		return nil, fmt.Errorf("%w: record %d", ErrLogCorrupt, r.index)
+	}
+
+	copy(r.chain[:], sealed[size:])
+	r.index++
+	r.offset += int64(total)
+	r.buf = r.buf[:0]
+	return rec, nil
+}
+
+// Len returns the number of records verified so far.
+func (r *LogReader) Len() uint64 {
+	return r.index
+}
+
+// Head returns the chain value after the last verified record. It names
+// the log up to that record, so keeping it elsewhere lets a later reader
+// detect records cut off the end.
+func (r *LogReader) Head() []byte {
+	return bytes.Clone(r.chain[:])
+}
+
+// Follow calls fn for every record, and at the end of the log polls for
+// new ones every interval until ctx is done, like tail -f.
+func (r *LogReader) Follow(ctx context.Context, interval time.Duration, fn func(rec []byte) error) error {
+	for {
+		rec, err := r.Next()
+		switch {
+		case err == nil:
+			if err := fn(rec); err != nil {
+				return err
+			}
+			continue
+		case err != io.EOF && err != io.ErrUnexpectedEOF:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Close wipes the keys.
+func (r *LogReader) Close() {
+	r.aead.Close()
+}
@@ -0,0 +1,160 @@
+package sg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLog(data []byte, key *Key) ([][]byte, error) {
+	r, err := NewLogReader(bytes.NewReader(data), key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var recs [][]byte
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
+
+// writeLog appends records to the log at path, creating it if needed, and
+// returns the file.
+func writeLog(t *testing.T, path string, key *Key, records ...[]byte) []byte {
+	t.Helper()
+	w, err := OpenLogWriter(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if _, err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestLogChangedLength changes the length of the first record so that it
+// runs past the end of the file, as a torn record would. Opening the log
+// for writing must fail and leave the later records in place.
+func TestLogChangedLength(t *testing.T) {
+	key := KeyFromString("StarGate log check key")
+	defer key.Destroy()
+
+	path := filepath.Join(t.TempDir(), "changed.log")
+	data := writeLog(t, path, key, []byte("first"), []byte("second"), []byte("third"))
+
+	h, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := h.MarshalBinary()
+
+	changed := bytes.Clone(data)
+	changed[len(raw)+1] ^= 1
+	if err := os.WriteFile(path, changed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, err := OpenLogWriter(path, key); !errors.Is(err, ErrLogCorrupt) {
+		if err == nil {
+			w.Close()
+		}
+		t.Errorf("got %v, want %v", err, ErrLogCorrupt)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, changed) {
+		t.Errorf("log changed from %d to %d bytes", len(changed), len(after))
+	}
+}
+
+// TestLog writes a log, reopens it to append, and reads it back. A flipped
+// bit, a removed record and two swapped records must be ErrLogCorrupt, and
+// a torn last record must be dropped when the log is opened for writing
+// again.
+func TestLog(t *testing.T) {
+	key := KeyFromString("StarGate log check key")
+	defer key.Destroy()
+
+	path := filepath.Join(t.TempDir(), "check.log")
+	records := [][]byte{[]byte("first"), {}, []byte("third record"), bytes.Repeat([]byte{7}, 1000)}
+	writeLog(t, path, key, records[:2]...)
+	data := writeLog(t, path, key, records[2:]...)
+
+	got, err := readLog(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("read %d records, wrote %d", len(got), len(records))
+	}
+	for i := range records {
+		if !bytes.Equal(got[i], records[i]) {
+			t.Errorf("record %d differs", i)
+		}
+	}
+
+	// Offsets of the records, to cut the file apart.
+	h, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := h.MarshalBinary()
+	offs := []int{len(raw)}
+	for _, rec := range records {
+		offs = append(offs, offs[len(offs)-1]+logHead+len(rec)+AEADOverhead)
+	}
+	part := func(i int) []byte { return data[offs[i]:offs[i+1]] }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	flipped := bytes.Clone(data)
+	flipped[offs[2]+logHead+2] ^= 1
+
+	cases := map[string][]byte{
+		"flipped bit":     flipped,
+		"removed record":  join(data[:offs[1]], part(2), part(3)),
+		"swapped records": join(data[:offs[0]], part(1), part(0), part(2), part(3)),
+	}
+	for name, c := range cases {
+		if _, err := readLog(c, key); !errors.Is(err, ErrLogCorrupt) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrLogCorrupt)
+		}
+	}
+
+	torn := data[:len(data)-10]
+	if _, err := readLog(torn, key); err != io.ErrUnexpectedEOF {
+		t.Errorf("torn record: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if err := os.WriteFile(path, torn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := OpenLogWriter(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Len() != uint64(len(records)-1) {
+		t.Errorf("reopened torn log has %d records, want %d", w.Len(), len(records)-1)
+	}
+}
@@ -0,0 +1,135 @@
+package sg
+
+import "encoding/binary"
+
+// MACSize is the length of a full MAC tag.
+const MACSize = 32
+
+// macNonce separates the MAC from keystreams under the same key.
+var macNonce = Nonce{'S', 't', 'a', 'r', 'G', 'a', 't', 'e', ' ', 'M', 'A', 'C'}
+
+// MAC is a keyed MAC and PRF built from the Waver itself. It implements
+// hash.Hash.
+//
+// The key sets up a Waver as for encryption. Every 64-byte message block is
+// passed through the gates and XORed into rows 4-7 of the matrix, then the
+// state is stepped as for one keystream block. Passing bytes through the
+// gates also folds them into the gate state. The last block is padded with
+// 0x80 and zeros, the message length is XORed into row 8, and the tag is
+// squeezed from the keystream after two blank steps.
+//
+// This is an experimental construction without a security proof. Note that
+// each step rebuilds the matrix from a 64-bit hash of it, so most of the
+// state carried between blocks sits in the gates. Use "stargate mac
+// analyze" to check how truncated tags behave.
+type MAC struct {
+	w    Waver
+	init Waver
+	buf  [BlockSize]byte
+	n    int
+	len  uint64
+}
+
+// NewMAC returns a MAC under key. Of opts only WithMix applies.
+func NewMAC(key *Key, opts ...Option) (*MAC, error) {
+	w, err := newWaver(key, macNonce, false, options{mix: newOptions(opts).mix})
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	m := &MAC{init: *w}
+	m.init.LastPool = nil
+	m.Reset()
+	return m, nil
+}
+
+func (m *MAC) Write(p []byte) (int, error) {
+	n := len(p)
+	m.len += uint64(n)
+
+	for len(p) > 0 {
+		k := copy(m.buf[m.n:], p)
+		m.n += k
+		p = p[k:]
+
+		if m.n == BlockSize {
+			m.w.absorb(&m.buf)
+			m.n = 0
+		}
+	}
+
+	return n, nil
+}
+
+// Sum appends the tag of the data written so far to b. It does not change
+// the MAC state, so writing may continue afterwards.
+func (m *MAC) Sum(b []byte) []byte {
+	w := m.w
+
+	var last [BlockSize]byte
+	copy(last[:], m.buf[:m.n])
+	last[m.n] = 0x80
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], m.len)
+	for i := range length {
+		w.Matrix[8][i] ^= length[i]
+	}
+
+	w.absorb(&last)
+
+	var blank [BlockSize]byte
+	w.absorb(&blank)
+	w.absorb(&blank)
+
+	var tag [MACSize]byte
+	for i := range tag {
+		tag[i] = w.GetNext()
+	}
+	w.Close()
+	clear(last[:])
+
+	return append(b, tag[:]...)
+}
+
+// Reset restores the state right after keying.
+func (m *MAC) Reset() {
+	m.w = m.init
+	m.buf = [BlockSize]byte{}
+	m.n = 0
+	m.len = 0
+}
+
+func (m *MAC) Size() int {
+	return MACSize
+}
+
+func (m *MAC) BlockSize() int {
+	return BlockSize
+}
+
+// Close wipes the keyed state. The MAC must not be used afterwards.
+func (m *MAC) Close() {
+	m.w.Close()
+	m.init.Close()
+	clear(m.buf[:])
+}
+
+// absorb mixes one message block into the matrix through the gates and
+// steps the state once.
+func (w *Waver) absorb(block *[BlockSize]byte) {
+	for i, b := range block {
+		r := i / 16
+		gate := &w.Gates[(w.blockIndex+r)%len(w.Gates)]
+		w.Matrix[4+r][i%16] ^= gate.PassValue(b, w.OffsetSum+i)
+	}
+
+	w.blockPos = BlockSize
+	w.refillBlock()
+
+	for _, b := range w.currentBlock {
+		w.OffsetSum += int(b)
+	}
+	w.blockPos = BlockSize
+}
@@ -0,0 +1,49 @@
+package sg
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// macVectors are the MAC test vectors of docs/mac.md.
+var macVectors = []struct {
+	key     string
+	message string
+	mix     Mix
+	tag     string
+}{
+	{"StarGate MAC key 1", "", MixStarGate, "aea5cd0890bd0523b76da4d54cf5d81a7cd9da9da75f64d761a1793821f9bd6c"},
+	{"StarGate MAC key 1", "abc", MixStarGate, "4655bb812d2b11e86fccc8b54ed9917db95b2a2162e901062c3727944958393d"},
+	{"StarGate MAC key 1", strings.Repeat("StarGate MAC known answer. ", 10), MixStarGate, "03c64a88a1262f434ec3dd50fdbffdc175b580eada4d59c2ccf9445aa966fd9a"},
+	{"StarGate MAC key 2", "abc", MixStarGate, "c79698c89b7ee10190b015fe56830f3bbad20d3e9e6f8fe9905e0401f46a76f8"},
+	{"StarGate MAC key 1", "abc", MixXXH3, "d6cad2d7a821956b8bb3dffe66a094f0cf32fbdd1029d820ee5dc5bd20fdeee9"},
+	{"StarGate MAC key 1", strings.Repeat("StarGate MAC known answer. ", 10), MixXXH3, "0db25f2f363e5d73253cac192227c41b5683a7adb6ffc4c57b8d546d4b84f162"},
+}
+
+// TestMACVectors computes every tag both in one write and byte by byte.
+func TestMACVectors(t *testing.T) {
+	for _, tt := range macVectors {
+		key := KeyFromString(tt.key)
+		m, err := NewMAC(key, WithMix(tt.mix))
+		key.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m.Write([]byte(tt.message))
+		whole := hex.EncodeToString(m.Sum(nil))
+
+		m.Reset()
+		for i := range len(tt.message) {
+			m.Write([]byte{tt.message[i]})
+		}
+		split := hex.EncodeToString(m.Sum(nil))
+		m.Close()
+
+		if whole != tt.tag || split != tt.tag {
+			t.Errorf("key %q message of %d bytes mix %s: got %s and %s byte by byte, want %s",
+				tt.key, len(tt.message), tt.mix, whole, split, tt.tag)
+		}
+	}
+}
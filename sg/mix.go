@@ -0,0 +1,39 @@
+package sg
+
+import (
+	"fmt"
+	"stargate/sg/core"
+)
+
+// Mix selects how the Waver rebuilds its matrix after every block. The
+// functions are specified in docs/mix.md and implemented in sg/core.
+type Mix = core.Mix
+
+const (
+	// MixStarGate is the default mix, on SplitMix64.
+	MixStarGate = core.MixStarGate
+	// MixXXH3 hashes with XXH3-64 as releases before the mix was
+	// specified did. Containers without a mix in their header use it.
+	MixXXH3 = core.MixXXH3
+)
+
+// WithMix selects the reinit mix of a Waver, Cipher, MAC, AEAD or DRBG.
+// Only MixXXH3 needs it: together with WithLegacyNonceSchedule it
+// reproduces the keystream of releases before the mix was specified, which
+// neither does alone. Containers record their mix and are read with it
+// anyway.
+func WithMix(m Mix) Option {
+	return func(o *options) {
+		o.mix = m
+	}
+}
+
+// ParseMix parses "stargate" or "xxh3".
+func ParseMix(s string) (Mix, error) {
+	for _, m := range []Mix{MixStarGate, MixXXH3} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mix %q, want stargate or xxh3", s)
+}
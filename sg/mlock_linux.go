@@ -0,0 +1,37 @@
+package sg
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockedAlloc maps anonymous memory outside the Go heap and locks it, so the
+// garbage collector never copies it and the kernel never swaps it out.
+func lockedAlloc(n int) ([]byte, error) {
+	page := os.Getpagesize()
+	size := max((n+page-1)/page*page, page)
+
+	b, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Mlock(b); err != nil {
+		unix.Munmap(b)
+		return nil, err
+	}
+
+	// Keep locked pages out of core dumps as well.
+	_ = unix.Madvise(b, unix.MADV_DONTDUMP)
+
+	// The capacity keeps covering the whole mapping, lockedFree needs it.
+	return b[:n], nil
+}
+
+func lockedFree(b []byte) {
+	b = b[:cap(b)]
+	wipe(b)
+	unix.Munlock(b)
+	unix.Munmap(b)
+}
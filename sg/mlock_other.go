@@ -0,0 +1,11 @@
+//go:build !linux
+
+package sg
+
+func lockedAlloc(n int) ([]byte, error) {
+	return nil, ErrMemoryLockUnsupported
+}
+
+func lockedFree(b []byte) {
+	wipe(b)
+}
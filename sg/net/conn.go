@@ -0,0 +1,614 @@
+// Package net secures point-to-point links with StarGate. It wraps a
+// net.Conn in two directional StarGate streams keyed from a pre-shared key
+// or from an X25519 handshake between static key pairs.
+//
+// Handshake, client first:
+//
+//	client → server  hello: "STGN" | version | client nonce(16)
+//	server → client  hello: "STGN" | version | server nonce(16), finished
+//	client → server  finished
+//
+// Each direction has a 64-byte secret, HKDF-SHA512 of the pre-shared key
+// salted with both nonces. The secret yields the direction's stream key,
+// stream nonce and MAC key. Finished is a record carrying the SHA-256 of
+// both hellos, so a wrong key or a tampered hello fails the handshake.
+//
+// With static keys the hellos carry version 2 and are followed by the
+// sg/noise XX handshake, with both hellos as its prologue. The secrets
+// then come from a secret exported by the handshake, together with the
+// pre-shared key if there is one, and finished also covers the handshake
+// hash.
+//
+// Records:
+//
+//	type(1) | length(2) | ciphertext(length) | tag(16)
+//
+// The ciphertext continues the direction's keystream. The tag is the
+// StarGate MAC, truncated to 16 bytes, over the record sequence number, the
+// type, the length and the ciphertext, and is checked before decrypting.
+// After RekeyAfter bytes the sender sends a rekey record and both sides
+// replace the direction's secret with HKDF of the old one. A peer that
+// sends more without rekeying is cut off.
+package net
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	stdnet "net"
+	"stargate/sg"
+	"stargate/sg/noise"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// MaxRecord is the largest payload of one record.
+	MaxRecord = 16 * 1024
+	// DefaultRekeyAfter is how many payload bytes a direction carries
+	// before it is rekeyed, unless Config says otherwise.
+	DefaultRekeyAfter = 64 << 20
+
+	versionPSK    = 1
+	versionStatic = 2
+
+	helloSize  = 4 + 1 + sg.NonceSize
+	headerSize = 3
+	tagSize    = 16
+	secretSize = 64
+)
+
+const (
+	recordData byte = iota
+	recordFinished
+	recordRekey
+	recordClose
+)
+
+var helloMagic = [4]byte{'S', 'T', 'G', 'N'}
+
+var (
+	ErrHandshake      = errors.New("sg/net: handshake failed, wrong key or not a StarGate peer")
+	ErrBadRecord      = errors.New("sg/net: record authentication failed")
+	ErrRekeyRequired  = errors.New("sg/net: peer exceeded the rekey limit")
+	ErrRecordTooLarge = errors.New("sg/net: record too large")
+)
+
+type Config struct {
+	// Key is the pre-shared key. The Conn keeps no reference to it after
+	// the handshake. With Static it is optional and adds to the handshake.
+	Key *sg.Key
+	// Static switches to the X25519 handshake with this key pair. Both
+	// peers need one.
+	Static *noise.KeyPair
+	// PeerKeys pins the static keys the peer may have. If empty, any peer
+	// key is accepted; check Conn.PeerStatic then.
+	PeerKeys []noise.PublicKey
+	// RekeyAfter is the number of payload bytes after which a direction
+	// is rekeyed. Both peers must agree on it. Zero means
+	// DefaultRekeyAfter.
+	RekeyAfter uint64
+}
+
+func (c *Config) version() byte {
+	if c.Static != nil {
+		return versionStatic
+	}
+	return versionPSK
+}
+
+func (c *Config) rekeyAfter() uint64 {
+	if c.RekeyAfter == 0 {
+		return DefaultRekeyAfter
+	}
+	return c.RekeyAfter
+}
+
+// Conn is a net.Conn secured with StarGate. The handshake runs on the
+// first Read or Write, or explicitly with Handshake.
+type Conn struct {
+	conn     stdnet.Conn
+	config   Config
+	isClient bool
+
+	handshakeMu  sync.Mutex
+	handshakeErr error
+	handshaked   bool
+	peerStatic   noise.PublicKey
+
+	in, out halfConn
+	pending []byte
+}
+
+// halfConn is the state of one direction.
+type halfConn struct {
+	mu     sync.Mutex
+	secret [secretSize]byte
+	cipher *sg.Cipher
+	mac    *sg.MAC
+	seq    uint64
+	bytes  uint64
+	err    error
+	buf    []byte
+}
+
+// Client wraps conn as the dialing side.
+func Client(conn stdnet.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: *config, isClient: true}
+}
+
+// Server wraps conn as the accepting side.
+func Server(conn stdnet.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: *config}
+}
+
+// Dial connects to addr and runs the handshake.
+func Dial(network, addr string, config *Config) (*Conn, error) {
+	raw, err := stdnet.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Client(raw, config)
+	if err := c.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type listener struct {
+	stdnet.Listener
+	config *Config
+}
+
+// Listen returns a listener whose Accept yields *Conn. The handshake runs
+// on first use of an accepted connection, so a slow client does not hold
+// up Accept.
+func Listen(network, addr string, config *Config) (stdnet.Listener, error) {
+	l, err := stdnet.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: l, config: config}, nil
+}
+
+func (l *listener) Accept() (stdnet.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Server(c, l.config), nil
+}
+
+// Handshake exchanges nonces with the peer, runs the static key handshake
+// if configured, and checks that both hold the same keys. It is safe to
+// call more than once.
+func (c *Conn) Handshake() error {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	if !c.handshaked {
+		c.handshakeErr = c.handshake()
+		c.handshaked = true
+		c.config.Key = nil
+	}
+	return c.handshakeErr
+}
+
+func (c *Conn) handshake() error {
+	if c.config.Static == nil && (c.config.Key == nil || c.config.Key.Len() == 0) {
+		return sg.ErrEmptyKey
+	}
+
+	nonce, err := sg.GenNonce()
+	if err != nil {
+		return err
+	}
+
+	var hello [helloSize]byte
+	copy(hello[:], helloMagic[:])
+	hello[4] = c.config.version()
+	copy(hello[5:], nonce[:])
+
+	var peer [helloSize]byte
+	var clientHello, serverHello []byte
+
+	if c.isClient {
+		if _, err := c.conn.Write(hello[:]); err != nil {
+			return err
+		}
+		if err := c.readHello(&peer); err != nil {
+			return err
+		}
+		clientHello, serverHello = hello[:], peer[:]
+	} else {
+		if err := c.readHello(&peer); err != nil {
+			return err
+		}
+		if _, err := c.conn.Write(hello[:]); err != nil {
+			return err
+		}
+		clientHello, serverHello = peer[:], hello[:]
+	}
+
+	transcript := append(bytes.Clone(clientHello), serverHello...)
+
+	var ikm []byte
+	if c.config.Key != nil {
+		ikm = bytes.Clone(c.config.Key.Bytes())
+	}
+	if c.config.Static != nil {
+		exported, hash, err := c.staticHandshake(transcript)
+		if err != nil {
+			return err
+		}
+		ikm = append(exported, ikm...)
+		transcript = append(transcript, hash...)
+	}
+	defer clear(ikm)
+
+	salt := append(bytes.Clone(clientHello[5:]), serverHello[5:]...)
+	c2s := deriveSecret(ikm, salt, "StarGate net client to server")
+	s2c := deriveSecret(ikm, salt, "StarGate net server to client")
+	defer clear(c2s)
+	defer clear(s2c)
+
+	if c.isClient {
+		err = c.out.setSecret(c2s)
+		if err == nil {
+			err = c.in.setSecret(s2c)
+		}
+	} else {
+		err = c.out.setSecret(s2c)
+		if err == nil {
+			err = c.in.setSecret(c2s)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	finished := sha256.Sum256(transcript)
+
+	// The server proves the key first, the client after checking it.
+	if c.isClient {
+		if err := c.readFinished(finished); err != nil {
+			return err
+		}
+		return c.writeRecord(recordFinished, finished[:])
+	}
+
+	if err := c.writeRecord(recordFinished, finished[:]); err != nil {
+		return err
+	}
+	return c.readFinished(finished)
+}
+
+// staticHandshake runs the XX handshake bound to the hellos and returns a
+// secret exported from it and the handshake hash.
+func (c *Conn) staticHandshake(hellos []byte) (exported, hash []byte, err error) {
+	config := &noise.Config{
+		Static:   c.config.Static,
+		PeerKeys: c.config.PeerKeys,
+		Prologue: hellos,
+	}
+
+	var res *noise.Result
+	if c.isClient {
+		res, err = noise.Initiate(c.conn, config)
+	} else {
+		res, err = noise.Respond(c.conn, config)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrHandshake, err)
+	}
+	// The records use their own keys derived from the export, not the
+	// session ciphers.
+	defer res.Close()
+
+	c.peerStatic = res.PeerStatic
+	return res.ExportSecret("StarGate net", secretSize), res.Hash[:], nil
+}
+
+func (c *Conn) readHello(peer *[helloSize]byte) error {
+	if _, err := io.ReadFull(c.conn, peer[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrHandshake, err)
+	}
+	if !bytes.Equal(peer[:4], helloMagic[:]) {
+		return ErrHandshake
+	}
+	switch peer[4] {
+	case c.config.version():
+	case versionPSK:
+		return fmt.Errorf("%w: the peer uses a pre-shared key only", ErrHandshake)
+	case versionStatic:
+		return fmt.Errorf("%w: the peer uses static keys", ErrHandshake)
+	default:
+		return fmt.Errorf("sg/net: unsupported protocol version %d", peer[4])
+	}
+	return nil
+}
+
+func (c *Conn) readFinished(transcript [sha256.Size]byte) error {
+	typ, payload, err := c.readRecord()
+	if err != nil {
+		return ErrHandshake
+	}
+	if typ != recordFinished || subtle.ConstantTimeCompare(payload, transcript[:]) != 1 {
+		return ErrHandshake
+	}
+	return nil
+}
+
+func deriveSecret(ikm, salt []byte, info string) []byte {
+	secret := make([]byte, secretSize)
+	io.ReadFull(hkdf.New(sha512.New, ikm, salt, []byte(info)), secret)
+	return secret
+}
+
+// setSecret keys the direction from secret: a stream key, a stream nonce
+// and a MAC key.
+func (h *halfConn) setSecret(secret []byte) error {
+	var m [64 + sg.NonceSize + 64]byte
+	defer clear(m[:])
+	io.ReadFull(hkdf.New(sha512.New, secret, nil, []byte("StarGate net keys")), m[:])
+
+	key := sg.NewKey(m[:64])
+	defer key.Destroy()
+	macKey := sg.NewKey(m[64+sg.NonceSize:])
+	defer macKey.Destroy()
+
+	var nonce sg.Nonce
+	copy(nonce[:], m[64:])
+
+	cipher, err := sg.NewCipher(key, nonce, false)
+	if err != nil {
+		return err
+	}
+	mac, err := sg.NewMAC(macKey)
+	if err != nil {
+		cipher.Close()
+		return err
+	}
+
+	h.close()
+	h.cipher, h.mac = cipher, mac
+	copy(h.secret[:], secret)
+	h.bytes = 0
+	return nil
+}
+
+func (h *halfConn) rekey() error {
+	next := make([]byte, secretSize)
+	defer clear(next)
+	io.ReadFull(hkdf.New(sha512.New, h.secret[:], nil, []byte("StarGate net rekey")), next)
+
+	return h.setSecret(next)
+}
+
+func (h *halfConn) tag(header, ciphertext []byte) []byte {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], h.seq)
+
+	h.mac.Reset()
+	h.mac.Write(seq[:])
+	h.mac.Write(header)
+	h.mac.Write(ciphertext)
+	return h.mac.Sum(nil)[:tagSize]
+}
+
+func (h *halfConn) close() {
+	if h.cipher != nil {
+		h.cipher.Close()
+		h.mac.Close()
+	}
+	clear(h.secret[:])
+}
+
+// writeRecord sends one record. The caller holds c.out.mu or is the
+// handshake.
+func (c *Conn) writeRecord(typ byte, payload []byte) error {
+	h := &c.out
+	if h.err != nil {
+		return h.err
+	}
+
+	n := headerSize + len(payload) + tagSize
+	if cap(h.buf) < n {
+		h.buf = make([]byte, n)
+	}
+	rec := h.buf[:n]
+
+	rec[0] = typ
+	binary.BigEndian.PutUint16(rec[1:3], uint16(len(payload)))
+	ct := rec[headerSize : headerSize+len(payload)]
+	h.cipher.XORKeyStream(ct, payload)
+	copy(rec[headerSize+len(payload):], h.tag(rec[:headerSize], ct))
+
+	h.seq++
+	if _, err := c.conn.Write(rec); err != nil {
+		h.err = err
+		return err
+	}
+	return nil
+}
+
+// readRecord receives, checks and decrypts one record in place. The
+// caller holds c.in.mu or is the handshake.
+func (c *Conn) readRecord() (byte, []byte, error) {
+	h := &c.in
+	if h.err != nil {
+		return 0, nil, h.err
+	}
+
+	fail := func(err error) (byte, []byte, error) {
+		h.err = err
+		return 0, nil, err
+	}
+
+	var header [headerSize]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		return fail(err)
+	}
+
+	size := int(binary.BigEndian.Uint16(header[1:3]))
+	if size > MaxRecord {
+		return fail(ErrRecordTooLarge)
+	}
+
+	if cap(h.buf) < size+tagSize {
+		h.buf = make([]byte, size+tagSize)
+	}
+	rec := h.buf[:size+tagSize]
+	if _, err := io.ReadFull(c.conn, rec); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fail(err)
+	}
+
+	ct, tag := rec[:size], rec[size:]
+	if subtle.ConstantTimeCompare(h.tag(header[:], ct), tag) != 1 {
+		return fail(ErrBadRecord)
+	}
+	h.seq++
+
+	h.cipher.XORKeyStream(ct, ct)
+	return header[0], ct, nil
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.in.mu.Lock()
+	defer c.in.mu.Unlock()
+
+	for len(c.pending) == 0 {
+		typ, payload, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+
+		switch typ {
+		case recordData:
+			c.in.bytes += uint64(len(payload))
+			if c.in.bytes > c.config.rekeyAfter() {
+				c.in.err = ErrRekeyRequired
+				return 0, c.in.err
+			}
+			c.pending = payload
+		case recordRekey:
+			if err := c.in.rekey(); err != nil {
+				c.in.err = err
+				return 0, err
+			}
+		case recordClose:
+			c.in.err = io.EOF
+			return 0, io.EOF
+		default:
+			c.in.err = ErrBadRecord
+			return 0, ErrBadRecord
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.out.mu.Lock()
+	defer c.out.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), MaxRecord)]
+
+		if c.out.bytes+uint64(len(chunk)) > c.config.rekeyAfter() {
+			if err := c.writeRecord(recordRekey, nil); err != nil {
+				return written, err
+			}
+			if err := c.out.rekey(); err != nil {
+				c.out.err = err
+				return written, err
+			}
+		}
+
+		if err := c.writeRecord(recordData, chunk); err != nil {
+			return written, err
+		}
+		c.out.bytes += uint64(len(chunk))
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// CloseWrite tells the peer that no more data follows; its Read returns
+// io.EOF. Reading continues to work.
+func (c *Conn) CloseWrite() error {
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+
+	c.out.mu.Lock()
+	defer c.out.mu.Unlock()
+
+	if err := c.writeRecord(recordClose, nil); err != nil {
+		return err
+	}
+	c.out.err = stdnet.ErrClosed
+
+	if cw, ok := c.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close closes the connection and wipes the keys.
+func (c *Conn) Close() error {
+	err := c.conn.Close()
+
+	c.out.mu.Lock()
+	c.out.close()
+	c.out.err = stdnet.ErrClosed
+	c.out.mu.Unlock()
+
+	c.in.mu.Lock()
+	c.in.close()
+	c.in.err = stdnet.ErrClosed
+	c.in.mu.Unlock()
+
+	return err
+}
+
+// PeerStatic returns the peer's static key once the handshake is done
+// with static keys.
+func (c *Conn) PeerStatic() noise.PublicKey {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+	return c.peerStatic
+}
+
+func (c *Conn) LocalAddr() stdnet.Addr             { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() stdnet.Addr            { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+func (c *Conn) NetConn() stdnet.Conn               { return c.conn }
@@ -0,0 +1,211 @@
+package net
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	stdnet "net"
+	"stargate/sg"
+	"stargate/sg/noise"
+	"testing"
+)
+
+func testKey(t *testing.T) *sg.Key {
+	key := sg.KeyFromString("StarGate net test key")
+	t.Cleanup(key.Destroy)
+	return key
+}
+
+// duplex sends 1 MiB each way at the same time and closes both ends.
+func duplex(t *testing.T, x, y *Conn) {
+	t.Helper()
+	defer x.Close()
+	defer y.Close()
+
+	const size = 1 << 20
+	dataX := make([]byte, size)
+	dataY := make([]byte, size)
+	rand.Read(dataX)
+	rand.Read(dataY)
+
+	errs := make(chan error, 2)
+	send := func(c *Conn, data []byte) {
+		_, err := c.Write(data)
+		if err == nil {
+			err = c.CloseWrite()
+		}
+		errs <- err
+	}
+	go send(x, dataX)
+	go send(y, dataY)
+
+	gotY, errX := io.ReadAll(x)
+	gotX, errY := io.ReadAll(y)
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := errors.Join(errX, errY); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotX, dataX) || !bytes.Equal(gotY, dataY) {
+		t.Fatal("received data differs from sent data")
+	}
+}
+
+// TestPipe uses a RekeyAfter small enough that several rekeys happen.
+func TestPipe(t *testing.T) {
+	config := &Config{Key: testKey(t), RekeyAfter: 100 << 10}
+
+	a, b := stdnet.Pipe()
+	duplex(t, Client(a, config), Server(b, config))
+}
+
+func TestLoopback(t *testing.T) {
+	config := &Config{Key: testKey(t), RekeyAfter: 100 << 10}
+
+	l, err := Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Dial returns after the handshake, so the server side has to run
+	// its part meanwhile.
+	accepted := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		c.(*Conn).Handshake()
+		accepted <- c.(*Conn)
+	}()
+
+	client, err := Dial("tcp", l.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, ok := <-accepted
+	if !ok {
+		t.Fatal("accept failed")
+	}
+	duplex(t, client, server)
+}
+
+func TestWrongKey(t *testing.T) {
+	other := sg.KeyFromString("some other key")
+	defer other.Destroy()
+
+	a, b := stdnet.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go Server(b, &Config{Key: testKey(t)}).Handshake()
+
+	if err := Client(a, &Config{Key: other}).Handshake(); !errors.Is(err, ErrHandshake) {
+		t.Fatalf("handshake with a wrong key: got %v, want %v", err, ErrHandshake)
+	}
+}
+
+// TestTampered flips one ciphertext bit of the first data record.
+func TestTampered(t *testing.T) {
+	config := &Config{Key: testKey(t)}
+
+	a, b := stdnet.Pipe()
+	m, n := stdnet.Pipe()
+	defer a.Close()
+	defer n.Close()
+
+	// Relay b ↔ m, flipping a bit in the first client record after the
+	// handshake: the hello and the finished record come first.
+	go func() {
+		buf := make([]byte, 64<<10)
+		var seen int
+		skip := helloSize + headerSize + 32 + tagSize
+		for {
+			k, err := b.Read(buf)
+			if k > 0 {
+				if seen <= skip && seen+k > skip+headerSize {
+					buf[skip+headerSize-seen] ^= 1
+				}
+				seen += k
+				m.Write(buf[:k])
+			}
+			if err != nil {
+				m.Close()
+				return
+			}
+		}
+	}()
+	go io.Copy(b, m)
+
+	client := Client(a, config)
+	server := Server(n, config)
+
+	go func() {
+		client.Write([]byte("attack at dawn"))
+	}()
+
+	if _, err := server.Read(make([]byte, 64)); !errors.Is(err, ErrBadRecord) {
+		t.Fatalf("tampered record: got %v, want %v", err, ErrBadRecord)
+	}
+}
+
+func keyPair(t *testing.T) *noise.KeyPair {
+	kp, err := noise.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func TestStaticKeys(t *testing.T) {
+	client, server := keyPair(t), keyPair(t)
+
+	clientConfig := &Config{Static: client, PeerKeys: []noise.PublicKey{server.Public}}
+	serverConfig := &Config{Static: server, PeerKeys: []noise.PublicKey{client.Public}}
+
+	a, b := stdnet.Pipe()
+	x, y := Client(a, clientConfig), Server(b, serverConfig)
+	duplex(t, x, y)
+	if x.PeerStatic() != server.Public || y.PeerStatic() != client.Public {
+		t.Fatal("wrong peer static key")
+	}
+}
+
+// TestUnpinnedPeer runs a server that pins some other client.
+func TestUnpinnedPeer(t *testing.T) {
+	client, server, other := keyPair(t), keyPair(t), keyPair(t)
+
+	a, b := stdnet.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go Client(a, &Config{Static: client, PeerKeys: []noise.PublicKey{server.Public}}).Handshake()
+
+	pinned := &Config{Static: server, PeerKeys: []noise.PublicKey{other.Public}}
+	if err := Server(b, pinned).Handshake(); !errors.Is(err, noise.ErrUnknownPeer) {
+		t.Fatalf("unpinned client: got %v, want %v", err, noise.ErrUnknownPeer)
+	}
+}
+
+// TestMixedModes pairs a pre-shared key client with a static key server.
+func TestMixedModes(t *testing.T) {
+	client, server := keyPair(t), keyPair(t)
+
+	a, b := stdnet.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go Client(a, &Config{Key: testKey(t)}).Handshake()
+
+	serverConfig := &Config{Static: server, PeerKeys: []noise.PublicKey{client.Public}}
+	if err := Server(b, serverConfig).Handshake(); !errors.Is(err, ErrHandshake) {
+		t.Fatalf("mixed modes: got %v, want %v", err, ErrHandshake)
+	}
+}
@@ -0,0 +1,298 @@
+package noise
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"stargate/sg"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// MaxMessage is the largest handshake message on the wire, without its
+// 2-byte length prefix.
+const MaxMessage = 1 << 10
+
+// handshakeState runs one side of the XX pattern one message at a time.
+// Initiate and Respond drive it over a connection; the known-answer test
+// drives both sides in memory.
+type handshakeState struct {
+	ss        symmetricState
+	cfg       *Config
+	initiator bool
+	s, e      *KeyPair
+	re, rs    PublicKey
+	step      int
+}
+
+func newHandshake(cfg *Config, initiator bool) (*handshakeState, error) {
+	if cfg == nil || cfg.Static == nil {
+		return nil, errors.New("noise: config has no static key pair")
+	}
+
+	e := cfg.ephemeral
+	if e == nil {
+		var err error
+		if e, err = GenerateKeyPair(); err != nil {
+			return nil, err
+		}
+	}
+
+	hs := &handshakeState{cfg: cfg, initiator: initiator, s: cfg.Static, e: e}
+	hs.ss.init(cfg.Prologue)
+	return hs, nil
+}
+
+// writes reports whether the next message is ours to write.
+func (hs *handshakeState) writes() bool {
+	return (hs.step%2 == 0) == hs.initiator
+}
+
+func (hs *handshakeState) done() bool {
+	return hs.step == 3
+}
+
+// mixDH mixes the X25519 result of our kp and their pub into the key.
+func (hs *handshakeState) mixDH(kp *KeyPair, pub PublicKey) error {
+	shared, err := dh(kp, pub)
+	if err != nil {
+		return err
+	}
+	defer clear(shared)
+	return hs.ss.mixKey(shared)
+}
+
+func (hs *handshakeState) writeMessage() ([]byte, error) {
+	var msg []byte
+	var err error
+
+	switch hs.step {
+	case 0: // -> e
+		msg = append(msg, hs.e.Public[:]...)
+		hs.ss.mixHash(hs.e.Public[:])
+	case 1: // <- e, ee, s, es
+		msg = append(msg, hs.e.Public[:]...)
+		hs.ss.mixHash(hs.e.Public[:])
+		if err = hs.mixDH(hs.e, hs.re); err != nil {
+			return nil, err
+		}
+		msg = hs.ss.encryptAndHash(msg, hs.s.Public[:])
+		err = hs.mixDH(hs.s, hs.re)
+	case 2: // -> s, se
+		msg = hs.ss.encryptAndHash(msg, hs.s.Public[:])
+		err = hs.mixDH(hs.s, hs.re)
+	default:
+		return nil, errors.New("noise: handshake already finished")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload is always empty, as in Noise it still advances h.
+	msg = hs.ss.encryptAndHash(msg, nil)
+	hs.step++
+	return msg, nil
+}
+
+// messageLen is the exact length of each message.
+var messageLen = [3]int{
+	DHLen,
+	DHLen + DHLen + sg.AEADOverhead + sg.AEADOverhead,
+	DHLen + sg.AEADOverhead + sg.AEADOverhead,
+}
+
+func (hs *handshakeState) readMessage(msg []byte) error {
+	if hs.step > 2 {
+		return errors.New("noise: handshake already finished")
+	}
+	if len(msg) != messageLen[hs.step] {
+		return fmt.Errorf("%w: message %d has %d bytes, want %d", ErrHandshake, hs.step+1, len(msg), messageLen[hs.step])
+	}
+
+	var err error
+	switch hs.step {
+	case 0: // -> e
+		copy(hs.re[:], msg)
+		hs.ss.mixHash(hs.re[:])
+		msg = msg[DHLen:]
+	case 1: // <- e, ee, s, es
+		copy(hs.re[:], msg)
+		hs.ss.mixHash(hs.re[:])
+		msg = msg[DHLen:]
+		if err = hs.mixDH(hs.e, hs.re); err != nil {
+			return err
+		}
+		if err = hs.readStatic(msg[:DHLen+sg.AEADOverhead]); err != nil {
+			return err
+		}
+		msg = msg[DHLen+sg.AEADOverhead:]
+		err = hs.mixDH(hs.e, hs.rs)
+	case 2: // -> s, se
+		if err = hs.readStatic(msg[:DHLen+sg.AEADOverhead]); err != nil {
+			return err
+		}
+		msg = msg[DHLen+sg.AEADOverhead:]
+		err = hs.mixDH(hs.e, hs.rs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := hs.ss.decryptAndHash(msg); err != nil {
+		return err
+	}
+	hs.step++
+	return nil
+}
+
+// readStatic decrypts the peer's static key and checks it is pinned.
+func (hs *handshakeState) readStatic(ct []byte) error {
+	s, err := hs.ss.decryptAndHash(ct)
+	if err != nil {
+		return err
+	}
+	copy(hs.rs[:], s)
+	return hs.cfg.checkPeer(hs.rs)
+}
+
+// Result is a finished handshake.
+type Result struct {
+	// Send encrypts what this peer sends, Recv decrypts what it receives.
+	Send, Recv *sg.Cipher
+	// PeerStatic is the peer's authenticated static key.
+	PeerStatic PublicKey
+	// Hash is the final transcript hash h. Both peers have the same value,
+	// and it is unique to the session, so it suits channel binding.
+	Hash [HashLen]byte
+
+	ck [HashLen]byte
+}
+
+// split derives the session ciphers. sg.DeriveStateFromKey expands ck with
+// a prefix of h as salt into 512 bytes: the initiator's key and nonce
+// come first, then the responder's.
+func (hs *handshakeState) split() (*Result, error) {
+	if !hs.done() {
+		return nil, errors.New("noise: handshake not finished")
+	}
+
+	material, err := sg.DeriveStateFromKey(hs.ss.ck[:], hs.ss.h[:sg.NonceSize])
+	if err != nil {
+		return nil, err
+	}
+	defer clear(material)
+
+	const half = sessionKeyLen + sg.NonceSize
+	initiator, err := sessionCipher(material[:half])
+	if err != nil {
+		return nil, err
+	}
+	responder, err := sessionCipher(material[half : 2*half])
+	if err != nil {
+		initiator.Close()
+		return nil, err
+	}
+
+	res := &Result{PeerStatic: hs.rs, Hash: hs.ss.h, ck: hs.ss.ck}
+	if hs.initiator {
+		res.Send, res.Recv = initiator, responder
+	} else {
+		res.Send, res.Recv = responder, initiator
+	}
+	hs.ss.close()
+	return res, nil
+}
+
+func sessionCipher(b []byte) (*sg.Cipher, error) {
+	key := sg.NewKey(b[:sessionKeyLen])
+	defer key.Destroy()
+
+	var nonce sg.Nonce
+	copy(nonce[:], b[sessionKeyLen:])
+	return sg.NewCipher(key, nonce, false)
+}
+
+// ExportSecret derives n bytes for label from the handshake, for protocols
+// that key their own records instead of using Send and Recv.
+func (r *Result) ExportSecret(label string, n int) []byte {
+	out := make([]byte, n)
+	io.ReadFull(hkdf.New(sha512.New, r.ck[:], r.Hash[:], []byte("StarGate noise export "+label)), out)
+	return out
+}
+
+// Close wipes the session ciphers and the chaining key.
+func (r *Result) Close() {
+	r.Send.Close()
+	r.Recv.Close()
+	clear(r.ck[:])
+}
+
+// Initiate runs the handshake as the initiator over rw. Messages are
+// framed with a 2-byte big-endian length.
+func Initiate(rw io.ReadWriter, cfg *Config) (*Result, error) {
+	return run(rw, cfg, true)
+}
+
+// Respond runs the handshake as the responder over rw.
+func Respond(rw io.ReadWriter, cfg *Config) (*Result, error) {
+	return run(rw, cfg, false)
+}
+
+func run(rw io.ReadWriter, cfg *Config, initiator bool) (*Result, error) {
+	hs, err := newHandshake(cfg, initiator)
+	if err != nil {
+		return nil, err
+	}
+	defer hs.ss.close()
+	if cfg.ephemeral == nil {
+		defer hs.e.Destroy()
+	}
+
+	for !hs.done() {
+		if hs.writes() {
+			msg, err := hs.writeMessage()
+			if err != nil {
+				return nil, err
+			}
+			if err := writeFrame(rw, msg); err != nil {
+				return nil, err
+			}
+		} else {
+			msg, err := readFrame(rw)
+			if err != nil {
+				return nil, err
+			}
+			if err := hs.readMessage(msg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return hs.split()
+}
+
+func writeFrame(w io.Writer, msg []byte) error {
+	frame := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint16(n[:])
+	if size > MaxMessage {
+		return nil, fmt.Errorf("%w: message of %d bytes", ErrHandshake, size)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
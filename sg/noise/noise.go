@@ -0,0 +1,208 @@
+// Package noise is a Noise-style authenticated key exchange that yields
+// StarGate session ciphers. It follows the Noise XX pattern with X25519:
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+//
+// Both peers prove possession of a static key pair, and static keys travel
+// encrypted. The symmetric state is Noise's: a SHA-512 transcript hash h
+// and chaining key ck updated with HKDF-SHA512; static keys are encrypted
+// with sg.AEAD keyed from ck, with h as associated data. At the end
+// sg.DeriveStateFromKey(ck, h) supplies the session key and nonce of each
+// direction.
+//
+// This is not an interoperable Noise implementation: the cipher is
+// StarGate and the protocol name says so.
+package noise
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"stargate/sg"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const protocolName = "Noise_XX_25519_StarGate_SHA512"
+
+const (
+	DHLen   = 32
+	HashLen = sha512.Size
+	// sessionKeyLen is the key length of each session cipher.
+	sessionKeyLen = 128
+)
+
+var (
+	ErrHandshake   = errors.New("noise: handshake failed")
+	ErrUnknownPeer = errors.New("noise: peer static key is not pinned")
+)
+
+type PublicKey [DHLen]byte
+
+func (p PublicKey) String() string {
+	return hex.EncodeToString(p[:])
+}
+
+func ParsePublicKey(s string) (PublicKey, error) {
+	var p PublicKey
+	if hex.DecodedLen(len(s)) != DHLen {
+		return p, fmt.Errorf("public key must be %d hex digits", 2*DHLen)
+	}
+	_, err := hex.Decode(p[:], []byte(s))
+	return p, err
+}
+
+type KeyPair struct {
+	Public  PublicKey
+	Private [DHLen]byte
+}
+
+func GenerateKeyPair() (*KeyPair, error) {
+	var priv [DHLen]byte
+	if _, err := rand.Read(priv[:]); err != nil {
+		return nil, err
+	}
+	return NewKeyPair(priv[:])
+}
+
+// NewKeyPair computes the public key of a 32-byte X25519 private key.
+func NewKeyPair(private []byte) (*KeyPair, error) {
+	if len(private) != DHLen {
+		return nil, fmt.Errorf("private key must be %d bytes", DHLen)
+	}
+
+	kp := &KeyPair{}
+	copy(kp.Private[:], private)
+	pub, err := curve25519.X25519(kp.Private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	copy(kp.Public[:], pub)
+	return kp, nil
+}
+
+// Destroy wipes the private key.
+func (kp *KeyPair) Destroy() {
+	clear(kp.Private[:])
+}
+
+type Config struct {
+	// Static is this peer's long-term key pair.
+	Static *KeyPair
+	// PeerKeys pins the static keys the peer may use. If empty, any key is
+	// accepted and the caller must check Result.PeerStatic itself.
+	PeerKeys []PublicKey
+	// Prologue is data both peers must agree on, such as protocol
+	// framing that came before the handshake. It is bound into h.
+	Prologue []byte
+
+	// ephemeral replaces the random ephemeral key pair in known-answer
+	// tests.
+	ephemeral *KeyPair
+}
+
+func (c *Config) checkPeer(p PublicKey) error {
+	if len(c.PeerKeys) == 0 {
+		return nil
+	}
+	for _, k := range c.PeerKeys {
+		if k == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownPeer, p)
+}
+
+type symmetricState struct {
+	ck [HashLen]byte
+	h  [HashLen]byte
+	k  *sg.AEAD
+	n  uint64
+}
+
+func (s *symmetricState) init(prologue []byte) {
+	// The name is shorter than HashLen, so it is padded, not hashed.
+	copy(s.h[:], protocolName)
+	s.ck = s.h
+	s.mixHash(prologue)
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	d := sha512.New()
+	d.Write(s.h[:])
+	d.Write(data)
+	d.Sum(s.h[:0])
+}
+
+func (s *symmetricState) mixKey(ikm []byte) error {
+	var out [2 * HashLen]byte
+	defer clear(out[:])
+	io.ReadFull(hkdf.New(sha512.New, ikm, s.ck[:], nil), out[:])
+
+	copy(s.ck[:], out[:HashLen])
+
+	key := sg.NewKey(out[HashLen:])
+	defer key.Destroy()
+
+	k, err := sg.NewAEAD(key)
+	if err != nil {
+		return err
+	}
+	if s.k != nil {
+		s.k.Close()
+	}
+	s.k, s.n = k, 0
+	return nil
+}
+
+func (s *symmetricState) nonce() []byte {
+	var n [sg.NonceSize]byte
+	binary.BigEndian.PutUint64(n[8:], s.n)
+	s.n++
+	return n[:]
+}
+
+func (s *symmetricState) encryptAndHash(dst, plaintext []byte) []byte {
+	out := plaintext
+	if s.k != nil {
+		out = s.k.Seal(nil, s.nonce(), plaintext, s.h[:])
+	}
+	s.mixHash(out)
+	return append(dst, out...)
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	out := ciphertext
+	if s.k != nil {
+		var err error
+		if out, err = s.k.Open(nil, s.nonce(), ciphertext, s.h[:]); err != nil {
+			return nil, ErrHandshake
+		}
+	}
+	s.mixHash(ciphertext)
+	return out, nil
+}
+
+func (s *symmetricState) close() {
+	if s.k != nil {
+		s.k.Close()
+		s.k = nil
+	}
+	clear(s.ck[:])
+}
+
+func dh(kp *KeyPair, pub PublicKey) ([]byte, error) {
+	out, err := curve25519.X25519(kp.Private[:], pub[:])
+	if err != nil {
+		// A low-order point from the peer.
+		return nil, ErrHandshake
+	}
+	return out, nil
+}
@@ -0,0 +1,308 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"testing"
+)
+
+// transcript is a handshake between fixed static and ephemeral keys: the
+// three messages, the transcript hash h after each of them, and the start
+// of the initiator's sending keystream. Any change to the wire format, the
+// symmetric state, the split or the reinit mix shows up here.
+type transcript struct {
+	initiatorStatic, initiatorEphemeral string
+	responderStatic, responderEphemeral string
+	prologue                            string
+	messages                            [3]string
+	hashes                              [3]string
+	keystream                           string
+}
+
+// recorded is a transcript of a handshake between fixed keys.
+var recorded = transcript{
+	initiatorStatic:    "1111111111111111111111111111111111111111111111111111111111111111",
+	initiatorEphemeral: "2222222222222222222222222222222222222222222222222222222222222222",
+	responderStatic:    "3333333333333333333333333333333333333333333333333333333333333333",
+	responderEphemeral: "4444444444444444444444444444444444444444444444444444444444444444",
+	prologue:           "StarGate noise recorded transcript",
+	messages: [3]string{
+		"0faa684ed28867b97f4a6a2dee5df8ce974e76b7018e3f22a1c4cf2678570f20",
+		"ff2ee45601ec1b67310c7790404585ae697331eee1c1f8cf2419731c1fff3e6b" +
+			"ef9a0682310fc419a44399f13c6364411f39a5270047c782f1a3add11050f9a5" +
+			"8166cfbe021594d7d2e94864625a39420dfb5bd9c25c085432efe854103bcab6" +
+			"3d754e4efb05bd9d70da34dc9c4cee27a64b3ea337cc170364d52a8ac76f326a",
+		"a51f0c27a94172687d257eb9e7f31438c856bfee1660df1eea0986af8970b477" +
+			"dc16667139d482f91a94cdf9eabc0f61c6a7a8cbf7939d976d88e97bb7839c64" +
+			"1305e3772a05b3f732557d3d7366f3ad33d049fe34d319b8aa6f42f5d8d24724",
+	},
+	hashes: [3]string{
+		"334701e48022037585c3df5a4ceb4f8b763402e8b02401693d5add485d179418" +
+			"8c17a3955c4f9486306cbdf5cc57068b94802c7033e6a9a439ab295fee5238d1",
+		"986510ad879731f49f2b7bf651ae612e39f8edc6e8361ec473de22f5a162fa5d" +
+			"440b6f84e88bea16347ccd13f208a5f16fea0825fb74254567324224878804f6",
+		"92a029188652ddbbdca6842a71365feecaae8ef38c709a623f31f075d393c142" +
+			"c0cb382e2436efc687969105225f4a2491ad604c1e87dbda8bad355f7be39dc8",
+	},
+	keystream: "47b9df1198df7798d724232df85af95684eb6a61fb110635ed1126569a402930",
+}
+
+// TestRecorded replays the recorded transcript on both sides and checks
+// every message and transcript hash against it.
+func TestRecorded(t *testing.T) {
+	if err := checkRecorded(recorded); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustKeyPair(h string) *KeyPair {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		panic(err)
+	}
+	kp, err := NewKeyPair(b)
+	if err != nil {
+		panic(err)
+	}
+	return kp
+}
+
+// configs returns the initiator and responder configs of t, each pinning
+// the other.
+func (t transcript) configs() (i, r *Config) {
+	is, rs := mustKeyPair(t.initiatorStatic), mustKeyPair(t.responderStatic)
+	prologue := []byte(t.prologue)
+
+	i = &Config{
+		Static:    is,
+		PeerKeys:  []PublicKey{rs.Public},
+		Prologue:  prologue,
+		ephemeral: mustKeyPair(t.initiatorEphemeral),
+	}
+	r = &Config{
+		Static:    rs,
+		PeerKeys:  []PublicKey{is.Public},
+		Prologue:  prologue,
+		ephemeral: mustKeyPair(t.responderEphemeral),
+	}
+	return i, r
+}
+
+func checkRecorded(t transcript) error {
+	ic, rc := t.configs()
+
+	i, err := newHandshake(ic, true)
+	if err != nil {
+		return err
+	}
+	r, err := newHandshake(rc, false)
+	if err != nil {
+		return err
+	}
+
+	for step := range 3 {
+		from, to := i, r
+		if !i.writes() {
+			from, to = r, i
+		}
+
+		msg, err := from.writeMessage()
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(msg); got != t.messages[step] {
+			return fmt.Errorf("message %d: got %s, want %s", step+1, got, t.messages[step])
+		}
+		if err := to.readMessage(msg); err != nil {
+			return fmt.Errorf("message %d: %w", step+1, err)
+		}
+
+		for _, hs := range []*handshakeState{i, r} {
+			if got := hex.EncodeToString(hs.ss.h[:]); got != t.hashes[step] {
+				return fmt.Errorf("h after message %d: got %s, want %s", step+1, got, t.hashes[step])
+			}
+		}
+	}
+
+	ir, err := i.split()
+	if err != nil {
+		return err
+	}
+	defer ir.Close()
+	rr, err := r.split()
+	if err != nil {
+		return err
+	}
+	defer rr.Close()
+
+	if ir.PeerStatic != rc.Static.Public || rr.PeerStatic != ic.Static.Public {
+		return errors.New("peer static keys differ from the configured ones")
+	}
+
+	ks := make([]byte, hex.DecodedLen(len(t.keystream)))
+	ir.Send.XORKeyStream(ks, ks)
+	if got := hex.EncodeToString(ks); got != t.keystream {
+		return fmt.Errorf("keystream: got %s, want %s", got, t.keystream)
+	}
+	// Keep the responder's receiving side in step.
+	rr.Recv.XORKeyStream(ks, ks)
+
+	return checkPair(ir, rr)
+}
+
+// checkPair checks that each side decrypts what the other encrypts.
+func checkPair(a, b *Result) error {
+	if a.Hash != b.Hash {
+		return errors.New("handshake hashes differ")
+	}
+	if !bytes.Equal(a.ExportSecret("check", 32), b.ExportSecret("check", 32)) {
+		return errors.New("exported secrets differ")
+	}
+
+	for _, p := range [][2]*Result{{a, b}, {b, a}} {
+		msg := []byte("through the gate and back again")
+		ct := make([]byte, len(msg))
+		p[0].Send.XORKeyStream(ct, msg)
+		if bytes.Equal(ct, msg) {
+			return errors.New("session cipher did not encrypt")
+		}
+		p[1].Recv.XORKeyStream(ct, ct)
+		if !bytes.Equal(ct, msg) {
+			return errors.New("session ciphers do not match")
+		}
+	}
+	return nil
+}
+
+type outcome struct {
+	res *Result
+	err error
+}
+
+func (o outcome) close() {
+	if o.res != nil {
+		o.res.Close()
+	}
+}
+
+// handshake runs Initiate and Respond against each other over net.Pipe.
+// A side that fails closes its end, so the other one does not wait
+// forever.
+func handshake(ic, rc *Config, tamper func([]byte)) (i, r outcome) {
+	a, b := stdnet.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := Respond(b, rc)
+		if err != nil {
+			b.Close()
+		}
+		done <- outcome{res, err}
+	}()
+
+	var rw stdnet.Conn = a
+	if tamper != nil {
+		rw = tamperConn{a, tamper}
+	}
+	res, err := Initiate(rw, ic)
+	if err != nil {
+		a.Close()
+	}
+	return outcome{res, err}, <-done
+}
+
+// tamperConn lets the test change what the initiator reads.
+type tamperConn struct {
+	stdnet.Conn
+	tamper func([]byte)
+}
+
+func (c tamperConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.tamper(p[:n])
+	return n, err
+}
+
+func TestLive(t *testing.T) {
+	is, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, r := handshake(
+		&Config{Static: is, PeerKeys: []PublicKey{rs.Public}},
+		&Config{Static: rs},
+		nil,
+	)
+	if err := errors.Join(i.err, r.err); err != nil {
+		t.Fatal(err)
+	}
+	defer i.res.Close()
+	defer r.res.Close()
+
+	if i.res.PeerStatic != rs.Public || r.res.PeerStatic != is.Public {
+		t.Fatal("peer static keys differ from the real ones")
+	}
+	if err := checkPair(i.res, r.res); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinning(t *testing.T) {
+	ic, rc := recorded.configs()
+	ic.ephemeral, rc.ephemeral = nil, nil
+
+	other, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := ic.PeerKeys
+	ic.PeerKeys = []PublicKey{other.Public}
+
+	// The initiator learns the responder's key first, in message 2.
+	i, r := handshake(ic, rc, nil)
+	r.close()
+	if !errors.Is(i.err, ErrUnknownPeer) {
+		t.Errorf("initiator with an unpinned responder: got %v, want %v", i.err, ErrUnknownPeer)
+	}
+
+	// The responder learns the initiator's key in message 3.
+	ic.PeerKeys, rc.PeerKeys = pinned, ic.PeerKeys
+	i, r = handshake(ic, rc, nil)
+	i.close()
+	if !errors.Is(r.err, ErrUnknownPeer) {
+		t.Errorf("responder with an unpinned initiator: got %v, want %v", r.err, ErrUnknownPeer)
+	}
+}
+
+// TestTampered flips a bit of the responder's encrypted static key.
+func TestTampered(t *testing.T) {
+	ic, rc := recorded.configs()
+	ic.ephemeral, rc.ephemeral = nil, nil
+
+	// Message 2 is the first thing the initiator reads: a 2-byte length,
+	// the responder's ephemeral key, then its encrypted static key.
+	var seen int
+	flip := func(p []byte) {
+		if at := 2 + DHLen - seen; at >= 0 && at < len(p) {
+			p[at] ^= 1
+		}
+		seen += len(p)
+	}
+
+	i, r := handshake(ic, rc, flip)
+	r.close()
+	if !errors.Is(i.err, ErrHandshake) {
+		t.Fatalf("tampered message: got %v, want %v", i.err, ErrHandshake)
+	}
+}
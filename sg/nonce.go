@@ -0,0 +1,250 @@
+package sg
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const NonceSize = 16
+
+// Nonce salts the state derivation and is XORed into the matrix and gates.
+// It must never repeat under the same key: two streams with the same key and
+// nonce are identical, and XORing their ciphertexts cancels the keystream.
+type Nonce [NonceSize]byte
+
+func GenNonce() (Nonce, error) {
+	var n Nonce
+	if _, err := rand.Read(n[:]); err != nil {
+		return Nonce{}, err
+	}
+	return n, nil
+}
+
+// ParseNonce accepts 32 hex digits, or exactly 16 characters used as raw
+// bytes, which is how nonces were given before they became binary.
+func ParseNonce(s string) (Nonce, error) {
+	var n Nonce
+
+	switch len(s) {
+	case 2 * NonceSize:
+		if _, err := hex.Decode(n[:], []byte(s)); err != nil {
+			return Nonce{}, fmt.Errorf("bad hex nonce: %w", err)
+		}
+	case NonceSize:
+		copy(n[:], s)
+	default:
+		return Nonce{}, fmt.Errorf("nonce must be 32 hex digits or 16 characters, got %d characters", len(s))
+	}
+
+	return n, nil
+}
+
+func (n Nonce) String() string {
+	return hex.EncodeToString(n[:])
+}
+
+// Add returns n + k, treating the nonce as a 128-bit big endian integer.
+func (n Nonce) Add(k uint64) Nonce {
+	carry := k
+	for i := NonceSize - 1; i >= 0 && carry != 0; i-- {
+		sum := uint64(n[i]) + carry&0xff
+		n[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	return n
+}
+
+var ErrNonceExhausted = errors.New("nonce counter exhausted")
+
+// NonceCounter hands out base, base+1, base+2, ... for sequential messages
+// under one key, so no randomness and no registry are needed as long as the
+// counter state is never rolled back.
+type NonceCounter struct {
+	mu   sync.Mutex
+	base Nonce
+	next uint64
+}
+
+func NewNonceCounter(base Nonce, start uint64) *NonceCounter {
+	return &NonceCounter{base: base, next: start}
+}
+
+func (c *NonceCounter) Next() (Nonce, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next == ^uint64(0) {
+		return Nonce{}, ErrNonceExhausted
+	}
+
+	n := c.base.Add(c.next)
+	c.next++
+	return n, nil
+}
+
+// Position returns the counter value the next call to Next will use.
+func (c *NonceCounter) Position() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next
+}
+
+// KeyID is a short public identifier of a key, see Key.ID.
+type KeyID [8]byte
+
+func (id KeyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// ParseKeyID parses the hex form printed for key IDs.
+func ParseKeyID(s string) (KeyID, error) {
+	var id KeyID
+	if hex.DecodedLen(len(s)) != len(id) {
+		return id, fmt.Errorf("key ID must be %d hex digits", 2*len(id))
+	}
+	_, err := hex.Decode(id[:], []byte(s))
+	return id, err
+}
+
+var ErrNonceReuse = errors.New("nonce was already used with this key")
+
+// NonceRegistry remembers every (key ID, nonce) pair it has seen in an
+// append-only file and refuses to hand out a pair twice. Several processes
+// may share the file: Use locks it with flock, reads the entries others
+// appended since, and only then checks and appends the pair. Where flock
+// is not available only one process may use a registry at a time.
+type NonceRegistry struct {
+	mu     sync.Mutex
+	file   *os.File
+	path   string
+	offset int64
+	line   int
+	seen   map[KeyID]map[Nonce]struct{}
+}
+
+func OpenNonceRegistry(path string) (*NonceRegistry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &NonceRegistry{file: f, path: path, seen: make(map[KeyID]map[Nonce]struct{})}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = r.load()
+	unlockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load reads the entries after r.offset. The file must be locked.
+func (r *NonceRegistry) load() error {
+	if _, err := r.file.Seek(r.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r.file)
+	for {
+		text, err := br.ReadString('\n')
+		if err == io.EOF {
+			if len(text) > 0 {
+				// A last line without its newline was cut short by a crash
+				// in Use, which never returned, so its pair was never used.
+				// Drop it, or the next entry would be appended to it.
+				return r.file.Truncate(r.offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		r.line++
+		if err := r.parse(text); err != nil {
+			return fmt.Errorf("%s:%d: %w", r.path, r.line, err)
+		}
+		r.offset += int64(len(text))
+	}
+}
+
+func (r *NonceRegistry) parse(text string) error {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var id KeyID
+	if len(fields) != 2 || hex.DecodedLen(len(fields[0])) != len(id) {
+		return errors.New("malformed nonce registry entry")
+	}
+	if _, err := hex.Decode(id[:], []byte(fields[0])); err != nil {
+		return err
+	}
+
+	n, err := ParseNonce(fields[1])
+	if err != nil || len(fields[1]) != 2*NonceSize {
+		return errors.New("malformed nonce registry entry")
+	}
+
+	r.add(id, n)
+	return nil
+}
+
+func (r *NonceRegistry) add(id KeyID, n Nonce) {
+	if r.seen[id] == nil {
+		r.seen[id] = make(map[Nonce]struct{})
+	}
+	r.seen[id][n] = struct{}{}
+}
+
+// Use records the pair and syncs it to disk before returning, so a crash
+// after encrypting can never forget a used nonce. It returns ErrNonceReuse
+// if the pair is already known, to this process or any other sharing the
+// file.
+func (r *NonceRegistry) Use(id KeyID, n Nonce) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := lockFile(r.file); err != nil {
+		return err
+	}
+	defer unlockFile(r.file)
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	if _, ok := r.seen[id][n]; ok {
+		return ErrNonceReuse
+	}
+
+	entry := fmt.Sprintf("%s %s\n", id, n)
+	if _, err := r.file.WriteString(entry); err != nil {
+		return err
+	}
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+
+	r.offset += int64(len(entry))
+	r.line++
+	r.add(id, n)
+	return nil
+}
+
+func (r *NonceRegistry) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,243 @@
+package sg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func openRegistry(t *testing.T, path string) *NonceRegistry {
+	r, err := OpenNonceRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// TestNonceRegistryShared opens the file twice, as two processes would:
+// each registry must see the pairs the other appended after it was opened.
+func TestNonceRegistryShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	a := openRegistry(t, path)
+	b := openRegistry(t, path)
+
+	id := KeyID{1, 2, 3, 4, 5, 6, 7, 8}
+	n1, n2 := Nonce{15: 1}, Nonce{15: 2}
+
+	if err := a.Use(id, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Use(id, n1); !errors.Is(err, ErrNonceReuse) {
+		t.Fatalf("second registry reused a nonce: %v", err)
+	}
+	if err := b.Use(id, n2); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Use(id, n2); !errors.Is(err, ErrNonceReuse) {
+		t.Fatalf("first registry reused a nonce: %v", err)
+	}
+	if err := a.Use(KeyID{}, n1); err != nil {
+		t.Fatalf("nonce refused under another key: %v", err)
+	}
+
+	c := openRegistry(t, path)
+	for _, n := range []Nonce{n1, n2} {
+		if err := c.Use(id, n); !errors.Is(err, ErrNonceReuse) {
+			t.Errorf("reopened registry reused %s: %v", n, err)
+		}
+	}
+}
+
+// TestNonceRegistryRace has registries on the same file race for one pair;
+// the file lock must let exactly one of them have it.
+func TestNonceRegistryRace(t *testing.T) {
+	const racers = 8
+	path := filepath.Join(t.TempDir(), "nonces")
+
+	regs := make([]*NonceRegistry, racers)
+	for i := range regs {
+		regs[i] = openRegistry(t, path)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		won  int
+		errs []error
+	)
+	for _, r := range regs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := r.Use(KeyID{9}, Nonce{0: 9})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				won++
+			case !errors.Is(err, ErrNonceReuse):
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if won != 1 {
+		t.Fatalf("%d registries got the same nonce, want 1", won)
+	}
+}
+
+// TestNonceRegistryTornTail cuts the last entry short, as a crash in the
+// middle of Use would. The registry must still open, drop the partial
+// entry and keep appending whole ones.
+func TestNonceRegistryTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	id := KeyID{1, 2, 3, 4, 5, 6, 7, 8}
+	n1, n2 := Nonce{15: 1}, Nonce{15: 2}
+
+	r := openRegistry(t, path)
+	if err := r.Use(id, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Use(id, n2); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-5], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r = openRegistry(t, path)
+	if err := r.Use(id, n1); !errors.Is(err, ErrNonceReuse) {
+		t.Errorf("whole entry lost: %v", err)
+	}
+	if err := r.Use(id, n2); err != nil {
+		t.Fatalf("torn entry not dropped: %v", err)
+	}
+
+	r = openRegistry(t, path)
+	if err := r.Use(id, n2); !errors.Is(err, ErrNonceReuse) {
+		t.Errorf("entry after the torn one lost: %v", err)
+	}
+}
+
+func TestNonceRegistryMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	if err := os.WriteFile(path, []byte("0102030405060708 not-a-nonce\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := OpenNonceRegistry(path); err == nil {
+		r.Close()
+		t.Error("malformed entry accepted")
+	}
+}
+
+func TestNonceAdd(t *testing.T) {
+	top := Nonce{0: 0xff, 1: 0xff, 2: 0xff, 3: 0xff, 4: 0xff, 5: 0xff, 6: 0xff, 7: 0xff,
+		8: 0xff, 9: 0xff, 10: 0xff, 11: 0xff, 12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff}
+
+	tests := []struct {
+		n    Nonce
+		k    uint64
+		want Nonce
+	}{
+		{Nonce{}, 0, Nonce{}},
+		{Nonce{}, 1, Nonce{15: 1}},
+		{Nonce{15: 0xff}, 1, Nonce{14: 1}},
+		{Nonce{15: 0xff}, 0x101, Nonce{14: 2}},
+		{Nonce{}, ^uint64(0), Nonce{8: 0xff, 9: 0xff, 10: 0xff, 11: 0xff, 12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff}},
+		{Nonce{8: 0xff, 9: 0xff, 10: 0xff, 11: 0xff, 12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff}, 1, Nonce{7: 1}},
+		{Nonce{15: 1}, ^uint64(0), Nonce{7: 1}},
+		// 2^128 - 1 + 1 wraps around to zero.
+		{top, 1, Nonce{}},
+		{top, 2, Nonce{15: 1}},
+	}
+	for _, tt := range tests {
+		if got := tt.n.Add(tt.k); got != tt.want {
+			t.Errorf("%s + %d = %s, want %s", tt.n, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestNonceCounter(t *testing.T) {
+	base := Nonce{0: 0xaa}
+
+	c := NewNonceCounter(base, 0)
+	for i := range uint64(3) {
+		n, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != base.Add(i) {
+			t.Errorf("nonce %d is %s, want %s", i, n, base.Add(i))
+		}
+	}
+	if c.Position() != 3 {
+		t.Errorf("position %d, want 3", c.Position())
+	}
+
+	c = NewNonceCounter(base, ^uint64(0)-1)
+	if n, err := c.Next(); err != nil || n != base.Add(^uint64(0)-1) {
+		t.Fatalf("last nonce: %s, %v", n, err)
+	}
+	for range 2 {
+		if _, err := c.Next(); !errors.Is(err, ErrNonceExhausted) {
+			t.Errorf("got %v, want %v", err, ErrNonceExhausted)
+		}
+	}
+}
+
+func TestParseNonce(t *testing.T) {
+	good := map[string]Nonce{
+		"000102030405060708090a0b0c0d0e0f": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF": {0: 0xff, 1: 0xff, 2: 0xff, 3: 0xff, 4: 0xff, 5: 0xff, 6: 0xff, 7: 0xff, 8: 0xff, 9: 0xff, 10: 0xff, 11: 0xff, 12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff},
+		"0123456789abcdef":                 {'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'a', 'b', 'c', 'd', 'e', 'f'},
+	}
+	for s, want := range good {
+		n, err := ParseNonce(s)
+		if err != nil || n != want {
+			t.Errorf("ParseNonce(%q) = %s, %v, want %s", s, n, err, want)
+		}
+		if len(s) == 2*NonceSize {
+			if back, _ := ParseNonce(n.String()); back != n {
+				t.Errorf("%s does not parse back", n)
+			}
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"00",
+		"000102030405060708090a0b0c0d0e",
+		"000102030405060708090a0b0c0d0e0f00",
+		"000102030405060708090a0b0c0d0e0g",
+		"0x0102030405060708090a0b0c0d0e0f",
+	} {
+		if _, err := ParseNonce(s); err == nil {
+			t.Errorf("ParseNonce(%q) accepted", s)
+		}
+	}
+}
+
+func TestParseKeyID(t *testing.T) {
+	id := KeyID{1, 2, 3, 4, 5, 6, 7, 0xff}
+	if got, err := ParseKeyID(id.String()); err != nil || got != id {
+		t.Errorf("ParseKeyID(%q) = %s, %v", id.String(), got, err)
+	}
+	for _, s := range []string{"", "01020304050607", "01020304050607ff00", "01020304050607zz"} {
+		if _, err := ParseKeyID(s); err == nil {
+			t.Errorf("ParseKeyID(%q) accepted", s)
+		}
+	}
+}
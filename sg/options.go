@@ -0,0 +1,61 @@
+package sg
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+)
+
+// Option configures a Waver, Cipher or DRBG.
+type Option func(*options)
+
+type options struct {
+	progress             Reporter
+	progressInterval     int64
+	legacyNonce          bool
+	mix                  Mix
+	uncheckedKey         bool
+	entropy              io.Reader
+	reseedInterval       uint64
+	predictionResistance bool
+	noReplace            bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		progressInterval: DefaultProgressInterval,
+		entropy:          rand.Reader,
+		reseedInterval:   DefaultReseedInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithNoReplace makes EncryptFile, DecryptFile and RekeyFile fail with an
+// error wrapping os.ErrExist rather than replace an existing output file.
+// See CreateAtomicNew. RekeyFile ignores it when the output replaces the
+// input.
+func WithNoReplace() Option {
+	return func(o *options) {
+		o.noReplace = true
+	}
+}
+
+// createOutput creates the output file of a file operation under o.
+func (o options) createOutput(path string, perm os.FileMode) (*AtomicFile, error) {
+	if o.noReplace {
+		return CreateAtomicNew(path, perm)
+	}
+	return CreateAtomic(path, perm)
+}
+
+// WithLegacyNonceSchedule reproduces the nonce schedule of releases that
+// took nonces as 16-character strings, to process data written by them.
+// Headerless files are decrypted with it automatically.
+func WithLegacyNonceSchedule() Option {
+	return func(o *options) {
+		o.legacyNonce = true
+	}
+}
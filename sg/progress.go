@@ -0,0 +1,93 @@
+package sg
+
+import "io"
+
+// DefaultProgressInterval is how many bytes pass between two progress
+// reports unless WithProgressInterval says otherwise.
+const DefaultProgressInterval = 256 * 1024
+
+// Reporter receives progress of long operations. total is -1 when the size
+// is not known in advance. Report is called from the goroutine doing the
+// work and should return quickly.
+type Reporter interface {
+	Report(done, total int64)
+}
+
+// ProgressFunc adapts a plain function to Reporter.
+type ProgressFunc func(done, total int64)
+
+func (f ProgressFunc) Report(done, total int64) {
+	f(done, total)
+}
+
+// WithProgress sets the Reporter used by file and stream operations. A nil
+// Reporter disables reporting, which is also the default.
+func WithProgress(r Reporter) Option {
+	return func(o *options) {
+		o.progress = r
+	}
+}
+
+// WithProgressInterval throttles reports to one per n processed bytes.
+func WithProgressInterval(n int64) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.progressInterval = n
+		}
+	}
+}
+
+// progressCounter counts bytes written to it and forwards them to a Reporter
+// at most once per interval. A nil *progressCounter is valid and does
+// nothing, so callers need not check whether reporting is enabled.
+type progressCounter struct {
+	r        Reporter
+	interval int64
+	total    int64
+	done     int64
+	last     int64
+}
+
+func (o *options) newProgress(total int64) *progressCounter {
+	if o.progress == nil {
+		return nil
+	}
+
+	p := &progressCounter{r: o.progress, interval: o.progressInterval, total: total}
+	p.r.Report(0, total)
+	return p
+}
+
+func (p *progressCounter) Write(b []byte) (int, error) {
+	p.add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *progressCounter) add(n int64) {
+	if p == nil {
+		return
+	}
+
+	p.done += n
+	if p.done-p.last >= p.interval {
+		p.last = p.done
+		p.r.Report(p.done, p.total)
+	}
+}
+
+func (p *progressCounter) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return io.TeeReader(r, p)
+}
+
+// finish sends the last report if the final bytes fell short of an interval.
+func (p *progressCounter) finish() {
+	if p == nil || p.last == p.done {
+		return
+	}
+
+	p.last = p.done
+	p.r.Report(p.done, p.total)
+}
@@ -0,0 +1,69 @@
+package sg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkReports checks that reports start at zero, grow strictly, carry
+// the same total throughout and end at it.
+func checkReports(t *testing.T, name string, reports [][2]int64, total int64) {
+	t.Helper()
+	if len(reports) < 3 {
+		t.Fatalf("%s: %d reports, want several", name, len(reports))
+	}
+	if reports[0][0] != 0 {
+		t.Errorf("%s: first report at %d, want 0", name, reports[0][0])
+	}
+	for i, r := range reports {
+		if r[1] != total {
+			t.Errorf("%s: report %d has total %d, want %d", name, i, r[1], total)
+		}
+		if i > 0 && r[0] <= reports[i-1][0] {
+			t.Errorf("%s: report %d goes from %d to %d", name, i, reports[i-1][0], r[0])
+		}
+	}
+	if last := reports[len(reports)-1][0]; last != total {
+		t.Errorf("%s: last report at %d, want %d", name, last, total)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	key := KeyFromString("StarGate progress check key")
+	defer key.Destroy()
+
+	dir := t.TempDir()
+	plain, sealed, opened := filepath.Join(dir, "plain"), filepath.Join(dir, "sealed"), filepath.Join(dir, "opened")
+	// Not a multiple of the interval, so the last report comes from finish.
+	data := make([]byte, 100_000+123)
+	if err := os.WriteFile(plain, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports [][2]int64
+	record := WithProgress(ProgressFunc(func(done, total int64) {
+		reports = append(reports, [2]int64{done, total})
+	}))
+
+	c, err := NewCipher(key, Nonce{}, false, record, WithProgressInterval(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.EncryptFile(plain, sealed); err != nil {
+		t.Fatal(err)
+	}
+	checkReports(t, "encrypt", reports, int64(len(data)))
+
+	info, err := os.Stat(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports = nil
+	if err := c.DecryptFile(sealed, opened); err != nil {
+		t.Fatal(err)
+	}
+	checkReports(t, "decrypt", reports, info.Size())
+}
@@ -0,0 +1,203 @@
+package sg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrUncheckedKey is returned by Rekey for input whose old key cannot be
+// checked, unless WithUncheckedKey allows it.
+var ErrUncheckedKey = errors.New("the old key cannot be checked, the input has no key commitment")
+
+// WithUncheckedKey lets Rekey re-encrypt input whose old key cannot be
+// checked: legacy headerless files and containers without a key
+// commitment. A wrong old key then turns the output into garbage without
+// any error, so keep the input until the output is known to decrypt.
+// RekeyFile ignores it when the output would replace the input.
+func WithUncheckedKey() Option {
+	return func(o *options) {
+		o.uncheckedKey = true
+	}
+}
+
+// Rekey re-encrypts the container read from r under newKey and nonce and
+// writes it to w. Ciphertext is decrypted and encrypted again in one pass,
+// so plaintext only ever exists in a small buffer in memory. Kind and
+// compression are kept: archives stay archives and compressed payloads are
+// not recompressed. The mix is not kept: the output gets the
+// mix of opts, MixStarGate unless WithMix says otherwise.
+//
+// The old key is chosen among oldKeys by the key ID in the header, checked
+// against the key commitment and returned. Input without a commitment,
+// including legacy headerless input, is refused with ErrUncheckedKey
+// unless WithUncheckedKey is given; legacy input also needs oldKeys to
+// hold a single key, and is written out as a container.
+//
+// Containers have no recipient stanzas, keys wrapped for several
+// recipients, so there is no cheaper rekey that only rewrites the header:
+// the payload is always re-encrypted.
+func Rekey(r io.Reader, w io.Writer, oldKeys []*Key, newKey *Key, nonce Nonce, opts ...Option) (*Key, error) {
+	return rekey(r, w, oldKeys, newKey, nonce, newOptions(opts))
+}
+
+func rekey(r io.Reader, w io.Writer, oldKeys []*Key, newKey *Key, nonce Nonce, o options) (*Key, error) {
+	if len(oldKeys) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	br := bufio.NewReader(r)
+
+	old := &Header{Kind: KindFile}
+	oldKey := oldKeys[0]
+	legacy := false
+
+	var oldRaw bytes.Buffer
+	if magic, _ := br.Peek(len(ContainerMagic)); IsContainer(magic) {
+		h, err := ReadHeader(io.TeeReader(br, &oldRaw))
+		if err != nil {
+			return nil, err
+		}
+		switch h.Kind {
+		case KindLog:
+			return nil, errors.New("encrypted logs cannot be rekeyed, their records are sealed one by one")
+		case KindKV:
+			return nil, errors.New("key-value stores cannot be rekeyed here, compact them to a new key instead")
+		}
+		if oldKey, err = h.SelectKey(oldKeys); err != nil {
+			return nil, err
+		}
+		old = h
+	} else {
+		if len(oldKeys) > 1 {
+			return nil, errors.New("legacy input has no key ID, give a single old key")
+		}
+		if _, err := io.ReadFull(br, old.Nonce[:]); err != nil {
+			return nil, errors.New("input is too short to contain a nonce")
+		}
+		old.Mix = MixXXH3
+		legacy = true
+	}
+
+	if old.Commitment == nil && !o.uncheckedKey {
+		return nil, ErrUncheckedKey
+	}
+
+	if oldKey.ID() == newKey.ID() && old.Nonce == nonce {
+		return nil, errors.New("new key and nonce are the same as the old ones")
+	}
+
+	h := &Header{Kind: old.Kind, Nonce: nonce, Compression: old.Compression, Mix: o.mix}
+	h.commit(newKey)
+	raw, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+
+	var src io.Reader
+	if old.Kind == KindArchive {
+		dec, err := NewAEAD(oldKey, WithMix(old.Mix))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		src = newChunkReader(br, dec, old.Nonce, oldRaw.Bytes())
+	} else {
+		oldOpts := o
+		oldOpts.legacyNonce = legacy
+		oldOpts.mix = old.Mix
+
+		dec, err := newWaver(oldKey, old.Nonce, false, oldOpts)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		src = cipher.StreamReader{S: waverStream{dec}, R: br}
+	}
+
+	if h.Kind == KindArchive {
+		enc, err := NewAEAD(newKey, WithMix(o.mix))
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+
+		cw := newChunkWriter(w, enc, nonce, raw)
+		if _, err := io.Copy(cw, src); err != nil {
+			return nil, err
+		}
+		if err := cw.Close(); err != nil {
+			return nil, err
+		}
+		return oldKey, nil
+	}
+
+	enc, err := newWaver(newKey, nonce, false, o)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+
+	sw := cipher.StreamWriter{S: waverStream{enc}, W: w}
+	if _, err := io.Copy(sw, src); err != nil {
+		return nil, err
+	}
+
+	return oldKey, nil
+}
+
+// RekeyFile rekeys the container at filepath into newFilePath, which may be
+// the same path. The output replaces newFilePath atomically and keeps the
+// input's permissions. Input whose old key cannot be checked is never
+// rekeyed in place, even with WithUncheckedKey: a wrong key would destroy
+// the only copy.
+func RekeyFile(filepath, newFilePath string, oldKeys []*Key, newKey *Key, nonce Nonce, opts ...Option) (*Key, error) {
+	in, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	if SameFile(filepath, newFilePath) {
+		o.uncheckedKey = false
+		o.noReplace = false
+	}
+	progress := o.newProgress(info.Size())
+
+	file, err := o.createOutput(newFilePath, info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Abort()
+
+	oldKey, err := rekey(progress.reader(in), file, oldKeys, newKey, nonce, o)
+	if err != nil {
+		return nil, err
+	}
+	progress.finish()
+
+	return oldKey, file.Commit()
+}
+
+// waverStream lets a bare Waver act as a cipher.Stream.
+type waverStream struct {
+	w *Waver
+}
+
+func (s waverStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		dst[i] = src[i] ^ s.w.GetNext()
+	}
+}
@@ -0,0 +1,181 @@
+package sg
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encryptTestFile(t *testing.T, dir string, key *Key, plain []byte) string {
+	t.Helper()
+	in := filepath.Join(dir, "plain")
+	if err := os.WriteFile(in, plain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(key, Nonce{15: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	out := filepath.Join(dir, "file.sg")
+	if err := c.EncryptFile(in, out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func createTestArchive(t *testing.T, dir string, key *Key) string {
+	t.Helper()
+	src := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// Larger than a chunk, so the rekeyed archive has several.
+	big := bytes.Repeat([]byte("StarGate rekey "), 10000)
+	if err := os.WriteFile(filepath.Join(src, "sub", "big"), big, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(key, Nonce{15: 2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	out := filepath.Join(dir, "tree.sga")
+	f, err := CreateAtomic(out, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Abort()
+	if err := c.CreateArchive(src, f, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// onlyFiles fails the test if dir holds anything but names.
+func onlyFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if len(got) != len(names) {
+		t.Fatalf("%s holds %v, want %v", dir, got, names)
+	}
+	for i := range names {
+		if got[i] != names[i] {
+			t.Fatalf("%s holds %v, want %v", dir, got, names)
+		}
+	}
+}
+
+func TestRekeyFile(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := KeyFromString("old key"), KeyFromString("new key")
+	plain := bytes.Repeat([]byte("rekeyed file "), 1000)
+	path := encryptTestFile(t, dir, oldKey, plain)
+
+	rekeyed := filepath.Join(dir, "rekeyed.sg")
+	other := KeyFromString("other key")
+	used, err := RekeyFile(path, rekeyed, []*Key{other, oldKey}, newKey, Nonce{15: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != oldKey {
+		t.Error("Rekey returned the wrong old key")
+	}
+
+	if _, err := DecryptFileWithKeys(rekeyed, filepath.Join(dir, "old"), []*Key{oldKey}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("old key on rekeyed file: got %v, want %v", err, ErrWrongKey)
+	}
+	out := filepath.Join(dir, "out")
+	if _, err := DecryptFileWithKeys(rekeyed, out, []*Key{newKey}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, plain) {
+		t.Error("rekeyed file decrypts to other data")
+	}
+}
+
+func TestRekeyArchive(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := KeyFromString("old key"), KeyFromString("new key")
+	path := createTestArchive(t, dir, oldKey)
+
+	// In place, as stargate rekey does for a directory of containers.
+	if _, err := RekeyFile(path, path, []*Key{oldKey}, newKey, Nonce{15: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCipher(newKey, Nonce{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	dest := filepath.Join(dir, "restore")
+	if err := c.ExtractArchive(in, dest, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(filepath.Join(dir, "tree", "sub", "big"))
+	if got, _ := os.ReadFile(filepath.Join(dest, "sub", "big")); !bytes.Equal(got, want) {
+		t.Error("rekeyed archive extracts to other data")
+	}
+}
+
+// TestRekeyWrongKey checks that a wrong old key is refused before
+// anything is written.
+func TestRekeyWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	path := encryptTestFile(t, dir, KeyFromString("old key"), []byte("data"))
+
+	out := filepath.Join(dir, "rekeyed.sg")
+	_, err := RekeyFile(path, out, []*Key{KeyFromString("wrong key")}, KeyFromString("new key"), Nonce{15: 3})
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("got %v, want %v", err, ErrWrongKey)
+	}
+	onlyFiles(t, dir, "file.sg", "plain")
+}
+
+// TestRekeyInterrupted rekeys a truncated archive in place. The rekey
+// must fail on the missing chunk and leave the input as it was, with no
+// temporary file behind.
+func TestRekeyInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := KeyFromString("old key")
+	path := createTestArchive(t, dir, oldKey)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut := data[:len(data)-100]
+	if err := os.WriteFile(path, cut, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RekeyFile(path, path, []*Key{oldKey}, KeyFromString("new key"), Nonce{15: 4}); !errors.Is(err, ErrArchiveCorrupt) {
+		t.Errorf("got %v, want %v", err, ErrArchiveCorrupt)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, cut) {
+		t.Error("input changed")
+	}
+	onlyFiles(t, dir, "tree", "tree.sga")
+}
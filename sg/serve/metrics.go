@@ -0,0 +1,56 @@
+package serve
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+type metrics struct {
+	requests    map[string]*atomic.Uint64
+	bytes       atomic.Uint64
+	rateLimited atomic.Uint64
+	errors      atomic.Uint64
+	streams     atomic.Int64
+}
+
+func newMetrics() *metrics {
+	m := &metrics{requests: make(map[string]*atomic.Uint64)}
+	for _, path := range []string{"/bytes", "/uint64", "/uuid", "/stream"} {
+		m.requests[path] = new(atomic.Uint64)
+	}
+	return m
+}
+
+func (m *metrics) request(path string) {
+	m.requests[path].Add(1)
+}
+
+// write prints the metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer, reseedCounter uint64) {
+	paths := make([]string, 0, len(m.requests))
+	for path := range m.requests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintln(w, "# HELP stargate_requests_total Requests received, by endpoint.")
+	fmt.Fprintln(w, "# TYPE stargate_requests_total counter")
+	for _, path := range paths {
+		fmt.Fprintf(w, "stargate_requests_total{endpoint=%q} %d\n", path, m.requests[path].Load())
+	}
+
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	gauge := func(name, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+	}
+
+	counter("stargate_bytes_total", "Random bytes served.", m.bytes.Load())
+	counter("stargate_rate_limited_total", "Requests refused by the rate limiter.", m.rateLimited.Load())
+	counter("stargate_errors_total", "Requests that failed.", m.errors.Load())
+	gauge("stargate_streams_active", "Open /stream responses.", m.streams.Load())
+	gauge("stargate_drbg_reseed_counter", "DRBG requests since the last reseed, plus one.", int64(reseedCounter))
+}
@@ -0,0 +1,312 @@
+// Package serve hands out StarGate DRBG output over HTTP:
+//
+//	GET /bytes?n=32&format=raw|hex|base64   n random bytes
+//	GET /uint64                             a random uint64 in decimal
+//	GET /uuid                               a random version 4 UUID
+//	GET /stream?n=                          a chunked stream of n bytes, or
+//	                                        until the client hangs up
+//	GET /metrics                            counters in Prometheus text format
+//
+// Every endpoint but /metrics is rate limited per client address.
+package serve
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"stargate/sg"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxBytes is the largest /bytes request unless Config says
+	// otherwise.
+	DefaultMaxBytes = 1 << 20
+	// DefaultShutdownTimeout is how long Run waits for requests in flight.
+	DefaultShutdownTimeout = 10 * time.Second
+
+	streamChunk = 16 << 10
+)
+
+type Config struct {
+	// DRBG is the source of every byte served.
+	DRBG *sg.DRBG
+	// Rate is the number of requests per second allowed per client
+	// address, with bursts of up to Burst. Zero disables rate limiting.
+	Rate  float64
+	Burst int
+	// MaxBytes limits n of /bytes. Zero means DefaultMaxBytes.
+	MaxBytes int
+	// MaxStream limits n of /stream. Zero means no limit, and a stream
+	// without n runs until the client hangs up.
+	MaxStream int64
+	// ShutdownTimeout bounds the graceful shutdown in Run. Zero means
+	// DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+}
+
+// Server is an http.Handler serving the endpoints above.
+type Server struct {
+	config  Config
+	mux     *http.ServeMux
+	limiter *limiter
+	metrics *metrics
+
+	// quit is closed by Run on shutdown to end open streams.
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func New(config Config) (*Server, error) {
+	if config.DRBG == nil {
+		return nil, errors.New("serve: config has no DRBG")
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultMaxBytes
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	s := &Server{
+		config:  config,
+		mux:     http.NewServeMux(),
+		metrics: newMetrics(),
+		quit:    make(chan struct{}),
+	}
+	if config.Rate > 0 {
+		s.limiter = newLimiter(config.Rate, config.Burst)
+	}
+
+	s.handle("/bytes", s.serveBytes)
+	s.handle("/uint64", s.serveUint64)
+	s.handle("/uuid", s.serveUUID)
+	s.handle("/stream", s.serveStream)
+	s.mux.HandleFunc("GET /metrics", s.serveMetrics)
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle registers a rate-limited, counted GET endpoint.
+func (s *Server) handle(path string, h func(http.ResponseWriter, *http.Request) error) {
+	s.mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		s.metrics.request(path)
+
+		if s.limiter != nil {
+			if ok, wait := s.limiter.allow(clientAddr(r)); !ok {
+				s.metrics.rateLimited.Add(1)
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		if err := h(w, r); err != nil {
+			s.metrics.errors.Add(1)
+			var bad badRequest
+			if errors.As(err, &bad) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, "generator failure", http.StatusInternalServerError)
+			}
+		}
+	})
+}
+
+type badRequest struct{ error }
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// queryInt parses the query parameter name, def if absent, and checks it
+// lies in [1, max]; max <= 0 means no upper bound.
+func queryInt(r *http.Request, name string, def, max int64) (int64, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 || (max > 0 && n > max) {
+		if max > 0 {
+			return 0, badRequest{fmt.Errorf("%s must be between 1 and %d", name, max)}
+		}
+		return 0, badRequest{fmt.Errorf("%s must be a positive integer", name)}
+	}
+	return n, nil
+}
+
+func (s *Server) read(p []byte) error {
+	if _, err := s.config.DRBG.Read(p); err != nil {
+		return err
+	}
+	s.metrics.bytes.Add(uint64(len(p)))
+	return nil
+}
+
+func (s *Server) serveBytes(w http.ResponseWriter, r *http.Request) error {
+	n, err := queryInt(r, "n", 32, int64(s.config.MaxBytes))
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, n)
+	if err := s.read(b); err != nil {
+		return err
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "raw":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(b)
+	case "hex":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, hex.EncodeToString(b))
+	case "base64":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, base64.StdEncoding.EncodeToString(b))
+	default:
+		return badRequest{fmt.Errorf("unknown format %q, want raw, hex or base64", format)}
+	}
+	return nil
+}
+
+func (s *Server) serveUint64(w http.ResponseWriter, r *http.Request) error {
+	var b [8]byte
+	if err := s.read(b[:]); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, binary.BigEndian.Uint64(b[:]))
+	return nil
+}
+
+func (s *Server) serveUUID(w http.ResponseWriter, r *http.Request) error {
+	var u [16]byte
+	if err := s.read(u[:]); err != nil {
+		return err
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%x-%x-%x-%x-%x\n", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+	return nil
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) error {
+	n, err := queryInt(r, "n", s.config.MaxStream, s.config.MaxStream)
+	if err != nil {
+		return err
+	}
+
+	s.metrics.streams.Add(1)
+	defer s.metrics.streams.Add(-1)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	flusher, _ := w.(http.Flusher)
+
+	buf := make([]byte, streamChunk)
+	for sent := int64(0); n == 0 || sent < n; {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-s.quit:
+			return nil
+		default:
+		}
+
+		chunk := buf
+		if n > 0 {
+			chunk = buf[:min(int64(len(buf)), n-sent)]
+		}
+		if err := s.read(chunk); err != nil {
+			if sent == 0 {
+				return err
+			}
+			// The status line is gone already; cut the stream short.
+			panic(http.ErrAbortHandler)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return nil
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		sent += int64(len(chunk))
+	}
+	return nil
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w, s.config.DRBG.ReseedCounter())
+}
+
+// Run serves on l until ctx is done, then shuts down gracefully: it stops
+// accepting, ends open streams and waits up to ShutdownTimeout for the
+// other requests. It returns nil after a clean shutdown.
+func (s *Server) Run(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.quitOnce.Do(func() { close(s.quit) })
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NewDRBG instantiates a DRBG for a Server. With a nil key it is seeded
+// from crypto/rand. With a key, its entropy input is the StarGate
+// keystream of key and nonce instead, so a fresh server answers the same
+// sequence of requests with the same bytes. Concurrent requests are
+// served in whatever order they arrive, so only a sequential client sees
+// a reproducible sequence.
+func NewDRBG(key *sg.Key, nonce sg.Nonce) (*sg.DRBG, error) {
+	if key == nil {
+		return sg.Instantiate([]byte("StarGate serve"))
+	}
+
+	w, err := sg.NewWaver(key, nonce, false)
+	if err != nil {
+		return nil, err
+	}
+	return sg.Instantiate([]byte("StarGate serve deterministic"), sg.WithEntropySource(w))
+}
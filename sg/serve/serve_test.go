@@ -0,0 +1,176 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"stargate/sg"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func deterministicServer(t *testing.T, config Config) *Server {
+	key := sg.KeyFromString("StarGate serve test key")
+	defer key.Destroy()
+
+	drbg, err := NewDRBG(key, sg.Nonce{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DRBG = drbg
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func getOK(t *testing.T, url string) []byte {
+	t.Helper()
+	status, body := get(t, url)
+	if status != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", url, status, bytes.TrimSpace(body))
+	}
+	return body
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\n$`)
+
+// TestEndpoints checks that deterministic servers agree, that answers are
+// well-formed and bad requests refused, and that the metrics count it all.
+func TestEndpoints(t *testing.T) {
+	var servers [2]*httptest.Server
+	for i := range servers {
+		servers[i] = httptest.NewServer(deterministicServer(t, Config{MaxStream: 1 << 20}))
+		defer servers[i].Close()
+	}
+
+	// The same requests in the same order get the same answers.
+	requests := []string{"/bytes?n=100", "/bytes?n=16&format=hex", "/uint64", "/uuid", "/stream?n=40000"}
+	for _, req := range requests {
+		a := getOK(t, servers[0].URL+req)
+		b := getOK(t, servers[1].URL+req)
+		if !bytes.Equal(a, b) {
+			t.Errorf("GET %s: deterministic servers disagree", req)
+		}
+	}
+
+	url := servers[0].URL
+	if b := getOK(t, url+"/bytes?n=1000"); len(b) != 1000 {
+		t.Errorf("/bytes?n=1000 returned %d bytes", len(b))
+	}
+	if b := getOK(t, url+"/stream?n=100000"); len(b) != 100000 {
+		t.Errorf("/stream?n=100000 returned %d bytes", len(b))
+	}
+	b := getOK(t, url+"/uint64")
+	if _, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+		t.Errorf("/uint64: %v", err)
+	}
+	if b := getOK(t, url+"/uuid"); !uuidPattern.Match(b) {
+		t.Errorf("/uuid returned %q", b)
+	}
+
+	for _, req := range []string{"/bytes?n=0", "/bytes?n=x", "/bytes?format=rot13", "/stream?n=2000000"} {
+		if status, _ := get(t, url+req); status != http.StatusBadRequest {
+			t.Errorf("GET %s: got %d, want %d", req, status, http.StatusBadRequest)
+		}
+	}
+
+	metrics := getOK(t, url+"/metrics")
+	for _, want := range []string{
+		`stargate_requests_total{endpoint="/bytes"} 6`,
+		`stargate_requests_total{endpoint="/stream"} 3`,
+		`stargate_errors_total 4`,
+		`stargate_streams_active 0`,
+	} {
+		if !bytes.Contains(metrics, []byte(want+"\n")) {
+			t.Errorf("metrics lack %q:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(deterministicServer(t, Config{Rate: 0.001, Burst: 3}))
+	defer ts.Close()
+
+	for i := range 5 {
+		status, _ := get(t, ts.URL+"/uint64")
+		want := http.StatusOK
+		if i >= 3 {
+			want = http.StatusTooManyRequests
+		}
+		if status != want {
+			t.Errorf("request %d: got %d, want %d", i+1, status, want)
+		}
+	}
+
+	// Metrics are not limited.
+	metrics := getOK(t, ts.URL+"/metrics")
+	if !bytes.Contains(metrics, []byte("stargate_rate_limited_total 2\n")) {
+		t.Errorf("metrics do not count refused requests:\n%s", metrics)
+	}
+}
+
+// TestShutdown opens an endless stream and cancels Run while it is read.
+func TestShutdown(t *testing.T) {
+	s := deterministicServer(t, Config{ShutdownTimeout: 5 * time.Second})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx, l)
+	}()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadFull(resp.Body, make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+
+	// The stream ends cleanly rather than running on.
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatalf("stream after shutdown: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package shamir
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Armored shares are plain text, so they can be printed, mailed or stored
+// in a password manager:
+//
+//	-----BEGIN STARGATE KEY SHARE-----
+//	Share: 2/5
+//	Threshold: 3
+//	Key-ID: 00816c74f48d18a8
+//	Split-ID: 5b0e4c3f9d0a7e21
+//	Checksum: 1f3a9c07
+//
+//	<base64 share value, 64 columns>
+//	-----END STARGATE KEY SHARE-----
+//
+// The checksum covers the headers and the value, so a mistyped or damaged
+// share is caught before it silently yields a wrong key.
+const (
+	armorBegin = "-----BEGIN STARGATE KEY SHARE-----"
+	armorEnd   = "-----END STARGATE KEY SHARE-----"
+	armorWidth = 64
+)
+
+var ErrChecksum = errors.New("share checksum mismatch, the share is corrupt")
+
+func (s Share) checksum() [4]byte {
+	h := sha256.New()
+	h.Write([]byte("StarGate key share\x00"))
+	h.Write([]byte{s.Index, s.Count, s.Threshold})
+	h.Write(s.KeyID[:])
+	h.Write(s.SplitID[:])
+	h.Write(s.Value)
+
+	var c [4]byte
+	copy(c[:], h.Sum(nil))
+	return c
+}
+
+// MarshalText returns the armored share.
+func (s Share) MarshalText() ([]byte, error) {
+	var b bytes.Buffer
+	sum := s.checksum()
+
+	fmt.Fprintln(&b, armorBegin)
+	fmt.Fprintf(&b, "Share: %d/%d\n", s.Index, s.Count)
+	fmt.Fprintf(&b, "Threshold: %d\n", s.Threshold)
+	fmt.Fprintf(&b, "Key-ID: %s\n", s.KeyID)
+	fmt.Fprintf(&b, "Split-ID: %x\n", s.SplitID)
+	fmt.Fprintf(&b, "Checksum: %x\n\n", sum)
+
+	body := base64.StdEncoding.EncodeToString(s.Value)
+	for len(body) > armorWidth {
+		fmt.Fprintln(&b, body[:armorWidth])
+		body = body[armorWidth:]
+	}
+	fmt.Fprintln(&b, body)
+	fmt.Fprintln(&b, armorEnd)
+
+	return b.Bytes(), nil
+}
+
+// ParseShares reads every armored share in r. Text outside the armor is
+// ignored, so shares may be concatenated or pasted with surrounding notes.
+func ParseShares(r io.Reader) ([]Share, error) {
+	var shares []Share
+	var block []string
+	inside := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+
+		switch {
+		case line == armorBegin:
+			inside = true
+			block = block[:0]
+		case line == armorEnd && inside:
+			s, err := parseBlock(block)
+			if err != nil {
+				return nil, fmt.Errorf("share %d: %w", len(shares)+1, err)
+			}
+			shares = append(shares, s)
+			inside = false
+		case inside:
+			block = append(block, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if inside {
+		return nil, errors.New("truncated share, missing end line")
+	}
+	if len(shares) == 0 {
+		return nil, errors.New("no key shares found")
+	}
+
+	return shares, nil
+}
+
+func parseBlock(lines []string) (Share, error) {
+	var s Share
+	var sum []byte
+	var body strings.Builder
+
+	headers := true
+	for _, line := range lines {
+		if headers {
+			if line == "" {
+				headers = false
+				continue
+			}
+
+			name, val, ok := strings.Cut(line, ":")
+			if !ok {
+				return s, fmt.Errorf("malformed share header %q", line)
+			}
+			val = strings.TrimSpace(val)
+
+			var err error
+			switch name {
+			case "Share":
+				idx, count, _ := strings.Cut(val, "/")
+				if s.Index, err = parseByte(idx); err == nil {
+					s.Count, err = parseByte(count)
+				}
+			case "Threshold":
+				s.Threshold, err = parseByte(val)
+			case "Key-ID":
+				err = decodeHex(s.KeyID[:], val)
+			case "Split-ID":
+				err = decodeHex(s.SplitID[:], val)
+			case "Checksum":
+				sum, err = hex.DecodeString(val)
+			}
+			if err != nil {
+				return s, fmt.Errorf("malformed share header %q: %w", line, err)
+			}
+			continue
+		}
+
+		body.WriteString(line)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return s, fmt.Errorf("malformed share value: %w", err)
+	}
+	s.Value = value
+
+	if s.Index == 0 || s.Threshold < 2 || len(s.Value) == 0 {
+		return s, errors.New("incomplete share")
+	}
+
+	want := s.checksum()
+	if !bytes.Equal(sum, want[:]) {
+		return s, ErrChecksum
+	}
+
+	return s, nil
+}
+
+func parseByte(s string) (byte, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	return byte(v), err
+}
+
+func decodeHex(dst []byte, s string) error {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return fmt.Errorf("want %d hex digits", 2*len(dst))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
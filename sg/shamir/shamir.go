@@ -0,0 +1,171 @@
+// Package shamir splits StarGate keys into shares with Shamir's secret
+// sharing over GF(256), so that any threshold of them restores the key and
+// fewer reveal nothing about it.
+//
+// Every byte of the key is the constant term of its own random polynomial
+// of degree threshold-1; share i holds the polynomials evaluated at x = i.
+// Field arithmetic uses the AES polynomial x^8 + x^4 + x^3 + x + 1 and is
+// done without tables or branches on secret data.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"stargate/sg"
+)
+
+const MaxShares = 255
+
+var (
+	ErrMismatch      = errors.New("shares belong to different splits")
+	ErrTooFewShares  = errors.New("not enough shares to reach the threshold")
+	ErrDuplicate     = errors.New("duplicate share index")
+	ErrWrongResult   = errors.New("restored key does not match the key ID in the shares")
+	ErrBadParameters = errors.New("threshold must be at least 2 and at most the number of shares")
+)
+
+// Share is one piece of a split key. SplitID is random per split and keeps
+// shares of different splits of the same key from being mixed.
+type Share struct {
+	Index     byte
+	Count     byte
+	Threshold byte
+	KeyID     sg.KeyID
+	SplitID   [8]byte
+	Value     []byte
+}
+
+// Split cuts key into n shares, any t of which restore it.
+func Split(key *sg.Key, n, t int) ([]Share, error) {
+	if key == nil || key.Len() == 0 {
+		return nil, sg.ErrEmptyKey
+	}
+	if n > MaxShares || t < 2 || t > n {
+		return nil, ErrBadParameters
+	}
+
+	var splitID [8]byte
+	if _, err := rand.Read(splitID[:]); err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{
+			Index:     byte(i + 1),
+			Count:     byte(n),
+			Threshold: byte(t),
+			KeyID:     key.ID(),
+			SplitID:   splitID,
+			Value:     make([]byte, key.Len()),
+		}
+	}
+
+	coeffs := make([]byte, t)
+	defer clear(coeffs)
+
+	for pos, secret := range key.Bytes() {
+		coeffs[0] = secret
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+
+		for i := range shares {
+			shares[i].Value[pos] = evaluate(coeffs, shares[i].Index)
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine restores the key from at least Threshold shares of one split.
+// The result is checked against the key ID the shares carry.
+func Combine(shares []Share) (*sg.Key, error) {
+	if len(shares) == 0 {
+		return nil, ErrTooFewShares
+	}
+
+	first := shares[0]
+	seen := make(map[byte]bool)
+
+	for _, s := range shares {
+		if s.SplitID != first.SplitID || s.KeyID != first.KeyID ||
+			s.Threshold != first.Threshold || len(s.Value) != len(first.Value) {
+			return nil, ErrMismatch
+		}
+		if s.Index == 0 || seen[s.Index] {
+			return nil, fmt.Errorf("%w %d", ErrDuplicate, s.Index)
+		}
+		seen[s.Index] = true
+	}
+
+	if len(shares) < int(first.Threshold) {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrTooFewShares, len(shares), first.Threshold)
+	}
+	shares = shares[:first.Threshold]
+
+	// Lagrange basis polynomials evaluated at x = 0.
+	basis := make([]byte, len(shares))
+	for i, si := range shares {
+		num, den := byte(1), byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			num = mul(num, sj.Index)
+			den = mul(den, sj.Index^si.Index)
+		}
+		basis[i] = mul(num, inv(den))
+	}
+
+	secret := make([]byte, len(first.Value))
+	defer clear(secret)
+
+	for pos := range secret {
+		var b byte
+		for i, s := range shares {
+			b ^= mul(s.Value[pos], basis[i])
+		}
+		secret[pos] = b
+	}
+
+	key := sg.NewKey(secret)
+	if key.ID() != first.KeyID {
+		key.Destroy()
+		return nil, ErrWrongResult
+	}
+
+	return key, nil
+}
+
+// evaluate computes the polynomial with coefficients c (constant first) at x
+// with Horner's rule.
+func evaluate(c []byte, x byte) byte {
+	var y byte
+	for i := len(c) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ c[i]
+	}
+	return y
+}
+
+// mul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x + 1.
+func mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ -(a>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+// inv returns a^254, the multiplicative inverse of a != 0.
+func inv(a byte) byte {
+	r := a
+	for range 6 {
+		a = mul(a, a)
+		r = mul(r, a)
+	}
+	return mul(r, r)
+}
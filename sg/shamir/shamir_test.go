@@ -0,0 +1,131 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+	"reflect"
+	"stargate/sg"
+	"strings"
+	"testing"
+)
+
+func testKey() *sg.Key {
+	return sg.KeyFromString("StarGate shamir test key, long enough to span a few bytes")
+}
+
+func split(t *testing.T, key *sg.Key, n, th int) []Share {
+	t.Helper()
+	shares, err := Split(key, n, th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shares
+}
+
+func TestInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if p := mul(byte(a), inv(byte(a))); p != 1 {
+			t.Fatalf("%#02x * inv = %#02x", a, p)
+		}
+	}
+}
+
+// TestSubsets combines every subset of the shares of a 3-of-5 split: all
+// with at least 3 shares restore the key, all others are too few.
+func TestSubsets(t *testing.T) {
+	const n, th = 5, 3
+	key := testKey()
+	shares := split(t, key, n, th)
+
+	for set := 1; set < 1<<n; set++ {
+		var subset []Share
+		for i := range shares {
+			if set&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+
+		got, err := Combine(subset)
+		if bits.OnesCount(uint(set)) < th {
+			if !errors.Is(err, ErrTooFewShares) {
+				t.Errorf("shares %05b: got %v, want %v", set, err, ErrTooFewShares)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("shares %05b: %v", set, err)
+			continue
+		}
+		if !bytes.Equal(got.Bytes(), key.Bytes()) {
+			t.Errorf("shares %05b: wrong key", set)
+		}
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	key := testKey()
+	a := split(t, key, 3, 2)
+	b := split(t, key, 3, 2)
+
+	if _, err := Combine([]Share{a[0], b[1]}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("two splits: got %v, want %v", err, ErrMismatch)
+	}
+	if _, err := Combine([]Share{a[0], a[0]}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("same share twice: got %v, want %v", err, ErrDuplicate)
+	}
+	if _, err := Combine(nil); !errors.Is(err, ErrTooFewShares) {
+		t.Errorf("no shares: got %v, want %v", err, ErrTooFewShares)
+	}
+
+	changed := a[1]
+	changed.Value = bytes.Clone(changed.Value)
+	changed.Value[0] ^= 1
+	if _, err := Combine([]Share{a[0], changed}); !errors.Is(err, ErrWrongResult) {
+		t.Errorf("changed value: got %v, want %v", err, ErrWrongResult)
+	}
+
+	for _, p := range [][2]int{{3, 1}, {3, 4}, {256, 2}} {
+		if _, err := Split(key, p[0], p[1]); !errors.Is(err, ErrBadParameters) {
+			t.Errorf("%d of %d: got %v, want %v", p[1], p[0], err, ErrBadParameters)
+		}
+	}
+}
+
+// TestArmor writes shares as text with notes around them, reads them back
+// and checks that a changed character is caught by the checksum.
+func TestArmor(t *testing.T) {
+	shares := split(t, testKey(), 3, 2)
+
+	var text strings.Builder
+	for _, s := range shares {
+		b, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		text.WriteString("Note for the holder of this share.\n")
+		text.Write(b)
+	}
+
+	got, err := ParseShares(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, shares) {
+		t.Fatalf("parsed %+v, want %+v", got, shares)
+	}
+
+	armored, _ := shares[0].MarshalText()
+	lines := strings.Split(string(armored), "\n")
+	body := lines[7]
+	c := byte('A')
+	if body[0] == 'A' {
+		c = 'B'
+	}
+	lines[7] = string(c) + body[1:]
+
+	_, err = ParseShares(strings.NewReader(strings.Join(lines, "\n")))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("changed share: got %v, want %v", err, ErrChecksum)
+	}
+}
@@ -1,35 +1,35 @@
 package sg
 
-import (
-	"fmt"
-	"os"
-
-	"github.com/schollz/progressbar/v3"
-)
-
-func CreateBin(n int, filename, key string) {
-	w, err := NewWaver(key, "", false)
+func CreateBin(n int, filename string, key *Key, nonce Nonce, opts ...Option) error {
+	w, err := NewWaver(key, nonce, false, opts...)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer w.Close()
+
+	o := newOptions(opts)
 
-	file, err := os.Create(filename + ".bin")
+	file, err := CreateAtomic(filename+".bin", 0o644)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
+	defer file.Abort()
 
-	bar := progressbar.Default(int64(n))
+	progress := o.newProgress(int64(n))
 
 	buf := make([]byte, n)
 	for i := 0; i < n; i++ {
 		buf[i] = w.GetNext()
-		bar.Add(1)
+		if (i+1)%BlockSize == 0 {
+			progress.add(BlockSize)
+		}
 	}
+	progress.add(int64(n % BlockSize))
+	progress.finish()
 
 	if _, err := file.Write(buf); err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Println("Done")
+	return file.Commit()
 }